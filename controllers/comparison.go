@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Tsarbomba69-com/mammoth.server/ddl"
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+	"github.com/gin-gonic/gin"
+)
+
+// comparison is a project's schema comparison and migration plan, as selected
+// by the /compare query parameters
+type comparison struct {
+	diff      models.SchemaDiff
+	plan      services.MigrationPlan
+	dialect   string
+	direction string          // left or right
+	source    []models.Schema // Schema the migration starts from
+}
+
+// requestError is an error answered with its own status code
+type requestError struct {
+	status  int
+	message string
+}
+
+func (e requestError) Error() string {
+	return e.message
+}
+
+// errorStatus maps an error to an HTTP status code, internal unless it is a requestError
+func errorStatus(err error) int {
+	var reqErr requestError
+	if errors.As(err, &reqErr) {
+		return reqErr.status
+	}
+	return http.StatusInternalServerError
+}
+
+// compareFromQuery loads and compares the schemas selected by the query
+// (filters, snapshots, direction) and plans the migration between them
+func compareFromQuery(c *gin.Context, project models.Project) (comparison, error) {
+	filter := project.Filters.Merge(filterFromQuery(c))
+	if err := filter.Validate(); err != nil {
+		return comparison{}, requestError{http.StatusBadRequest, err.Error()}
+	}
+
+	sourceRequest, err := schemaSourceFromQuery(c, "source")
+	if err != nil {
+		return comparison{}, requestError{http.StatusBadRequest, err.Error()}
+	}
+
+	targetRequest, err := schemaSourceFromQuery(c, "target")
+	if err != nil {
+		return comparison{}, requestError{http.StatusBadRequest, err.Error()}
+	}
+
+	sourceSchema, dialect, err := loadSchema(c.Request.Context(), project, sourceRequest, filter)
+	if err != nil {
+		return comparison{}, requestError{schemaSourceStatus(err), "Failed to dump schema"}
+	}
+
+	targetSchema, _, err := loadSchema(c.Request.Context(), project, targetRequest, filter)
+	if err != nil {
+		return comparison{}, requestError{schemaSourceStatus(err), "Failed to dump schema"}
+	}
+
+	migratedRequest := sourceRequest
+	direction := "left"
+	switch c.DefaultQuery("direction", "left") {
+	case "right":
+		sourceSchema, targetSchema = targetSchema, sourceSchema
+		migratedRequest = targetRequest
+		direction = "right"
+	default: // source_to_target
+	}
+	compared := services.StartPhase(c.Request.Context(), services.PhaseComparing)
+	diff := services.CompareSchemas(dialect, sourceSchema, targetSchema)
+	compared()
+
+	if checkData, _ := strconv.ParseBool(c.Query("check_data")); checkData {
+		db, err := connectSchemaSource(c.Request.Context(), project, migratedRequest)
+		if err != nil {
+			return comparison{}, requestError{http.StatusInternalServerError, "Failed to connect to databases"}
+		}
+		err = services.CheckFeasibility(db, &diff, feasibilitySampleSize)
+		models.Close(db)
+		if err != nil {
+			return comparison{}, err
+		}
+	}
+
+	templates, err := ddl.ParseTemplates(project.Templates)
+	if err != nil {
+		return comparison{}, err
+	}
+
+	transactions, _ := strconv.ParseBool(c.Query("transactions"))
+	concurrently, _ := strconv.ParseBool(c.Query("concurrently"))
+	online, _ := strconv.ParseBool(c.Query("online"))
+	idempotent, _ := strconv.ParseBool(c.Query("idempotent"))
+	generated := services.StartPhase(c.Request.Context(), services.PhaseGenerating)
+	plan := services.PlanMigration(dialect, diff, services.GenerateOptions{
+		Transactions: transactions,
+		Concurrently: concurrently,
+		Online:       online,
+		Idempotent:   idempotent,
+		Templates:    templates,
+	})
+	generated()
+
+	return comparison{diff: diff, plan: plan, dialect: dialect, direction: direction, source: sourceSchema}, nil
+}
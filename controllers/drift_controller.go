@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Tsarbomba69-com/mammoth.server/mappers"
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"github.com/Tsarbomba69-com/mammoth.server/repositories"
+	"github.com/Tsarbomba69-com/mammoth.server/schemas"
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// UpdateDriftConfig sets the drift detection schedule and webhook of a project
+// @Summary Configure drift detection
+// @Description Sets the cron schedule and webhook URL used for scheduled drift detection. An empty schedule disables it.
+// @Tags drift
+// @Accept  json
+// @Produce  json
+// @Param   id      path  string                      true  "Project ID"
+// @Param   config  body  schemas.DriftConfigRequest  true  "Drift configuration"
+// @Success 200  {object}  schemas.ProjectResponse
+// @Failure 400  {object}  map[string]any
+// @Failure 404  {object}  map[string]any
+// @Router  /api/v1/projects/{id}/drift [put]
+func UpdateDriftConfig(c *gin.Context) {
+	projectID := c.Param("id")
+	var project models.Project
+	var input schemas.DriftConfigRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.DriftSchedule != "" {
+		if err := services.ValidateCron(input.DriftSchedule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := repositories.Context.Preload("Source").Preload("Target").First(&project, projectID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+
+	project.DriftSchedule = input.DriftSchedule
+	project.DriftWebhookURL = input.DriftWebhookURL
+	if err := repositories.Context.Model(&project).Select("DriftSchedule", "DriftWebhookURL").Updates(&project).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update drift configuration"})
+		return
+	}
+
+	if services.Scheduler != nil {
+		if err := services.Scheduler.Schedule(project); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, mappers.ProjectToResponse(project))
+}
+
+// GetDriftEvents retrieves a paginated list of a project's drift events
+// @Summary List drift events
+// @Description Retrieves the results of scheduled drift detection runs, newest first
+// @Tags drift
+// @Accept  json
+// @Produce  json
+// @Param   id         path   string  true   "Project ID"
+// @Param   has_drift  query  bool    false  "Only return events with (true) or without (false) drift"
+// @Param   page       query  int     false  "Page number (default: 1)"
+// @Param   limit      query  int     false  "Number of items per page (default: 10, max: 100)"
+// @Success 200  {object}  schemas.PageResponse[schemas.DriftEventResponse]
+// @Failure 404  {object}  map[string]any
+// @Router  /api/v1/projects/{id}/drift/events [get]
+func GetDriftEvents(c *gin.Context) {
+	projectID := c.Param("id")
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+
+	var project models.Project
+	if err := repositories.Context.First(&project, projectID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+
+	query := func() *gorm.DB {
+		q := repositories.Context.Model(&models.DriftEvent{}).Where("project_id = ?", project.ID)
+		if hasDrift, err := strconv.ParseBool(c.Query("has_drift")); err == nil {
+			q = q.Where("has_drift = ?", hasDrift)
+		}
+		return q
+	}
+
+	var events []models.DriftEvent
+	var total int64
+	offset := (page - 1) * limit
+	query().Count(&total)
+	query().Order("id DESC").Limit(limit).Offset(offset).Find(&events)
+
+	var entries = []schemas.DriftEventResponse{}
+	for _, event := range events {
+		entries = append(entries, mappers.DriftEventToResponse(event))
+	}
+
+	c.JSON(http.StatusOK, schemas.PageResponse[schemas.DriftEventResponse]{
+		Total:   uint(total),
+		Page:    uint(page),
+		Limit:   uint(limit),
+		Entries: entries,
+	})
+}
@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Tsarbomba69-com/mammoth.server/exporters"
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"github.com/Tsarbomba69-com/mammoth.server/repositories"
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+	"github.com/gin-gonic/gin"
+)
+
+var versionPattern = regexp.MustCompile(`^[0-9]+$`)
+
+// ExportMigration downloads a project's migration as the files of a migration runner
+// @Summary Export migration files
+// @Description Compares the project's schemas like /compare and downloads the migration as a zip of versioned files for golang-migrate, Flyway, goose or Liquibase
+// @Tags projects
+// @Produce  application/zip
+// @Param   id         path   string  true   "Project ID"
+// @Param   format     query  string  true   "Export format (golang-migrate, flyway, goose, liquibase-yaml or liquibase-xml)"
+// @Param   name       query  string  false  "Migration name used in file names" default(migration)
+// @Param   version    query  string  false  "Numeric migration version, defaults to the current UTC time as YYYYMMDDHHMMSS"
+// @Param   direction  query  string  false  "Comparison direction (left or right)" default(left)
+// @Param   source_snapshot  query  int   false  "Snapshot ID to use instead of the live source database"
+// @Param   target_snapshot  query  int   false  "Snapshot ID to use instead of the live target database"
+// @Param   transactions     query  bool  false  "Wrap transactional statements in transaction blocks"
+// @Param   concurrently     query  bool  false  "Create and drop indexes of existing tables concurrently"
+// @Param   online           query  bool  false  "Split changes to existing tables into expand, migrate and contract phases"
+// @Param   idempotent       query  bool  false  "Guard statements with IF [NOT] EXISTS so that a partially applied script can be run again"
+// @Success 200  {file}    file
+// @Failure 400  {object}  map[string]any
+// @Failure 404  {object}  map[string]any
+// @Failure 500  {object}  map[string]any
+// @Router  /api/v1/projects/{id}/export [get]
+func ExportMigration(c *gin.Context) {
+	projectID := c.Param("id")
+	var project models.Project
+
+	exporter, ok := exporterFromQuery(c)
+	if !ok {
+		return
+	}
+	version := c.DefaultQuery("version", time.Now().UTC().Format("20060102150405"))
+	if !versionPattern.MatchString(version) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "version must be numeric"})
+		return
+	}
+
+	if err := repositories.Context.Preload("Source").Preload("Target").First(&project, projectID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+
+	cmp, err := compareFromQuery(c, project)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	export(c, exporter, project, version, cmp.plan)
+}
+
+// ExportStoredMigration downloads a tracked migration as the files of a migration runner
+// @Summary Export a tracked migration
+// @Description Downloads the up and down scripts of a tracked migration as a zip of versioned files for golang-migrate, Flyway, goose or Liquibase
+// @Tags projects
+// @Produce  application/zip
+// @Param   id       path   string  true   "Project ID"
+// @Param   mid      path   string  true   "Migration ID"
+// @Param   format   query  string  true   "Export format (golang-migrate, flyway, goose, liquibase-yaml or liquibase-xml)"
+// @Param   name     query  string  false  "Migration name used in file names" default(migration)
+// @Param   version  query  string  false  "Numeric migration version, defaults to the UTC time the migration was applied as YYYYMMDDHHMMSS, or its ID when it was not applied"
+// @Success 200  {file}    file
+// @Failure 400  {object}  map[string]any
+// @Failure 404  {object}  map[string]any
+// @Failure 500  {object}  map[string]any
+// @Router  /api/v1/projects/{id}/migrations/{mid}/export [get]
+func ExportStoredMigration(c *gin.Context) {
+	var project models.Project
+	var migration models.Migration
+
+	exporter, ok := exporterFromQuery(c)
+	if !ok {
+		return
+	}
+
+	if err := repositories.Context.First(&project, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+	if err := repositories.Context.Where("project_id = ?", project.ID).First(&migration, c.Param("mid")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Migration not found"})
+		return
+	}
+
+	version := strconv.FormatUint(uint64(migration.ID), 10)
+	if migration.AppliedAt != nil {
+		version = migration.AppliedAt.UTC().Format("20060102150405")
+	}
+	version = c.DefaultQuery("version", version)
+	if !versionPattern.MatchString(version) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "version must be numeric"})
+		return
+	}
+
+	export(c, exporter, project, version, services.ScriptPlan(services.MigrationScript{Up: migration.Up, Down: migration.Down}))
+}
+
+// exporterFromQuery returns the exporter of the requested format, answering
+// with 400 when the format is not supported
+func exporterFromQuery(c *gin.Context) (exporters.Exporter, bool) {
+	exporter, err := exporters.NewExporter(c.Query("format"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return exporter, true
+}
+
+// export answers with the zip of the files exporting the plan
+func export(c *gin.Context, exporter exporters.Exporter, project models.Project, version string, plan services.MigrationPlan) {
+	files, err := exporter.Export(version, c.DefaultQuery("name", "migration"), plan)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export migration"})
+		return
+	}
+
+	var archive bytes.Buffer
+	if err := exporters.WriteZip(&archive, files); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write archive"})
+		return
+	}
+
+	filename := fmt.Sprintf("%s-%s-%s.zip", exporters.SafeName(project.Name), version, strings.ToLower(c.Query("format")))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Data(http.StatusOK, "application/zip", archive.Bytes())
+}
@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/Tsarbomba69-com/mammoth.server/mappers"
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"github.com/Tsarbomba69-com/mammoth.server/repositories"
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+// jobResponse buffers the response of a handler run as a job
+type jobResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *jobResponse) Header() http.Header {
+	return w.header
+}
+
+func (w *jobResponse) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(data)
+}
+
+func (w *jobResponse) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+// Async runs a project handler as a background job when the request has
+// async=true, answering 202 with the job. The handler later serves a copy of
+// the request bound to the job's context, its response becomes the result.
+func Async(kind string, handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if async, _ := strconv.ParseBool(c.Query("async")); !async {
+			handler(c)
+			return
+		}
+
+		if services.Jobs == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Background jobs are not running"})
+			return
+		}
+
+		var project models.Project
+		if err := repositories.Context.First(&project, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			return
+		}
+		method, route, request := c.Request.Method, c.FullPath(), c.Request
+
+		job, err := services.Jobs.Submit(project.ID, kind, func(ctx context.Context, job *models.Job) error {
+			engine := gin.New()
+			engine.Handle(method, route, handler)
+			response := &jobResponse{header: make(http.Header)}
+			replay := request.Clone(ctx)
+			replay.Body = io.NopCloser(bytes.NewReader(body))
+			engine.ServeHTTP(response, replay)
+
+			job.ResultStatus = response.status
+			job.ResultType = response.header.Get("Content-Type")
+			job.Result = response.body.Bytes()
+			if response.status >= http.StatusBadRequest {
+				return errors.New(resultError(response))
+			}
+			return nil
+		})
+		if errors.Is(err, services.ErrQueueFull) || errors.Is(err, services.ErrQueueStopped) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("Location", fmt.Sprintf("/api/v1/projects/%d/jobs/%d", project.ID, job.ID))
+		c.JSON(http.StatusAccepted, mappers.JobToResponse(job))
+	}
+}
+
+// resultError is the error message of a failed job's response
+func resultError(response *jobResponse) string {
+	var body struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(response.body.Bytes(), &body) == nil && body.Error != "" {
+		return body.Error
+	}
+	return http.StatusText(response.status)
+}
+
+// findJob loads a job of the project in the path, answering 404 when missing
+func findJob(c *gin.Context) (models.Job, bool) {
+	var job models.Job
+	if err := repositories.Context.Where("project_id = ?", c.Param("id")).First(&job, c.Param("jid")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return job, false
+	}
+	return job, true
+}
+
+// GetJob retrieves the status of a background job
+// @Summary Get job
+// @Description Retrieves the status of a compare, dump or apply request run in the background with async=true
+// @Tags jobs
+// @Produce  json
+// @Param   id   path  string  true  "Project ID"
+// @Param   jid  path  string  true  "Job ID"
+// @Success 200  {object}  schemas.JobResponse
+// @Failure 404  {object}  map[string]any
+// @Router  /api/v1/projects/{id}/jobs/{jid} [get]
+func GetJob(c *gin.Context) {
+	job, ok := findJob(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, mappers.JobToResponse(job))
+}
+
+// GetJobResult retrieves the result of a finished background job
+// @Summary Get job result
+// @Description Answers with the status and body the request would have been answered with had it not run in the background
+// @Tags jobs
+// @Produce  json
+// @Param   id   path  string  true  "Project ID"
+// @Param   jid  path  string  true  "Job ID"
+// @Success 200  {object}  map[string]any
+// @Failure 404  {object}  map[string]any
+// @Failure 409  {object}  map[string]any
+// @Router  /api/v1/projects/{id}/jobs/{jid}/result [get]
+func GetJobResult(c *gin.Context) {
+	job, ok := findJob(c)
+	if !ok {
+		return
+	}
+
+	if !job.Finished() || job.Status == models.JobCanceled {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("job is %s", job.Status)})
+		return
+	}
+	if job.ResultStatus == 0 {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": job.Error})
+		return
+	}
+
+	c.Data(job.ResultStatus, job.ResultType, job.Result)
+}
+
+// CancelJob cancels a queued or running background job
+// @Summary Cancel job
+// @Description Cancels the context of a queued or running job, stopping its database work
+// @Tags jobs
+// @Produce  json
+// @Param   id   path  string  true  "Project ID"
+// @Param   jid  path  string  true  "Job ID"
+// @Success 202  {object}  schemas.JobResponse
+// @Failure 404  {object}  map[string]any
+// @Failure 409  {object}  map[string]any
+// @Router  /api/v1/projects/{id}/jobs/{jid}/cancel [post]
+func CancelJob(c *gin.Context) {
+	job, ok := findJob(c)
+	if !ok {
+		return
+	}
+
+	if job.Finished() || services.Jobs == nil || !services.Jobs.Cancel(job.ID) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("job is %s", job.Status)})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, mappers.JobToResponse(job))
+}
+
+// StreamJobEvents streams the progress of a background job as Server-Sent Events
+// @Summary Stream job events
+// @Description Streams "status" events as the job goes from queued to running to a final status, and "phase" events as it connects, introspects, compares, generates and executes statements. The final status event carries the time spent in each phase and ends the stream. Events are numbered, a Last-Event-ID header resumes after the given event. Finished jobs answer with their final status only.
+// @Tags jobs
+// @Produce  text/event-stream
+// @Param   id             path    string  true   "Project ID"
+// @Param   jid            path    string  true   "Job ID"
+// @Param   Last-Event-ID  header  int     false  "ID of the last event received"
+// @Success 200  {object}  services.JobStatusEvent
+// @Failure 404  {object}  map[string]any
+// @Router  /api/v1/projects/{id}/jobs/{jid}/events [get]
+func StreamJobEvents(c *gin.Context) {
+	job, ok := findJob(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	var stream *services.JobEvents
+	if services.Jobs != nil {
+		stream, _ = services.Jobs.Events(job.ID)
+	}
+	if stream == nil {
+		c.Render(http.StatusOK, sse.Event{
+			Event: services.JobEventStatus,
+			Data:  services.JobStatusEvent{Status: job.Status, Error: job.Error},
+		})
+		return
+	}
+
+	next, _ := strconv.Atoi(c.GetHeader("Last-Event-ID"))
+	for {
+		events, closed, published := stream.Since(next)
+		for _, event := range events {
+			next++
+			c.Render(http.StatusOK, sse.Event{Id: strconv.Itoa(next), Event: event.Name, Data: event.Data})
+		}
+		c.Writer.Flush()
+		if closed {
+			return
+		}
+
+		select {
+		case <-published:
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/Tsarbomba69-com/mammoth.server/mappers"
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"github.com/Tsarbomba69-com/mammoth.server/repositories"
+	"github.com/Tsarbomba69-com/mammoth.server/schemas"
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+	"github.com/gin-gonic/gin"
+)
+
+// Lint reviews the migration between a project's schemas
+// @Summary Lint migration
+// @Description Compares the project's schemas like /compare and runs the project's enabled lint rules over the diff and the planned migration
+// @Tags projects
+// @Produce  json
+// @Param   id         path   string  true   "Project ID"
+// @Param   direction  query  string  false  "Comparison direction (left or right)" default(left)
+// @Param   source_snapshot  query  int   false  "Snapshot ID to use instead of the live source database"
+// @Param   target_snapshot  query  int   false  "Snapshot ID to use instead of the live target database"
+// @Param   concurrently     query  bool  false  "Create and drop indexes of existing tables concurrently"
+// @Param   online           query  bool  false  "Split changes to existing tables into expand, migrate and contract phases"
+// @Param   idempotent       query  bool  false  "Guard statements with IF [NOT] EXISTS so that a partially applied script can be run again"
+// @Success 200  {object}  schemas.LintResponse
+// @Failure 400  {object}  map[string]any
+// @Failure 404  {object}  map[string]any
+// @Failure 500  {object}  map[string]any
+// @Router  /api/v1/projects/{id}/lint [get]
+func Lint(c *gin.Context) {
+	projectID := c.Param("id")
+	var project models.Project
+
+	if err := repositories.Context.Preload("Source").Preload("Target").First(&project, projectID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+
+	cmp, err := compareFromQuery(c, project)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	rules := make([]schemas.LintRuleStatus, len(services.LintRules))
+	for i, rule := range services.LintRules {
+		rules[i] = schemas.LintRuleStatus{LintRule: rule, Enabled: project.LintRules.Enabled(rule.Name)}
+	}
+
+	c.JSON(http.StatusOK, schemas.LintResponse{
+		Rules:    rules,
+		Findings: services.Lint(cmp.diff, cmp.plan, project.LintRules),
+	})
+}
+
+// UpdateLintRules enables or disables lint rules of a project
+// @Summary Update project lint rules
+// @Description Replaces the project's lint rule settings. Rules map to whether they run, rules not listed run.
+// @Tags projects
+// @Accept  json
+// @Produce  json
+// @Param   id     path  string            true  "Project ID"
+// @Param   rules  body  models.LintRules  true  "Rule names mapped to whether they run"
+// @Success 200  {object}  schemas.ProjectResponse
+// @Failure 400  {object}  map[string]any
+// @Failure 404  {object}  map[string]any
+// @Router  /api/v1/projects/{id}/lint/rules [put]
+func UpdateLintRules(c *gin.Context) {
+	projectID := c.Param("id")
+	var project models.Project
+	var rules models.LintRules
+
+	if err := c.ShouldBindJSON(&rules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := services.ValidateLintRules(rules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := repositories.Context.Preload("Source").Preload("Target").First(&project, projectID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+
+	project.LintRules = rules
+	if err := repositories.Context.Model(&project).Select("LintRules").Updates(&project).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update lint rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, mappers.ProjectToResponse(project))
+}
@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Tsarbomba69-com/mammoth.server/ddl"
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"github.com/Tsarbomba69-com/mammoth.server/repositories"
+	"github.com/Tsarbomba69-com/mammoth.server/schemas"
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+	"github.com/gin-gonic/gin"
+)
+
+// Merge performs a three-way schema comparison for branch merges
+// @Summary Three-way schema merge
+// @Description Compares base→ours and base→theirs, reports the non-conflicting changes of each side, the conflicts and a merged migration
+// @Tags projects
+// @Accept  json
+// @Produce  json
+// @Param   id       path  string                true  "Project ID"
+// @Param   request  body  schemas.MergeRequest  true  "Base, ours and theirs schema sources"
+// @Param   include_schemas    query  string  false "Comma-separated schema patterns to include (overrides project filters)"
+// @Param   exclude_schemas    query  string  false "Comma-separated schema patterns to exclude (overrides project filters)"
+// @Param   include_tables     query  string  false "Comma-separated table patterns to include (overrides project filters)"
+// @Param   exclude_tables     query  string  false "Comma-separated table patterns to exclude (overrides project filters)"
+// @Param   include_columns    query  string  false "Comma-separated column patterns to include (overrides project filters)"
+// @Param   exclude_columns    query  string  false "Comma-separated column patterns to exclude (overrides project filters)"
+// @Param   include_sequences  query  string  false "Comma-separated sequence patterns to include (overrides project filters)"
+// @Param   exclude_sequences  query  string  false "Comma-separated sequence patterns to exclude (overrides project filters)"
+// @Param   skip_indexes       query  bool    false "Ignore indexes"
+// @Param   skip_foreign_keys  query  bool    false "Ignore foreign keys"
+// @Param   skip_sequences     query  bool    false "Ignore sequences"
+// @Success 200  {object}  schemas.MergeResponse
+// @Failure 400  {object}  map[string]any
+// @Failure 404  {object}  map[string]any
+// @Failure 500  {object}  map[string]any
+// @Router  /api/v1/projects/{id}/merge [post]
+func Merge(c *gin.Context) {
+	projectID := c.Param("id")
+	var project models.Project
+	var input schemas.MergeRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, source := range []schemas.SchemaSourceRequest{input.Base, input.Ours, input.Theirs} {
+		if err := validateSchemaSource(source); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := repositories.Context.Preload("Source").Preload("Target").First(&project, projectID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+
+	filter := project.Filters.Merge(filterFromQuery(c))
+	if err := filter.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	base, dialect, err := loadSchema(c.Request.Context(), project, input.Base, filter)
+	if err != nil {
+		c.JSON(schemaSourceStatus(err), gin.H{"error": fmt.Sprintf("Failed to load base schema: %v", err)})
+		return
+	}
+
+	ours, _, err := loadSchema(c.Request.Context(), project, input.Ours, filter)
+	if err != nil {
+		c.JSON(schemaSourceStatus(err), gin.H{"error": fmt.Sprintf("Failed to load ours schema: %v", err)})
+		return
+	}
+
+	theirs, _, err := loadSchema(c.Request.Context(), project, input.Theirs, filter)
+	if err != nil {
+		c.JSON(schemaSourceStatus(err), gin.H{"error": fmt.Sprintf("Failed to load theirs schema: %v", err)})
+		return
+	}
+
+	templates, err := ddl.ParseTemplates(project.Templates)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	merge := services.Merge(dialect, base, ours, theirs)
+	c.JSON(http.StatusOK, schemas.MergeResponse{
+		SchemaMerge:     merge,
+		MigrationScript: services.Generate(dialect, merge.Merged, services.GenerateOptions{Templates: templates}),
+	})
+}
@@ -0,0 +1,354 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Tsarbomba69-com/mammoth.server/mappers"
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"github.com/Tsarbomba69-com/mammoth.server/repositories"
+	"github.com/Tsarbomba69-com/mammoth.server/schemas"
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ApplyMigration runs a migration script against a project's target
+// @Summary Apply migration
+// @Description Executes a generated or edited script statement by statement against the project's target database and records it in the project's migrations, along with a snapshot of the target taken beforehand. A script recorded as pending by /compare?record=true is applied under that record. Consecutive statements that can run in a transaction share one, BEGIN and COMMIT statements of the script are ignored. Execution stops at the first failing statement, whose transaction is rolled back.
+// @Description With dry_run the whole script runs in one transaction under a statement timeout and is rolled back. Every failing statement and server notice is reported, along with the resulting schema and its differences with the intended one.
+// @Tags projects
+// @Accept  json
+// @Produce  json
+// @Param   id       path   string                         true   "Project ID"
+// @Param   request  body   schemas.ApplyMigrationRequest  true   "Script to apply"
+// @Param   async    query  bool                           false  "Run in the background and answer 202 with the job"
+// @Success 200  {object}  schemas.ApplyMigrationResponse "Applied migration, or services.DryRun for dry runs"
+// @Success 202  {object}  schemas.JobResponse
+// @Failure 400  {object}  map[string]any
+// @Failure 404  {object}  map[string]any
+// @Failure 422  {object}  schemas.ApplyMigrationResponse
+// @Failure 500  {object}  map[string]any
+// @Router  /api/v1/projects/{id}/migrations/apply [post]
+func ApplyMigration(c *gin.Context) {
+	projectID := c.Param("id")
+	var project models.Project
+	var input schemas.ApplyMigrationRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	steps := services.ScriptSteps(input.Script)
+	if len(steps) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "script has no statements"})
+		return
+	}
+
+	if err := repositories.Context.Preload("Source").Preload("Target").First(&project, projectID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+
+	if input.DryRun {
+		dryRun(c, project, input, steps)
+		return
+	}
+
+	connected := services.StartPhase(c.Request.Context(), services.PhaseConnecting)
+	target, err := project.Target.Connect()
+	connected()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to target database"})
+		return
+	}
+	defer models.Close(target)
+	target = target.WithContext(c.Request.Context())
+
+	before, err := services.DumpSchema(target, project.Filters)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to dump target schema"})
+		return
+	}
+	snapshot := models.Snapshot{
+		ProjectID:      project.ID,
+		DBConnectionID: project.TargetID,
+		Side:           "target",
+		Label:          "pre-migration",
+		Dialect:        project.GetDialect(target),
+		Schemas:        before,
+	}
+	if err := repositories.Context.Create(&snapshot).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save pre-migration snapshot"})
+		return
+	}
+
+	migration := models.Migration{
+		ProjectID: project.ID,
+		Direction: input.Direction,
+		Checksum:  services.ScriptChecksum(input.Script),
+		Status:    models.MigrationPending,
+	}
+	if migration.Direction == "" {
+		migration.Direction = "left"
+	}
+	// A migration recorded when it was generated is applied under its record
+	var recorded models.Migration
+	if repositories.Context.Where(&migration).Order("id DESC").Limit(1).Find(&recorded).RowsAffected > 0 {
+		migration = recorded
+	}
+	migration.SnapshotID = &snapshot.ID
+	migration.Up = input.Script
+	if input.Down != "" {
+		migration.Down = input.Down
+	}
+	migration.AppliedBy = input.AppliedBy
+	if err := repositories.Context.Save(&migration).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record migration"})
+		return
+	}
+
+	execution := services.ApplyMigration(target, steps)
+
+	appliedAt := time.Now()
+	migration.AppliedAt = &appliedAt
+	migration.DurationMs = execution.DurationMs
+	migration.Status = models.MigrationApplied
+	if !execution.Success {
+		migration.Status = models.MigrationFailed
+		migration.Error = fmt.Sprintf("%s: %s", execution.Failed.Step, execution.Failed.Error)
+	}
+	if err := repositories.Context.Save(&migration).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record migration"})
+		return
+	}
+
+	response := schemas.ApplyMigrationResponse{MigrationID: migration.ID, MigrationExecution: execution}
+	if !execution.Success {
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetMigrations retrieves a paginated list of a project's migrations
+// @Summary List migrations
+// @Description Retrieves the migrations recorded for the project's target, generated ones still pending and applied ones, newest first
+// @Tags projects
+// @Produce  json
+// @Param   id          path   string  true   "Project ID"
+// @Param   status      query  string  false  "Only return migrations with this status (pending, applied, failed or rolled_back)"
+// @Param   direction   query  string  false  "Only return migrations generated for this comparison direction (left or right)"
+// @Param   applied_by  query  string  false  "Only return migrations applied by this user"
+// @Param   page        query  int     false  "Page number (default: 1)"
+// @Param   limit       query  int     false  "Number of items per page (default: 10, max: 100)"
+// @Success 200  {object}  schemas.PageResponse[schemas.MigrationResponse]
+// @Failure 404  {object}  map[string]any
+// @Router  /api/v1/projects/{id}/migrations [get]
+func GetMigrations(c *gin.Context) {
+	projectID := c.Param("id")
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+
+	var project models.Project
+	if err := repositories.Context.First(&project, projectID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+
+	query := func() *gorm.DB {
+		q := repositories.Context.Model(&models.Migration{}).Where("project_id = ?", project.ID)
+		for _, column := range []string{"status", "direction", "applied_by"} {
+			if value := c.Query(column); value != "" {
+				q = q.Where(column+" = ?", value)
+			}
+		}
+		return q
+	}
+
+	var migrations []models.Migration
+	var total int64
+	offset := (page - 1) * limit
+	query().Count(&total)
+	query().Order("id DESC").Limit(limit).Offset(offset).Find(&migrations)
+
+	var entries = []schemas.MigrationResponse{}
+	for _, migration := range migrations {
+		entries = append(entries, mappers.MigrationToResponse(migration))
+	}
+
+	c.JSON(http.StatusOK, schemas.PageResponse[schemas.MigrationResponse]{
+		Total:   uint(total),
+		Page:    uint(page),
+		Limit:   uint(limit),
+		Entries: entries,
+	})
+}
+
+// GetMigration retrieves one of a project's migrations
+// @Summary Get migration
+// @Tags projects
+// @Produce  json
+// @Param   id   path  string  true  "Project ID"
+// @Param   mid  path  string  true  "Migration ID"
+// @Success 200  {object}  schemas.MigrationResponse
+// @Failure 404  {object}  map[string]any
+// @Router  /api/v1/projects/{id}/migrations/{mid} [get]
+func GetMigration(c *gin.Context) {
+	var migration models.Migration
+	if err := repositories.Context.Where("project_id = ?", c.Param("id")).First(&migration, c.Param("mid")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Migration not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, mappers.MigrationToResponse(migration))
+}
+
+// defaultStatementTimeout bounds each statement of a dry run
+const defaultStatementTimeout = 30 * time.Second
+
+// dryRun answers an apply request made with dry_run
+func dryRun(c *gin.Context, project models.Project, input schemas.ApplyMigrationRequest, steps []services.MigrationStep) {
+	intendedSource := schemas.SchemaSourceRequest{Side: "source"}
+	if input.Intended != nil {
+		intendedSource = *input.Intended
+	}
+	if err := validateSchemaSource(intendedSource); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	intended, _, err := loadSchema(c.Request.Context(), project, intendedSource, project.Filters)
+	if err != nil {
+		c.JSON(schemaSourceStatus(err), gin.H{"error": "Failed to load intended schema"})
+		return
+	}
+
+	var mu sync.Mutex
+	var notices []string
+	connected := services.StartPhase(c.Request.Context(), services.PhaseConnecting)
+	target, err := project.Target.ConnectWithNotices(func(message string) {
+		mu.Lock()
+		defer mu.Unlock()
+		notices = append(notices, message)
+	})
+	connected()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to target database"})
+		return
+	}
+	defer models.Close(target)
+	target = target.WithContext(c.Request.Context())
+
+	timeout := defaultStatementTimeout
+	if input.StatementTimeout > 0 {
+		timeout = time.Duration(input.StatementTimeout) * time.Millisecond
+	}
+	result, err := services.DryRunMigration(target, steps, timeout, intended, project.Filters)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	mu.Lock()
+	result.Notices = append(result.Notices, notices...)
+	mu.Unlock()
+
+	if !result.Success {
+		c.JSON(http.StatusUnprocessableEntity, result)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// RollbackMigration runs the down script of an applied migration
+// @Summary Roll back migration
+// @Description Executes the stored down script of an applied migration against the project's target and checks that the target matches the snapshot taken before the migration. Refused while later migrations are applied, unless cascade rolls them back first, newest first. Stops at the first failing rollback.
+// @Tags projects
+// @Produce  json
+// @Param   id       path   string  true   "Project ID"
+// @Param   mid      path   string  true   "Migration ID"
+// @Param   cascade  query  bool    false  "Roll back later applied migrations first"
+// @Success 200  {object}  schemas.RollbackResponse
+// @Failure 404  {object}  map[string]any
+// @Failure 409  {object}  map[string]any
+// @Failure 422  {object}  schemas.RollbackResponse
+// @Failure 500  {object}  map[string]any
+// @Router  /api/v1/projects/{id}/migrations/{mid}/rollback [post]
+func RollbackMigration(c *gin.Context) {
+	projectID := c.Param("id")
+	var project models.Project
+	var migration models.Migration
+
+	if err := repositories.Context.Preload("Target").First(&project, projectID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+
+	if err := repositories.Context.Where("project_id = ?", project.ID).First(&migration, c.Param("mid")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Migration not found"})
+		return
+	}
+
+	if migration.Status != models.MigrationApplied {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("migration is %s, only applied migrations can be rolled back", migration.Status)})
+		return
+	}
+
+	var later []models.Migration
+	if err := repositories.Context.Where("project_id = ? AND id > ? AND status = ?", project.ID, migration.ID, models.MigrationApplied).
+		Order("id DESC").Find(&later).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load migrations"})
+		return
+	}
+	cascade, _ := strconv.ParseBool(c.Query("cascade"))
+	if len(later) > 0 && !cascade {
+		ids := make([]uint, len(later))
+		for i, m := range later {
+			ids[i] = m.ID
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": "later migrations are still applied, roll them back first or cascade", "migrations": ids})
+		return
+	}
+
+	migrations := append(later, migration)
+	for _, m := range migrations {
+		if len(services.ScriptSteps(m.Down)) == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("migration %d has no down script", m.ID)})
+			return
+		}
+	}
+
+	target, err := project.Target.Connect()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to target database"})
+		return
+	}
+	defer models.Close(target)
+	target = target.WithContext(c.Request.Context())
+
+	response := schemas.RollbackResponse{Rollbacks: []services.MigrationRollback{}}
+	for i := range migrations {
+		rollback, err := services.RollbackMigration(repositories.Context, target, &migrations[i], project.Filters)
+		response.Rollbacks = append(response.Rollbacks, rollback)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !rollback.Execution.Success {
+			c.JSON(http.StatusUnprocessableEntity, response)
+			return
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -1,18 +1,26 @@
 package controllers
 
 import (
+	"bytes"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/Tsarbomba69-com/mammoth.server/ddl"
 	"github.com/Tsarbomba69-com/mammoth.server/mappers"
 	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"github.com/Tsarbomba69-com/mammoth.server/reports"
 	"github.com/Tsarbomba69-com/mammoth.server/repositories"
 	"github.com/Tsarbomba69-com/mammoth.server/schemas"
 	"github.com/Tsarbomba69-com/mammoth.server/services"
 	"github.com/gin-gonic/gin"
 )
 
+// feasibilitySampleSize is the number of offending row keys reported per data violation
+const feasibilitySampleSize = 5
+
 // CreateProject creates a new project
 // @Summary Create a project
 // @Description Create a new project with name and description
@@ -30,8 +38,35 @@ func CreateProject(c *gin.Context) {
 		return
 	}
 
+	if err := input.Filters.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := services.ValidateLintRules(input.LintRules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := ddl.ParseTemplates(input.Templates); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.DriftSchedule != "" {
+		if err := services.ValidateCron(input.DriftSchedule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	project := mappers.ProjectToModel(input)
 	repositories.Context.Create(&project)
+	if services.Scheduler != nil {
+		if err := services.Scheduler.Schedule(project); err != nil {
+			log.Printf("drift: failed to schedule project %d: %v", project.ID, err)
+		}
+	}
 	c.JSON(http.StatusCreated, mappers.ProjectToResponse(project))
 }
 
@@ -60,7 +95,7 @@ func GetProjects(c *gin.Context) {
 	var projects []models.Project
 	var total int64
 	offset := (page - 1) * limit
-	repositories.Context.Preload("Source").Preload("Target").Limit(limit).Offset(offset).Find(&projects)
+	repositories.Context.Preload("Source").Preload("Target").Preload("Scratch").Limit(limit).Offset(offset).Find(&projects)
 	repositories.Context.Model(&models.Project{}).Count(&total)
 	var projectResponses = []schemas.ProjectResponse{}
 
@@ -81,67 +116,347 @@ func GetProjects(c *gin.Context) {
 // @Description initiates schema comparison between source and target databases for the specified project
 // @Tags projects
 // @Accept  json
-// @Produce  json
+// @Produce  json,text/markdown,text/html,application/xml
 // @Param   id         path      string  true  "Project ID"
+// @Param   format     query     string  false "Report format (json, markdown, html or junit); defaults to the Accept header"
 // @Param   direction  query     string  false "Comparison direction (left or right)" default(left)
+// @Param   include_schemas    query  string  false "Comma-separated schema patterns to include (overrides project filters)"
+// @Param   exclude_schemas    query  string  false "Comma-separated schema patterns to exclude (overrides project filters)"
+// @Param   include_tables     query  string  false "Comma-separated table patterns to include (overrides project filters)"
+// @Param   exclude_tables     query  string  false "Comma-separated table patterns to exclude (overrides project filters)"
+// @Param   include_columns    query  string  false "Comma-separated column patterns to include (overrides project filters)"
+// @Param   exclude_columns    query  string  false "Comma-separated column patterns to exclude (overrides project filters)"
+// @Param   include_sequences  query  string  false "Comma-separated sequence patterns to include (overrides project filters)"
+// @Param   exclude_sequences  query  string  false "Comma-separated sequence patterns to exclude (overrides project filters)"
+// @Param   skip_indexes       query  bool    false "Ignore indexes"
+// @Param   skip_foreign_keys  query  bool    false "Ignore foreign keys"
+// @Param   skip_sequences     query  bool    false "Ignore sequences"
+// @Param   source_snapshot    query  int     false "Snapshot ID to use instead of the live source database"
+// @Param   target_snapshot    query  int     false "Snapshot ID to use instead of the live target database"
+// @Param   check_data         query  bool    false "Query the migrated database for rows that would make column changes fail"
+// @Param   max_risk           query  string  false "Riskiest change severity to accept (safe, caution or destructive), overrides the project policy"
+// @Param   transactions       query  bool    false "Wrap transactional statements in transaction blocks"
+// @Param   concurrently       query  bool    false "Create and drop indexes of existing tables concurrently"
+// @Param   online             query  bool    false "Split changes to existing tables into expand, migrate and contract phases"
+// @Param   idempotent         query  bool    false "Guard statements with IF [NOT] EXISTS so that a partially applied script can be run again"
+// @Param   verify             query  bool    false "Apply the migration then revert it on the project's scratch database, POST only"
+// @Param   record             query  bool    false "Record the migration in the project's migrations as pending, POST only"
+// @Param   async              query  bool    false "Run in the background and answer 202 with the job"
 // @Success 200  {object}  schemas.SchemaComparisonResponse
+// @Success 202  {object}  schemas.JobResponse
 // @Failure 400  {object}  map[string]any
 // @Failure 404  {object}  map[string]any
+// @Failure 422  {object}  schemas.SchemaComparisonResponse "Changes exceed the allowed risk level or do not revert"
+// @Failure 405  {object}  map[string]any "Verification or recording requested with GET"
 // @Failure 500  {object}  map[string]any
 // @Router  /api/v1/projects/{id}/compare [get]
+// @Router  /api/v1/projects/{id}/compare [post]
 func Compare(c *gin.Context) {
 	projectID := c.Param("id")
-	directionParam := c.DefaultQuery("direction", "left")
 	var project models.Project
-	var sourceSchema []models.Schema
-	var targetSchema []models.Schema
 
-	if err := repositories.Context.Preload("Source").Preload("Target").First(&project, projectID).Error; err != nil {
+	if err := repositories.Context.Preload("Source").Preload("Target").Preload("Scratch").First(&project, projectID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
 		return
 	}
 
-	var source, target, err = project.ConnectForProject()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to databases"})
+	// Verification overwrites the scratch database, safe requests must not trigger it
+	verify, _ := strconv.ParseBool(c.Query("verify"))
+	if verify && c.Request.Method != http.MethodPost {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Verification overwrites the scratch database, send it with POST"})
 		return
 	}
+	record, _ := strconv.ParseBool(c.Query("record"))
+	if record && c.Request.Method != http.MethodPost {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Recording creates a migration, send it with POST"})
+		return
+	}
+
+	maxRisk := c.DefaultQuery("max_risk", project.MaxRisk)
+	if maxRisk != "" {
+		if err := models.ValidateSeverity(maxRisk); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
-	sourceSchema, err = services.DumpSchema(source)
+	format := c.Query("format")
+	if format == "" {
+		format = reports.FormatFromAccept(c.GetHeader("Accept"))
+	}
+	renderer, err := reports.NewRenderer(format)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to dump schema"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	targetSchema, err = services.DumpSchema(target)
+	cmp, err := compareFromQuery(c, project)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to dump schema"})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
+	diff, plan := cmp.diff, cmp.plan
+	script := plan.Script()
+
+	status := http.StatusOK
+	var policy *schemas.RiskPolicyResult
+	if maxRisk != "" {
+		violations := services.RiskViolations(diff, maxRisk)
+		policy = &schemas.RiskPolicyResult{
+			MaxRisk:    maxRisk,
+			Severity:   diff.Severity,
+			Passed:     len(violations) == 0,
+			Violations: violations,
+		}
+		if !policy.Passed {
+			status = http.StatusUnprocessableEntity
+		}
+	}
+
+	var verification *services.MigrationVerification
+	if verify {
+		if project.Scratch == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Project has no scratch database"})
+			return
+		}
+		scratch, err := project.Scratch.Connect()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to scratch database"})
+			return
+		}
+		defer models.Close(scratch)
+		result, err := services.VerifyMigration(scratch, cmp.dialect, cmp.source, plan)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		verification = &result
+		if !verification.Passed {
+			status = http.StatusUnprocessableEntity
+		}
+	}
+
+	var migrationID *uint
+	if record {
+		migration := models.Migration{
+			ProjectID: project.ID,
+			Direction: cmp.direction,
+			Up:        script.Up,
+			Down:      script.Down,
+			Checksum:  services.ScriptChecksum(script.Up),
+			Status:    models.MigrationPending,
+		}
+		if err := repositories.Context.Create(&migration).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record migration"})
+			return
+		}
+		migrationID = &migration.ID
+	}
 
-	switch directionParam {
-	case "right":
-		tmp := sourceSchema
-		sourceSchema = targetSchema
-		targetSchema = tmp
-	default: // source_to_target
+	if renderer != nil {
+		var report bytes.Buffer
+		if err := renderer.Render(&report, diff, script); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render report"})
+			return
+		}
+		c.Data(status, renderer.ContentType(), report.Bytes())
+		return
 	}
-	diff := services.CompareSchemas(sourceSchema, targetSchema)
-	script := services.Generate(project.GetDialect(source), diff)
-	c.JSON(http.StatusOK, schemas.SchemaComparisonResponse{
+
+	c.JSON(status, schemas.SchemaComparisonResponse{
 		Differences:     diff,
 		MigrationScript: script,
+		MigrationPlan:   plan,
+		Policy:          policy,
+		Verification:    verification,
+		LintFindings:    services.Lint(diff, plan, project.LintRules),
+		MigrationID:     migrationID,
 	})
 }
 
+// UpdateScratchDatabase sets the disposable database a project's migrations are verified on
+// @Summary Update project scratch database
+// @Description Sets the database POST /compare?verify=true applies and reverts migrations on. Its content is overwritten.
+// @Tags projects
+// @Accept  json
+// @Produce  json
+// @Param   id       path  string                       true  "Project ID"
+// @Param   scratch  body  schemas.DBConnectionRequest  true  "Scratch database connection JSON"
+// @Success 200  {object}  schemas.ProjectResponse
+// @Failure 400  {object}  map[string]any
+// @Failure 404  {object}  map[string]any
+// @Router  /api/v1/projects/{id}/scratch [put]
+func UpdateScratchDatabase(c *gin.Context) {
+	projectID := c.Param("id")
+	var project models.Project
+	var input schemas.DBConnectionRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := repositories.Context.Preload("Source").Preload("Target").First(&project, projectID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+
+	scratch := mappers.DBConnectionToModel(input)
+	if err := repositories.Context.Create(&scratch).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save scratch database"})
+		return
+	}
+	project.ScratchID, project.Scratch = &scratch.ID, &scratch
+	if err := repositories.Context.Model(&project).Select("ScratchID").Updates(&project).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update scratch database"})
+		return
+	}
+
+	c.JSON(http.StatusOK, mappers.ProjectToResponse(project))
+}
+
+// UpdateRiskPolicy sets the riskiest change severity a project's comparisons accept
+// @Summary Update project risk policy
+// @Description Sets the risk level above which /compare fails with 422. An empty level disables the policy.
+// @Tags projects
+// @Accept  json
+// @Produce  json
+// @Param   id      path  string                     true  "Project ID"
+// @Param   policy  body  schemas.RiskPolicyRequest  true  "Risk policy JSON"
+// @Success 200  {object}  schemas.ProjectResponse
+// @Failure 400  {object}  map[string]any
+// @Failure 404  {object}  map[string]any
+// @Router  /api/v1/projects/{id}/policy [put]
+func UpdateRiskPolicy(c *gin.Context) {
+	projectID := c.Param("id")
+	var project models.Project
+	var input schemas.RiskPolicyRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := repositories.Context.Preload("Source").Preload("Target").First(&project, projectID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+
+	project.MaxRisk = input.MaxRisk
+	if err := repositories.Context.Model(&project).Select("MaxRisk").Updates(&project).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update risk policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, mappers.ProjectToResponse(project))
+}
+
+// UpdateFilters replaces the object filters of a project
+// @Summary Update project filters
+// @Description Replaces the include/exclude object filters applied when comparing the project's databases
+// @Tags projects
+// @Accept  json
+// @Produce  json
+// @Param   id       path  string               true  "Project ID"
+// @Param   filters  body  models.ObjectFilter  true  "Filters JSON"
+// @Success 200  {object}  schemas.ProjectResponse
+// @Failure 400  {object}  map[string]any
+// @Failure 404  {object}  map[string]any
+// @Router  /api/v1/projects/{id}/filters [put]
+func UpdateFilters(c *gin.Context) {
+	projectID := c.Param("id")
+	var project models.Project
+	var filter models.ObjectFilter
+
+	if err := c.ShouldBindJSON(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := filter.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := repositories.Context.Preload("Source").Preload("Target").First(&project, projectID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+
+	project.Filters = filter
+	if err := repositories.Context.Model(&project).Select("Filters").Updates(&project).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update filters"})
+		return
+	}
+
+	c.JSON(http.StatusOK, mappers.ProjectToResponse(project))
+}
+
+// schemaSourceFromQuery selects the live database of the given side unless a
+// "<side>_snapshot" query parameter names a snapshot to use instead
+func schemaSourceFromQuery(c *gin.Context, side string) (schemas.SchemaSourceRequest, error) {
+	request := schemas.SchemaSourceRequest{Side: side}
+	value := c.Query(side + "_snapshot")
+	if value == "" {
+		return request, nil
+	}
+
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return request, fmt.Errorf("invalid %s_snapshot: %s", side, value)
+	}
+	snapshotID := uint(id)
+	request.SnapshotID = &snapshotID
+	return request, nil
+}
+
+// filterFromQuery builds the per-request filter overrides from query parameters
+func filterFromQuery(c *gin.Context) models.ObjectFilter {
+	list := func(key string) []string {
+		var patterns []string
+		for _, value := range c.QueryArray(key) {
+			for _, pattern := range strings.Split(value, ",") {
+				if pattern = strings.TrimSpace(pattern); pattern != "" {
+					patterns = append(patterns, pattern)
+				}
+			}
+		}
+		return patterns
+	}
+	// Toggles left out of the query keep the project's setting
+	flag := func(key string) *bool {
+		value, err := strconv.ParseBool(c.Query(key))
+		if err != nil {
+			return nil
+		}
+		return &value
+	}
+
+	return models.ObjectFilter{
+		IncludeSchemas:   list("include_schemas"),
+		ExcludeSchemas:   list("exclude_schemas"),
+		IncludeTables:    list("include_tables"),
+		ExcludeTables:    list("exclude_tables"),
+		IncludeColumns:   list("include_columns"),
+		ExcludeColumns:   list("exclude_columns"),
+		IncludeSequences: list("include_sequences"),
+		ExcludeSequences: list("exclude_sequences"),
+		SkipIndexes:      flag("skip_indexes"),
+		SkipForeignKeys:  flag("skip_foreign_keys"),
+		SkipSequences:    flag("skip_sequences"),
+	}
+}
+
 // Dump generates and downloads the database backup for a specific project.
 // @Summary Download the database backup (SQL dump) for a project
 // @Description Generates a full SQL dump of the project's target database and sends it as a downloadable file.
 // @Tags projects
 // @Accept  json
 // @Produce  plain
-// @Param   id   path      string  true  "Project ID"
+// @Param   id     path   string  true   "Project ID"
+// @Param   async  query  bool    false  "Run in the background and answer 202 with the job"
 // @Success 200  {file}  file
+// @Success 202  {object}  schemas.JobResponse
 // @Failure 400  {object}  map[string]any
 // @Failure 404  {object}  map[string]any
 // @Failure 500  {object}  map[string]any
@@ -150,19 +465,24 @@ func Dump(c *gin.Context) {
 	projectID := c.Param("id")
 	var project models.Project
 
-	if err := repositories.Context.Preload("Source").Preload("Target").First(&project, projectID).Error; err != nil {
+	if err := repositories.Context.Preload("Target").First(&project, projectID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
 		return
 	}
 
-	_, target, err := project.ConnectForProject()
+	connected := services.StartPhase(c.Request.Context(), services.PhaseConnecting)
+	target, err := project.Target.Connect()
+	connected()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to databases"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to target database"})
 		return
 	}
+	defer models.Close(target)
 
+	generated := services.StartPhase(c.Request.Context(), services.PhaseGenerating)
 	gen := ddl.NewDDL(project.GetDialect(target))
-	script, err := gen.DumpDatabaseSQL(project.Target, target)
+	script, err := gen.DumpDatabaseSQL(project.Target, target.WithContext(c.Request.Context()))
+	generated()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to dump database"})
 		return
@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/Tsarbomba69-com/mammoth.server/mappers"
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"github.com/Tsarbomba69-com/mammoth.server/repositories"
+	"github.com/Tsarbomba69-com/mammoth.server/schemas"
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+	"gorm.io/gorm"
+)
+
+var errSnapshotNotFound = errors.New("snapshot not found")
+
+func validateSchemaSource(source schemas.SchemaSourceRequest) error {
+	if source.SnapshotID == nil && source.Connection == nil && source.Side != "source" && source.Side != "target" {
+		return errors.New("each schema source needs a snapshot_id, a connection or a side (source or target)")
+	}
+	return nil
+}
+
+// loadSchema reads the schema selected by the request, applying the filter.
+// Live databases are queried under the context.
+func loadSchema(ctx context.Context, project models.Project, source schemas.SchemaSourceRequest, filter models.ObjectFilter) ([]models.Schema, string, error) {
+	if source.SnapshotID != nil {
+		var snapshot models.Snapshot
+		err := repositories.Context.Where("project_id = ?", project.ID).First(&snapshot, *source.SnapshotID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", errSnapshotNotFound
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		return services.FilterSchemas(snapshot.Schemas, filter), snapshot.Dialect, nil
+	}
+
+	db, err := connectSchemaSource(ctx, project, source)
+	if err != nil {
+		return nil, "", err
+	}
+	defer models.Close(db)
+
+	dump, err := services.DumpSchema(db, filter)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return dump, project.GetDialect(db), nil
+}
+
+// connectSchemaSource opens the live database of the request, i.e. its explicit
+// connection or the project side, bound to the context. Snapshot requests
+// connect to their side.
+func connectSchemaSource(ctx context.Context, project models.Project, source schemas.SchemaSourceRequest) (*gorm.DB, error) {
+	var connection models.DBConnection
+	switch {
+	case source.Connection != nil:
+		connection = mappers.DBConnectionToModel(*source.Connection)
+	case source.Side == "source":
+		connection = project.Source
+	case source.Side == "target":
+		connection = project.Target
+	default:
+		return nil, validateSchemaSource(source)
+	}
+
+	connected := services.StartPhase(ctx, services.PhaseConnecting)
+	db, err := connection.Connect()
+	connected()
+	if err != nil {
+		return nil, err
+	}
+	return db.WithContext(ctx), nil
+}
+
+// schemaSourceStatus maps a loadSchema error to an HTTP status code
+func schemaSourceStatus(err error) int {
+	if errors.Is(err, errSnapshotNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
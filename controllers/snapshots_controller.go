@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Tsarbomba69-com/mammoth.server/mappers"
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"github.com/Tsarbomba69-com/mammoth.server/repositories"
+	"github.com/Tsarbomba69-com/mammoth.server/schemas"
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CreateSnapshot stores the current schema of one of the project's databases
+// @Summary Take a schema snapshot
+// @Description Introspects the project's source or target database and stores its schema under a label
+// @Tags snapshots
+// @Accept  json
+// @Produce  json
+// @Param   id        path  string                   true  "Project ID"
+// @Param   snapshot  body  schemas.SnapshotRequest  true  "Snapshot JSON"
+// @Success 201  {object}  schemas.SnapshotResponse
+// @Failure 400  {object}  map[string]any
+// @Failure 404  {object}  map[string]any
+// @Failure 500  {object}  map[string]any
+// @Router  /api/v1/projects/{id}/snapshots [post]
+func CreateSnapshot(c *gin.Context) {
+	projectID := c.Param("id")
+	var project models.Project
+	var input schemas.SnapshotRequest
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := repositories.Context.Preload("Source").Preload("Target").First(&project, projectID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+
+	connection := project.Source
+	if input.Side == "target" {
+		connection = project.Target
+	}
+
+	db, err := connection.Connect()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to database"})
+		return
+	}
+	defer models.Close(db)
+
+	// Snapshots are stored unfiltered so that later filter changes still apply
+	dump, err := services.DumpSchema(db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to dump schema"})
+		return
+	}
+
+	snapshot := models.Snapshot{
+		ProjectID:      project.ID,
+		DBConnectionID: connection.ID,
+		Side:           input.Side,
+		Label:          input.Label,
+		Dialect:        project.GetDialect(db),
+		Schemas:        dump,
+	}
+	if err := repositories.Context.Create(&snapshot).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store snapshot"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, mappers.SnapshotToResponse(snapshot))
+}
+
+// GetSnapshots retrieves a paginated list of a project's snapshots
+// @Summary List snapshots
+// @Description Retrieves a paginated list of the project's snapshots, newest first, without their schema content
+// @Tags snapshots
+// @Accept  json
+// @Produce  json
+// @Param   id     path   string  true   "Project ID"
+// @Param   side   query  string  false  "Filter by side (source or target)"
+// @Param   page   query  int     false  "Page number (default: 1)"
+// @Param   limit  query  int     false  "Number of items per page (default: 10, max: 100)"
+// @Success 200  {object}  schemas.PageResponse[schemas.SnapshotResponse]
+// @Failure 404  {object}  map[string]any
+// @Router  /api/v1/projects/{id}/snapshots [get]
+func GetSnapshots(c *gin.Context) {
+	projectID := c.Param("id")
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+
+	var project models.Project
+	if err := repositories.Context.First(&project, projectID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+
+	query := func() *gorm.DB {
+		q := repositories.Context.Model(&models.Snapshot{}).Where("project_id = ?", project.ID)
+		if side := c.Query("side"); side != "" {
+			q = q.Where("side = ?", side)
+		}
+		return q
+	}
+
+	var snapshots []models.Snapshot
+	var total int64
+	offset := (page - 1) * limit
+	query().Count(&total)
+	query().Omit("Schemas").Order("created_at DESC").Limit(limit).Offset(offset).Find(&snapshots)
+
+	var entries = []schemas.SnapshotResponse{}
+	for _, snapshot := range snapshots {
+		entries = append(entries, mappers.SnapshotToResponse(snapshot))
+	}
+
+	c.JSON(http.StatusOK, schemas.PageResponse[schemas.SnapshotResponse]{
+		Total:   uint(total),
+		Page:    uint(page),
+		Limit:   uint(limit),
+		Entries: entries,
+	})
+}
+
+// GetSnapshot retrieves a single snapshot with its schema content
+// @Summary Get a snapshot
+// @Description Retrieves a snapshot of the project including the stored schemas
+// @Tags snapshots
+// @Accept  json
+// @Produce  json
+// @Param   id   path  string  true  "Project ID"
+// @Param   sid  path  string  true  "Snapshot ID"
+// @Success 200  {object}  schemas.SnapshotResponse
+// @Failure 404  {object}  map[string]any
+// @Router  /api/v1/projects/{id}/snapshots/{sid} [get]
+func GetSnapshot(c *gin.Context) {
+	var snapshot models.Snapshot
+
+	if err := repositories.Context.Where("project_id = ?", c.Param("id")).First(&snapshot, c.Param("sid")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Snapshot not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, mappers.SnapshotToResponse(snapshot))
+}
+
+// DeleteSnapshot removes a snapshot
+// @Summary Delete a snapshot
+// @Description Deletes a snapshot of the project
+// @Tags snapshots
+// @Param   id   path  string  true  "Project ID"
+// @Param   sid  path  string  true  "Snapshot ID"
+// @Success 204
+// @Failure 404  {object}  map[string]any
+// @Router  /api/v1/projects/{id}/snapshots/{sid} [delete]
+func DeleteSnapshot(c *gin.Context) {
+	var snapshot models.Snapshot
+
+	if err := repositories.Context.Where("project_id = ?", c.Param("id")).First(&snapshot, c.Param("sid")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Snapshot not found"})
+		return
+	}
+
+	if err := repositories.Context.Delete(&snapshot).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete snapshot"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
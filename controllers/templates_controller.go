@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/Tsarbomba69-com/mammoth.server/ddl"
+	"github.com/Tsarbomba69-com/mammoth.server/mappers"
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"github.com/Tsarbomba69-com/mammoth.server/repositories"
+	"github.com/gin-gonic/gin"
+)
+
+// UpdateTemplates replaces the DDL templates of a project
+// @Summary Update project DDL templates
+// @Description Replaces the project's text/template overrides, keyed by DDL method (CreateTableSQL, AddColumnSQL, CreateIndexSQL...). Templates see the method's arguments and the built-in SQL as .Default; methods without a template keep the built-in SQL. Unknown methods and templates that fail to parse or execute are rejected.
+// @Tags projects
+// @Accept  json
+// @Produce  json
+// @Param   id         path  string               true  "Project ID"
+// @Param   templates  body  models.DDLTemplates  true  "DDL method names mapped to template sources"
+// @Success 200  {object}  schemas.ProjectResponse
+// @Failure 400  {object}  map[string]any
+// @Failure 404  {object}  map[string]any
+// @Router  /api/v1/projects/{id}/templates [put]
+func UpdateTemplates(c *gin.Context) {
+	projectID := c.Param("id")
+	var project models.Project
+	var templates models.DDLTemplates
+
+	if err := c.ShouldBindJSON(&templates); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := ddl.ParseTemplates(templates); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := repositories.Context.Preload("Source").Preload("Target").First(&project, projectID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+
+	project.Templates = templates
+	if err := repositories.Context.Model(&project).Select("Templates").Updates(&project).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update templates"})
+		return
+	}
+
+	c.JSON(http.StatusOK, mappers.ProjectToResponse(project))
+}
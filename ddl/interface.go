@@ -10,6 +10,8 @@ type DDL interface {
 	CreateTableSQL(tableDiff models.TableDiff) string
 	AlterTableSQL(tableDiff models.TableDiff) string
 	RevertAlterTableSQL(tableDiff models.TableDiff) string
+	AddColumnSQL(schemaName, tableName string, col models.Column) string
+	DropColumnSQL(schemaName, tableName string, col models.Column) string
 	CreateIndexSQL(schemaName, tableName string, idx models.Index) string
 	DropIndexSQL(schemaName, tableName string, idx models.Index) string
 	AddForeignKeySQL(schemaName, tableName string, fk models.ForeignKey) string
@@ -21,14 +23,43 @@ type DDL interface {
 	CreateSequenceSQL(seq models.Sequence) string
 	AlterSequenceSQL(seqChange models.SequenceChange) string
 	RevertAlterSequenceSQL(seqChange models.SequenceChange) string
+	CreateDependentSQL(dep models.Dependent) string
+	DropDependentSQL(dep models.Dependent) string
+	OnlineAlterColumnSQL(tableDiff models.TableDiff, change models.ColumnChange) PhasedSQL
+	OnlineAddForeignKeySQL(schemaName, tableName string, fk models.ForeignKey) PhasedSQL
 }
 
-func NewDDL(dialect string) DDL {
+// PhasedSQL splits a change into expand, migrate and contract phases so that
+// it can be applied to a table in use without long locks. Expand only adds,
+// migrate moves data while old and new shapes coexist and contract removes
+// the old shape.
+type PhasedSQL struct {
+	Expand   string
+	Indexes  []models.Index // Built during expand after the other statements, each on its own so that it can be built concurrently
+	Migrate  string
+	Contract string
+}
+
+// Options tunes the generated statements
+type Options struct {
+	Concurrently bool      // Build and drop indexes of existing tables without blocking writes
+	Idempotent   bool      // Skip objects already created or dropped so that scripts can be run again
+	Templates    Templates // Project overrides of the built-in rendering
+}
+
+// NewDDL returns the statement generator of a dialect, configured by the
+// first options given
+func NewDDL(dialect string, options ...Options) DDL {
+	var opts Options
+	if len(options) > 0 {
+		opts = options[0]
+	}
+
 	switch dialect {
 	// case "mysql":
 	//     return MySQLDDL{}
 	case "postgres":
-		return PostgreSQLDDL{}
+		return PostgreSQLDDL{Options: opts}
 	// case "sqlite":
 	//     return SQLiteDDL{}
 	// case "sqlserver":
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"slices"
 	"strings"
 
 	"github.com/Tsarbomba69-com/mammoth.server/models"
@@ -13,19 +14,23 @@ import (
 )
 
 // postgresql_ddl.go
-type PostgreSQLDDL struct{} // Empty struct since we don't need state
+type PostgreSQLDDL struct {
+	Options
+}
 
 func (p PostgreSQLDDL) CreateSchemaSQL(schemaName string) string {
-	return fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s;\n", quoteIdentifier(schemaName))
+	sql := fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s;\n", quoteIdentifier(schemaName))
+	return p.render("CreateSchemaSQL", TemplateData{SchemaName: schemaName}, sql)
 }
 
 func (p PostgreSQLDDL) DropSchemaSQL(schema string) string {
-	return fmt.Sprintf("DROP SCHEMA IF EXISTS %s CASCADE;\n", quoteIdentifier(schema))
+	sql := fmt.Sprintf("DROP SCHEMA IF EXISTS %s CASCADE;\n", quoteIdentifier(schema))
+	return p.render("DropSchemaSQL", TemplateData{SchemaName: schema}, sql)
 }
 
 func (p PostgreSQLDDL) CreateTableSQL(tableDiff models.TableDiff) string {
 	var sql strings.Builder
-	sql.WriteString(fmt.Sprintf("CREATE TABLE %s.%s (\n", quoteIdentifier(tableDiff.SchemaName), quoteIdentifier(tableDiff.Name)))
+	sql.WriteString(fmt.Sprintf("CREATE TABLE %s%s.%s (\n", p.ifNotExists(), quoteIdentifier(tableDiff.SchemaName), quoteIdentifier(tableDiff.Name)))
 
 	// Add columns
 	for i, col := range append(tableDiff.ColumnsSame, tableDiff.ColumnsAdded...) {
@@ -54,55 +59,33 @@ func (p PostgreSQLDDL) CreateTableSQL(tableDiff models.TableDiff) string {
 
 	sql.WriteString("\n);\n")
 
-	// Add indexes
+	// Add indexes, a new table has no writes to keep going so they are never built concurrently
+	plain := p
+	plain.Concurrently = false
 	for _, idx := range append(tableDiff.IndexesSame, tableDiff.IndexesAdded...) {
 		if !idx.IsPrimary { // Primary key already handled
-			sql.WriteString(p.CreateIndexSQL(tableDiff.SchemaName, tableDiff.Name, idx))
+			sql.WriteString(plain.CreateIndexSQL(tableDiff.SchemaName, tableDiff.Name, idx))
 		}
 	}
 
-	return sql.String()
+	return p.render("CreateTableSQL", TemplateData{SchemaName: tableDiff.SchemaName, TableName: tableDiff.Name, Table: tableDiff}, sql.String())
 }
 
 func (p PostgreSQLDDL) AlterTableSQL(tableDiff models.TableDiff) string {
 	var sql strings.Builder
-	tableName := quoteIdentifier(tableDiff.Name)
-	schemaName := quoteIdentifier(tableDiff.SchemaName)
 
 	// Add columns
 	for _, col := range tableDiff.ColumnsAdded {
-		sql.WriteString(fmt.Sprintf("ALTER TABLE %s.%s ADD COLUMN %s %s",
-			schemaName, tableName, quoteIdentifier(col.Name), col.DataType))
-		if !col.IsNullable {
-			sql.WriteString(" NOT NULL")
-		}
-		if col.Default != "" {
-			sql.WriteString(fmt.Sprintf(" DEFAULT %s", col.Default))
-		}
-		// if col.IsAutoIncrement {
-		// 	sql.WriteString(" GENERATED BY DEFAULT AS IDENTITY")
-		// }
-		sql.WriteString(";\n")
+		sql.WriteString(p.AddColumnSQL(tableDiff.SchemaName, tableDiff.Name, col))
 	}
 
 	// Drop columns
 	for _, col := range tableDiff.ColumnsRemoved {
-		sql.WriteString(fmt.Sprintf("ALTER TABLE %s.%s DROP COLUMN %s;\n",
-			schemaName, tableName, quoteIdentifier(col.Name)))
+		sql.WriteString(p.DropColumnSQL(tableDiff.SchemaName, tableDiff.Name, col))
 	}
 
 	// Modify columns
-	for _, change := range tableDiff.ColumnsModified {
-		sql.WriteString(fmt.Sprintf("ALTER TABLE %s.%s MODIFY COLUMN %s %s",
-			schemaName, tableName, quoteIdentifier(change.Name), change.Target.DataType))
-		if !change.Target.IsNullable {
-			sql.WriteString(" NOT NULL")
-		}
-		if change.Target.Default != "" {
-			sql.WriteString(fmt.Sprintf(" DEFAULT %s", change.Target.Default))
-		}
-		sql.WriteString(";\n")
-	}
+	sql.WriteString(p.alterColumnsSQL(tableDiff.SchemaName, tableDiff.Name, tableDiff.ColumnsModified, false))
 
 	// Add indexes
 	for _, idx := range tableDiff.IndexesAdded {
@@ -120,51 +103,40 @@ func (p PostgreSQLDDL) AlterTableSQL(tableDiff models.TableDiff) string {
 		sql.WriteString(p.CreateIndexSQL(tableDiff.SchemaName, tableDiff.Name, change.Target))
 	}
 
+	// Drop foreign keys
+	for _, fk := range tableDiff.ForeignKeyRemoved {
+		sql.WriteString(p.DropForeignKeySQL(tableDiff.SchemaName, tableDiff.Name, fk.Name))
+	}
+
+	// Add foreign keys
+	for _, fk := range tableDiff.ForeignKeyAdded {
+		sql.WriteString(p.AddForeignKeySQL(tableDiff.SchemaName, tableDiff.Name, fk))
+	}
+
 	// Modify foreign key (drop and recreate)
 	for _, change := range tableDiff.ForeignKeyModified {
-		sql.WriteString(p.DropForeignKeySQL(schemaName, tableDiff.Name, change.Source.Name))
-		sql.WriteString(p.AddForeignKeySQL(schemaName, tableDiff.Name, change.Target))
+		sql.WriteString(p.DropForeignKeySQL(tableDiff.SchemaName, tableDiff.Name, change.Source.Name))
+		sql.WriteString(p.AddForeignKeySQL(tableDiff.SchemaName, tableDiff.Name, change.Target))
 	}
 
-	return sql.String()
+	return p.render("AlterTableSQL", TemplateData{SchemaName: tableDiff.SchemaName, TableName: tableDiff.Name, Table: tableDiff}, sql.String())
 }
 
 func (p PostgreSQLDDL) RevertAlterTableSQL(tableDiff models.TableDiff) string {
 	var sql strings.Builder
-	tableName := quoteIdentifier(tableDiff.Name)
-	schemaName := quoteIdentifier(tableDiff.SchemaName)
 
 	// Revert added columns (drop them)
 	for _, col := range tableDiff.ColumnsAdded {
-		sql.WriteString(fmt.Sprintf("ALTER TABLE %s.%s DROP COLUMN %s;\n",
-			schemaName, tableName, quoteIdentifier(col.Name)))
+		sql.WriteString(p.DropColumnSQL(tableDiff.SchemaName, tableDiff.Name, col))
 	}
 
 	// Revert removed columns (add them back)
 	for _, col := range tableDiff.ColumnsRemoved {
-		sql.WriteString(fmt.Sprintf("ALTER TABLE %s.%s ADD COLUMN %s %s",
-			schemaName, tableName, quoteIdentifier(col.Name), col.DataType))
-		if !col.IsNullable {
-			sql.WriteString(" NOT NULL")
-		}
-		if col.Default != "" {
-			sql.WriteString(fmt.Sprintf(" DEFAULT %s", col.Default))
-		}
-		sql.WriteString(";\n")
+		sql.WriteString(p.AddColumnSQL(tableDiff.SchemaName, tableDiff.Name, col))
 	}
 
 	// Revert column modifications
-	for _, change := range tableDiff.ColumnsModified {
-		sql.WriteString(fmt.Sprintf("ALTER TABLE %s.%s MODIFY COLUMN %s %s",
-			schemaName, tableName, quoteIdentifier(change.Name), change.Source.DataType))
-		if !change.Source.IsNullable {
-			sql.WriteString(" NOT NULL")
-		}
-		if change.Source.Default != "" {
-			sql.WriteString(fmt.Sprintf(" DEFAULT %s", change.Source.Default))
-		}
-		sql.WriteString(";\n")
-	}
+	sql.WriteString(p.alterColumnsSQL(tableDiff.SchemaName, tableDiff.Name, tableDiff.ColumnsModified, true))
 
 	// Revert added indexes (drop them)
 	for _, idx := range tableDiff.IndexesAdded {
@@ -182,50 +154,268 @@ func (p PostgreSQLDDL) RevertAlterTableSQL(tableDiff models.TableDiff) string {
 		sql.WriteString(p.CreateIndexSQL(tableDiff.SchemaName, tableDiff.Name, change.Source))
 	}
 
-	return sql.String()
+	// Revert added foreign keys (drop them)
+	for _, fk := range tableDiff.ForeignKeyAdded {
+		sql.WriteString(p.DropForeignKeySQL(tableDiff.SchemaName, tableDiff.Name, fk.Name))
+	}
+
+	// Revert removed foreign keys (add them back)
+	for _, fk := range tableDiff.ForeignKeyRemoved {
+		sql.WriteString(p.AddForeignKeySQL(tableDiff.SchemaName, tableDiff.Name, fk))
+	}
+
+	// Revert modified foreign keys
+	for _, change := range tableDiff.ForeignKeyModified {
+		sql.WriteString(p.DropForeignKeySQL(tableDiff.SchemaName, tableDiff.Name, change.Target.Name))
+		sql.WriteString(p.AddForeignKeySQL(tableDiff.SchemaName, tableDiff.Name, change.Source))
+	}
+
+	return p.render("RevertAlterTableSQL", TemplateData{SchemaName: tableDiff.SchemaName, TableName: tableDiff.Name, Table: tableDiff}, sql.String())
 }
 
+// CreateIndexSQL creates an index, or adds the primary key of an existing
+// table. Tables being created declare their primary key in CREATE TABLE.
 func (p PostgreSQLDDL) CreateIndexSQL(schemaName, tableName string, idx models.Index) string {
 	if idx.IsPrimary {
-		return "" // Already handled in CREATE TABLE
+		return p.render("CreateIndexSQL", TemplateData{SchemaName: schemaName, TableName: tableName, Name: idx.Name, Index: idx}, p.addPrimaryKey(schemaName, tableName, idx))
 	}
 
 	indexType := "INDEX"
 	if idx.IsUnique {
 		indexType = "UNIQUE INDEX"
 	}
+	if p.Concurrently {
+		indexType += " CONCURRENTLY"
+	}
+	if p.Idempotent {
+		indexType += " IF NOT EXISTS"
+	}
 
 	quotedColumns := make([]string, len(idx.Columns))
 	for i, col := range idx.Columns {
 		quotedColumns[i] = quoteIdentifier(col)
 	}
 
-	return fmt.Sprintf("CREATE %s %s ON %s.%s (%s);\n",
+	sql := fmt.Sprintf("CREATE %s %s ON %s.%s (%s);\n",
 		indexType,
 		quoteIdentifier(idx.Name),
 		quoteIdentifier(schemaName),
 		quoteIdentifier(tableName),
 		strings.Join(quotedColumns, ", "))
+	return p.render("CreateIndexSQL", TemplateData{SchemaName: schemaName, TableName: tableName, Name: idx.Name, Index: idx}, sql)
 }
 
 func (p PostgreSQLDDL) DropIndexSQL(schemaName, tableName string, idx models.Index) string {
-	if idx.IsPrimary {
-		return fmt.Sprintf("ALTER TABLE %s.%s DROP CONSTRAINT %s;\n",
+	var sql string
+	switch {
+	case idx.IsPrimary:
+		sql = fmt.Sprintf("ALTER TABLE %s.%s DROP CONSTRAINT %s%s;\n",
 			quoteIdentifier(schemaName),
 			quoteIdentifier(tableName),
+			p.ifExists(),
 			quoteIdentifier(idx.Name))
+	case p.Concurrently:
+		sql = fmt.Sprintf("DROP INDEX CONCURRENTLY %s%s.%s;\n", p.ifExists(), quoteIdentifier(schemaName), quoteIdentifier(idx.Name))
+	default:
+		sql = fmt.Sprintf("DROP INDEX %s%s.%s;\n", p.ifExists(), quoteIdentifier(schemaName), quoteIdentifier(idx.Name))
 	}
-	return fmt.Sprintf("DROP INDEX %s;\n", quoteIdentifier(idx.Name))
+	return p.render("DropIndexSQL", TemplateData{SchemaName: schemaName, TableName: tableName, Name: idx.Name, Index: idx}, sql)
+}
+
+// AddColumnSQL adds a column to an existing table
+func (p PostgreSQLDDL) AddColumnSQL(schemaName, tableName string, col models.Column) string {
+	var sql strings.Builder
+	sql.WriteString(fmt.Sprintf("ALTER TABLE %s.%s ADD COLUMN %s%s %s",
+		quoteIdentifier(schemaName), quoteIdentifier(tableName), p.ifNotExists(), quoteIdentifier(col.Name), col.DataType))
+	if !col.IsNullable {
+		sql.WriteString(" NOT NULL")
+	}
+	if col.Default != "" {
+		sql.WriteString(fmt.Sprintf(" DEFAULT %s", col.Default))
+	}
+	// if col.IsAutoIncrement {
+	// 	sql.WriteString(" GENERATED BY DEFAULT AS IDENTITY")
+	// }
+	sql.WriteString(";\n")
+	return p.render("AddColumnSQL", TemplateData{SchemaName: schemaName, TableName: tableName, Name: col.Name, Column: col}, sql.String())
+}
+
+// DropColumnSQL removes a column from an existing table
+func (p PostgreSQLDDL) DropColumnSQL(schemaName, tableName string, col models.Column) string {
+	sql := fmt.Sprintf("ALTER TABLE %s.%s DROP COLUMN %s%s;\n",
+		quoteIdentifier(schemaName), quoteIdentifier(tableName), p.ifExists(), quoteIdentifier(col.Name))
+	return p.render("DropColumnSQL", TemplateData{SchemaName: schemaName, TableName: tableName, Name: col.Name, Column: col}, sql)
 }
 
 func (p PostgreSQLDDL) DropTableSQL(schemaName, tableName string) string {
-	return fmt.Sprintf("DROP TABLE %s.%s;\n", quoteIdentifier(schemaName), quoteIdentifier(tableName))
+	sql := fmt.Sprintf("DROP TABLE %s%s.%s;\n", p.ifExists(), quoteIdentifier(schemaName), quoteIdentifier(tableName))
+	return p.render("DropTableSQL", TemplateData{SchemaName: schemaName, TableName: tableName}, sql)
+}
+
+// addPrimaryKey adds a primary key holding every column of the index. Keys
+// with Postgres' default name are added without naming them.
+func (p PostgreSQLDDL) addPrimaryKey(schemaName, tableName string, idx models.Index) string {
+	constraint := ""
+	if idx.Name != "" && idx.Name != tableName+"_pkey" {
+		constraint = "CONSTRAINT " + quoteIdentifier(idx.Name) + " "
+	} else {
+		idx.Name = tableName + "_pkey"
+	}
+	return p.guardConstraint(schemaName, tableName, idx.Name,
+		fmt.Sprintf("ALTER TABLE %s.%s ADD %sPRIMARY KEY (%s)", quoteIdentifier(schemaName), quoteIdentifier(tableName), constraint, joinIdentifiers(idx.Columns)))
+}
+
+// alterColumnsSQL changes columns from their source to their target shape, or
+// back when reverting. Only the attributes listed as changed are touched and
+// defaults are dropped around type changes they may not survive. Primary keys
+// are changed as a whole through their index, see CreateIndexSQL.
+func (p PostgreSQLDDL) alterColumnsSQL(schemaName, tableName string, changes []models.ColumnChange, revert bool) string {
+	var alters strings.Builder
+	table := fmt.Sprintf("%s.%s", quoteIdentifier(schemaName), quoteIdentifier(tableName))
+
+	for _, change := range changes {
+		from, to := change.Source, change.Target
+		if revert {
+			from, to = to, from
+		}
+		changed := func(attr string) bool { return slices.Contains(change.ChangedAttr, attr) }
+
+		var clauses []string
+		if changed("data_type") {
+			if from.Default != "" {
+				clauses = append(clauses, fmt.Sprintf("ALTER COLUMN %s DROP DEFAULT", quoteIdentifier(change.Name)))
+			}
+			clauses = append(clauses, alterTypeClause(change.Name, from.DataType, to.DataType))
+		}
+		if changed("default") || (changed("data_type") && from.Default != "") {
+			if to.Default != "" {
+				clauses = append(clauses, fmt.Sprintf("ALTER COLUMN %s SET DEFAULT %s", quoteIdentifier(change.Name), to.Default))
+			} else if changed("default") {
+				clauses = append(clauses, fmt.Sprintf("ALTER COLUMN %s DROP DEFAULT", quoteIdentifier(change.Name)))
+			}
+		}
+		if changed("is_nullable") {
+			if to.IsNullable {
+				clauses = append(clauses, fmt.Sprintf("ALTER COLUMN %s DROP NOT NULL", quoteIdentifier(change.Name)))
+			} else {
+				clauses = append(clauses, fmt.Sprintf("ALTER COLUMN %s SET NOT NULL", quoteIdentifier(change.Name)))
+			}
+		}
+		if len(clauses) > 0 {
+			alters.WriteString(fmt.Sprintf("ALTER TABLE %s %s;\n", table, strings.Join(clauses, ", ")))
+		}
+	}
+	return alters.String()
+}
+
+// alterTypeClause converts a column to another type, with a cast expression
+// when Postgres has no implicit or assignment cast between the two types
+func alterTypeClause(column, from, to string) string {
+	clause := fmt.Sprintf("ALTER COLUMN %s TYPE %s", quoteIdentifier(column), to)
+	if needsCast(from, to) {
+		clause += fmt.Sprintf(" USING %s::%s", quoteIdentifier(column), to)
+	}
+	return clause
+}
+
+// typeFamilies groups the built-in types converting among themselves without
+// an explicit cast
+var typeFamilies = map[string]string{
+	"smallint": "number", "integer": "number", "int": "number", "bigint": "number",
+	"int2": "number", "int4": "number", "int8": "number",
+	"smallserial": "number", "serial": "number", "bigserial": "number",
+	"numeric": "number", "decimal": "number", "real": "number", "double precision": "number",
+	"float4": "number", "float8": "number", "float": "number", "money": "number",
+	"text": "string", "varchar": "string", "character varying": "string", "char": "string",
+	"character": "string", "bpchar": "string", "citext": "string", "name": "string",
+	"boolean": "boolean", "bool": "boolean",
+	"date": "time", "timestamp": "time", "timestamp without time zone": "time",
+	"timestamp with time zone": "time", "timestamptz": "time",
+	"json": "json", "jsonb": "json",
+	"uuid":  "uuid",
+	"bytea": "bytea",
+}
+
+// needsCast reports whether converting between two types needs a USING cast.
+// Everything converts to strings, other types only within their family.
+func needsCast(from, to string) bool {
+	fromFamily, toFamily := typeFamilies[baseType(from)], typeFamilies[baseType(to)]
+	fromArray, toArray := strings.HasSuffix(strings.TrimSpace(from), "]"), strings.HasSuffix(strings.TrimSpace(to), "]")
+	if toFamily == "string" && !toArray {
+		return false
+	}
+	if fromArray != toArray {
+		return true
+	}
+	return fromFamily == "" || fromFamily != toFamily
+}
+
+// baseType strips the modifiers of a type name, e.g. varchar(20) is varchar
+func baseType(dataType string) string {
+	base := strings.ToLower(strings.TrimSpace(dataType))
+	if i := strings.IndexAny(base, "(["); i >= 0 {
+		base = strings.TrimSpace(base[:i])
+	}
+	return strings.Join(strings.Fields(base), " ")
 }
 
 func quoteIdentifier(name string) string {
 	return fmt.Sprintf("\"%s\"", name)
 }
 
+// sequenceOwner is the qualified owning column of a sequence, owning tables
+// without a schema being in the sequence's schema
+func sequenceOwner(seq models.Sequence) string {
+	schemaName, tableName := seq.SchemaName, seq.OwnedByTable
+	if schema, table, qualified := strings.Cut(seq.OwnedByTable, "."); qualified {
+		schemaName, tableName = schema, table
+	}
+	return fmt.Sprintf("%s.%s.%s", quoteIdentifier(schemaName), quoteIdentifier(tableName), quoteIdentifier(seq.OwnedByColumn))
+}
+
+func quoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+func (p PostgreSQLDDL) ifExists() string {
+	if p.Idempotent {
+		return "IF EXISTS "
+	}
+	return ""
+}
+
+func (p PostgreSQLDDL) ifNotExists() string {
+	if p.Idempotent {
+		return "IF NOT EXISTS "
+	}
+	return ""
+}
+
+// guardConstraint terminates a statement adding a constraint. Constraints have
+// no IF NOT EXISTS form, idempotent statements check the catalog first.
+func (p PostgreSQLDDL) guardConstraint(schemaName, tableName, constraint, statement string) string {
+	if !p.Idempotent {
+		return statement + ";\n"
+	}
+	return guarded(fmt.Sprintf("NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = %s AND conrelid = %s::regclass)",
+		quoteLiteral(constraint), quoteLiteral(quoteIdentifier(schemaName)+"."+quoteIdentifier(tableName))), statement+";\n")
+}
+
+// guarded runs statements in an anonymous block only when the condition holds
+func guarded(condition, statements string) string {
+	return fmt.Sprintf("DO $$\nBEGIN\n  IF %s THEN\n%s\n  END IF;\nEND\n$$;\n", condition, indented(statements, "    "))
+}
+
+// anonymousBlock runs statements in an anonymous block declaring variables
+func anonymousBlock(declarations []string, statements string) string {
+	return fmt.Sprintf("DO $$\nDECLARE\n%s;\nBEGIN\n%s\nEND\n$$;\n", indented(strings.Join(declarations, ";\n"), "  "), indented(statements, "  "))
+}
+
+// indented prefixes every line of statements, dropping the final line break
+func indented(statements, prefix string) string {
+	return prefix + strings.ReplaceAll(strings.TrimSuffix(statements, "\n"), "\n", "\n"+prefix)
+}
+
 func joinIdentifiers(cols []string) string {
 	var parts []string
 	for _, col := range cols {
@@ -235,10 +425,16 @@ func joinIdentifiers(cols []string) string {
 }
 
 func (p PostgreSQLDDL) AddForeignKeySQL(schemaName, table string, fk models.ForeignKey) string {
+	sql := p.guardConstraint(schemaName, table, fk.Name, addForeignKey(schemaName, table, fk))
+	return p.render("AddForeignKeySQL", TemplateData{SchemaName: schemaName, TableName: table, Name: fk.Name, ForeignKey: fk}, sql)
+}
+
+// addForeignKey is the ADD CONSTRAINT statement of a foreign key, without its terminator
+func addForeignKey(schemaName, table string, fk models.ForeignKey) string {
 	cols := joinIdentifiers(fk.Columns)
 	refCols := joinIdentifiers(fk.ReferencedColumns)
 
-	return fmt.Sprintf(`ALTER TABLE %s.%s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s.%s (%s) ON DELETE %s ON UPDATE %s;`,
+	return fmt.Sprintf("ALTER TABLE %s.%s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s.%s (%s) ON DELETE %s ON UPDATE %s",
 		quoteIdentifier(schemaName),
 		quoteIdentifier(table),
 		quoteIdentifier(fk.Name),
@@ -251,7 +447,8 @@ func (p PostgreSQLDDL) AddForeignKeySQL(schemaName, table string, fk models.Fore
 }
 
 func (p PostgreSQLDDL) DropForeignKeySQL(schemaName, table, constraint string) string {
-	return fmt.Sprintf("ALTER TABLE %s.%s DROP CONSTRAINT %s;\n", quoteIdentifier(schemaName), quoteIdentifier(table), quoteIdentifier(constraint))
+	sql := fmt.Sprintf("ALTER TABLE %s.%s DROP CONSTRAINT %s%s;\n", quoteIdentifier(schemaName), quoteIdentifier(table), p.ifExists(), quoteIdentifier(constraint))
+	return p.render("DropForeignKeySQL", TemplateData{SchemaName: schemaName, TableName: table, Name: constraint}, sql)
 }
 
 func (p PostgreSQLDDL) DumpDatabaseSQL(connection models.DBConnection, db *gorm.DB) (string, error) {
@@ -267,7 +464,7 @@ func (p PostgreSQLDDL) DumpDatabaseSQL(connection models.DBConnection, db *gorm.
 		return "", fmt.Errorf("failed to set PGPASSWORD: %v", err)
 	}
 
-	cmd := exec.Command("pg_dump",
+	cmd := exec.CommandContext(db.Statement.Context, "pg_dump",
 		"-h", connection.Host,
 		"-U", connection.User,
 		"-d", connection.DBName,
@@ -288,7 +485,8 @@ func (p PostgreSQLDDL) CreateSequenceSQL(seq models.Sequence) string {
 	var parts []string
 
 	// Basic sequence creation
-	parts = append(parts, fmt.Sprintf("CREATE SEQUENCE %s.%s",
+	parts = append(parts, fmt.Sprintf("CREATE SEQUENCE %s%s.%s",
+		p.ifNotExists(),
 		quoteIdentifier(seq.SchemaName),
 		quoteIdentifier(seq.Name)))
 
@@ -314,29 +512,31 @@ func (p PostgreSQLDDL) CreateSequenceSQL(seq models.Sequence) string {
 	if seq.OwnedByTable != "" && seq.OwnedByColumn != "" {
 		parts = append(parts,
 			fmt.Sprintf(
-				"ALTER SEQUENCE %s.%s OWNED BY %s.%s;\n",
+				"ALTER SEQUENCE %s.%s OWNED BY %s;\n",
 				quoteIdentifier(seq.SchemaName),
 				quoteIdentifier(seq.Name),
-				quoteIdentifier(seq.OwnedByTable),
-				quoteIdentifier(seq.OwnedByColumn),
+				sequenceOwner(seq),
 			))
 	}
 
-	return strings.Join(parts, " ")
+	return p.render("CreateSequenceSQL", TemplateData{SchemaName: seq.SchemaName, Name: seq.Name, Sequence: seq}, strings.Join(parts, " "))
 }
 
 func (p PostgreSQLDDL) DropSequenceSQL(schemaName string, name string) string {
-	return fmt.Sprintf("DROP SEQUENCE IF EXISTS %s.%s;\n", quoteIdentifier(schemaName), quoteIdentifier(name))
+	sql := fmt.Sprintf("DROP SEQUENCE IF EXISTS %s.%s;\n", quoteIdentifier(schemaName), quoteIdentifier(name))
+	return p.render("DropSequenceSQL", TemplateData{SchemaName: schemaName, Name: name}, sql)
 }
 
 // AlterSequenceSQL generates the SQL to alter a sequence based on the changes detected
 func (p PostgreSQLDDL) AlterSequenceSQL(seqChange models.SequenceChange) string {
-	return alterSequece(seqChange, seqChange.Target)
+	sql := alterSequece(seqChange, seqChange.Target)
+	return p.render("AlterSequenceSQL", TemplateData{SchemaName: seqChange.Target.SchemaName, Name: seqChange.Target.Name, Sequence: seqChange.Target, Change: seqChange}, sql)
 }
 
 // RevertAlterSequenceSQL generates the SQL to revert a sequence alteration
 func (p PostgreSQLDDL) RevertAlterSequenceSQL(seqChange models.SequenceChange) string {
-	return alterSequece(seqChange, seqChange.Source)
+	sql := alterSequece(seqChange, seqChange.Source)
+	return p.render("RevertAlterSequenceSQL", TemplateData{SchemaName: seqChange.Source.SchemaName, Name: seqChange.Source.Name, Sequence: seqChange.Source, Change: seqChange}, sql)
 }
 
 func alterSequece(seqChange models.SequenceChange, seq models.Sequence) string {
@@ -366,8 +566,7 @@ func alterSequece(seqChange models.SequenceChange, seq models.Sequence) string {
 		// 	clauses = append(clauses, fmt.Sprintf("CACHE %d", seq.Cache))
 		case "OwnedByTable", "OwnedByColumn":
 			if seq.OwnedByTable != "" && seq.OwnedByColumn != "" {
-				clauses = append(clauses, fmt.Sprintf("OWNED BY \"%s\".\"%s\"",
-					seq.OwnedByTable, seq.OwnedByColumn))
+				clauses = append(clauses, "OWNED BY "+sequenceOwner(seq))
 			} else {
 				clauses = append(clauses, "OWNED BY NONE")
 			}
@@ -381,3 +580,269 @@ func alterSequece(seqChange models.SequenceChange, seq models.Sequence) string {
 	return fmt.Sprintf("ALTER SEQUENCE \"%s\".\"%s\" %s;\n",
 		seq.SchemaName, seq.Name, strings.Join(clauses, " "))
 }
+
+// CreateDependentSQL recreates a view, materialized view or function from its
+// introspected definition
+func (p PostgreSQLDDL) CreateDependentSQL(dep models.Dependent) string {
+	definition := strings.TrimSuffix(strings.TrimSpace(dep.Definition), ";")
+	var sql string
+	switch dep.Type {
+	case "function":
+		sql = definition + ";\n"
+	case "materialized view":
+		sql = fmt.Sprintf("CREATE MATERIALIZED VIEW %s%s.%s AS\n%s;\n", p.ifNotExists(), quoteIdentifier(dep.SchemaName), quoteIdentifier(dep.Name), definition)
+	default:
+		create := "CREATE VIEW"
+		if p.Idempotent {
+			create = "CREATE OR REPLACE VIEW"
+		}
+		sql = fmt.Sprintf("%s %s.%s AS\n%s;\n", create, quoteIdentifier(dep.SchemaName), quoteIdentifier(dep.Name), definition)
+	}
+	return p.render("CreateDependentSQL", TemplateData{SchemaName: dep.SchemaName, Name: dep.Name, Dependent: dep}, sql)
+}
+
+func (p PostgreSQLDDL) DropDependentSQL(dep models.Dependent) string {
+	var sql string
+	switch dep.Type {
+	case "function":
+		sql = fmt.Sprintf("DROP FUNCTION IF EXISTS %s.%s(%s);\n", quoteIdentifier(dep.SchemaName), quoteIdentifier(dep.Name), dep.Arguments)
+	case "materialized view":
+		sql = fmt.Sprintf("DROP MATERIALIZED VIEW IF EXISTS %s.%s;\n", quoteIdentifier(dep.SchemaName), quoteIdentifier(dep.Name))
+	default:
+		sql = fmt.Sprintf("DROP VIEW IF EXISTS %s.%s;\n", quoteIdentifier(dep.SchemaName), quoteIdentifier(dep.Name))
+	}
+	return p.render("DropDependentSQL", TemplateData{SchemaName: dep.SchemaName, Name: dep.Name, Dependent: dep}, sql)
+}
+
+// OnlineAlterColumnSQL changes a column without holding long locks. Type
+// changes go through a shadow column kept in sync by a trigger, backfilled
+// and swapped in. The indexes and foreign keys of the column are rebuilt on
+// the shadow column beforehand, its check and unique constraints are carried
+// over by the swap. NOT NULL is enforced by a check constraint added NOT
+// VALID and validated, which lets SET NOT NULL skip its table scan.
+func (p PostgreSQLDDL) OnlineAlterColumnSQL(tableDiff models.TableDiff, change models.ColumnChange) PhasedSQL {
+	var expand, migrate, contract strings.Builder
+	schemaName, tableName := tableDiff.SchemaName, tableDiff.Name
+	table := fmt.Sprintf("%s.%s", quoteIdentifier(schemaName), quoteIdentifier(tableName))
+	column := change.Name
+	source, target := change.Source, change.Target
+	retyped := slices.Contains(change.ChangedAttr, "data_type")
+
+	// Primary keys cannot be swapped for a shadow column, they are converted in place
+	if retyped && (source.IsPrimary || target.IsPrimary) {
+		contract.WriteString(fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s;\n", table, alterTypeClause(column, source.DataType, target.DataType)))
+		retyped = false
+	}
+
+	if retyped {
+		shadow := shadowName(column)
+		sync := tableName + "_" + column + "_sync"
+		indexes, foreignKeys := columnDependents(tableDiff, column)
+		expand.WriteString(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s%s %s;\n", table, p.ifNotExists(), quoteIdentifier(shadow), target.DataType))
+		expand.WriteString(fmt.Sprintf("CREATE OR REPLACE FUNCTION %s.%s() RETURNS trigger LANGUAGE plpgsql AS $$\nBEGIN\n  NEW.%s := NEW.%s::%s;\n  RETURN NEW;\nEND\n$$;\n",
+			quoteIdentifier(schemaName), quoteIdentifier(sync), quoteIdentifier(shadow), quoteIdentifier(column), target.DataType))
+		if p.Idempotent {
+			expand.WriteString(fmt.Sprintf("DROP TRIGGER IF EXISTS %s ON %s;\n", quoteIdentifier(sync), table))
+		}
+		expand.WriteString(fmt.Sprintf("CREATE TRIGGER %s BEFORE INSERT OR UPDATE ON %s FOR EACH ROW EXECUTE FUNCTION %s.%s();\n",
+			quoteIdentifier(sync), table, quoteIdentifier(schemaName), quoteIdentifier(sync)))
+
+		var shadowIndexes []models.Index
+		for _, idx := range indexes {
+			shadowIndexes = append(shadowIndexes, models.Index{Name: shadowName(idx.Name), Columns: replaced(idx.Columns, column, shadow), IsUnique: idx.IsUnique})
+		}
+		for _, fk := range foreignKeys {
+			phased := p.OnlineAddForeignKeySQL(schemaName, tableName, models.ForeignKey{Name: shadowName(fk.Name), Columns: replaced(fk.Columns, column, shadow),
+				ReferencedTable: fk.ReferencedTable, ReferencedColumns: fk.ReferencedColumns, OnDelete: fk.OnDelete, OnUpdate: fk.OnUpdate})
+			expand.WriteString(phased.Expand)
+			migrate.WriteString(phased.Migrate)
+		}
+
+		contract.WriteString(fmt.Sprintf("DROP TRIGGER %s%s ON %s;\n", p.ifExists(), quoteIdentifier(sync), table))
+		contract.WriteString(fmt.Sprintf("DROP FUNCTION %s%s.%s();\n", p.ifExists(), quoteIdentifier(schemaName), quoteIdentifier(sync)))
+		contract.WriteString(p.swapColumn(schemaName, tableName, column, indexes, foreignKeys))
+		if target.Default != "" {
+			contract.WriteString(fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET DEFAULT %s;\n", table, quoteIdentifier(column), target.Default))
+		}
+		if !target.IsNullable {
+			p.onlineSetNotNull(&expand, &migrate, &contract, schemaName, tableName, column, shadow)
+		}
+		return PhasedSQL{
+			Expand:   expand.String(),
+			Indexes:  shadowIndexes,
+			Migrate:  backfill(tableDiff, column, target.DataType, migrate.String()),
+			Contract: contract.String(),
+		}
+	}
+
+	if slices.Contains(change.ChangedAttr, "default") {
+		if target.Default != "" {
+			expand.WriteString(fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET DEFAULT %s;\n", table, quoteIdentifier(column), target.Default))
+		} else {
+			expand.WriteString(fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s DROP DEFAULT;\n", table, quoteIdentifier(column)))
+		}
+	}
+
+	if slices.Contains(change.ChangedAttr, "is_nullable") {
+		if target.IsNullable {
+			expand.WriteString(fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s DROP NOT NULL;\n", table, quoteIdentifier(column)))
+		} else {
+			p.onlineSetNotNull(&expand, &migrate, &contract, schemaName, tableName, column, column)
+		}
+	}
+
+	return PhasedSQL{Expand: expand.String(), Migrate: migrate.String(), Contract: contract.String()}
+}
+
+// onlineSetNotNull makes a column NOT NULL through a validated check
+// constraint. The check is added on the column as it is named during the
+// expand phase, renames carry it over.
+func (p PostgreSQLDDL) onlineSetNotNull(expand, migrate, contract *strings.Builder, schemaName, tableName, column, expandColumn string) {
+	table := fmt.Sprintf("%s.%s", quoteIdentifier(schemaName), quoteIdentifier(tableName))
+	check := quoteIdentifier(tableName + "_" + column + "_not_null")
+	expand.WriteString(p.guardConstraint(schemaName, tableName, tableName+"_"+column+"_not_null",
+		fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s CHECK (%s IS NOT NULL) NOT VALID", table, check, quoteIdentifier(expandColumn))))
+	migrate.WriteString(fmt.Sprintf("ALTER TABLE %s VALIDATE CONSTRAINT %s;\n", table, check))
+	contract.WriteString(fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET NOT NULL;\n", table, quoteIdentifier(column)))
+	contract.WriteString(fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s%s;\n", table, p.ifExists(), check))
+}
+
+// backfillBatchSize is the number of rows a backfill updates per transaction
+const backfillBatchSize = 10000
+
+// backfill fills the shadow column of a column in primary key ranges,
+// committing after each range so that rows are not held locked until the end.
+// The validations run once the shadow column is filled. Tables without a
+// primary key have no range to batch on and are filled in one statement.
+func backfill(tableDiff models.TableDiff, column, dataType, validations string) string {
+	table := fmt.Sprintf("%s.%s", quoteIdentifier(tableDiff.SchemaName), quoteIdentifier(tableDiff.Name))
+	shadow := shadowName(column)
+	update := fmt.Sprintf("UPDATE %s SET %s = %s::%s WHERE %s IS NULL AND %s IS NOT NULL",
+		table, quoteIdentifier(shadow), quoteIdentifier(column), dataType, quoteIdentifier(shadow), quoteIdentifier(column))
+	key := backfillKey(tableDiff)
+	if len(key) == 0 {
+		return update + ";\n" + validations
+	}
+
+	keys := joinIdentifiers(key)
+	bound := func(record string) string {
+		fields := make([]string, len(key))
+		for i, col := range key {
+			fields[i] = record + "." + quoteIdentifier(col)
+		}
+		return strings.Join(fields, ", ")
+	}
+	var body strings.Builder
+	body.WriteString(fmt.Sprintf("SELECT %s INTO batch_start FROM %s ORDER BY %s LIMIT 1;\n", keys, table, keys))
+	body.WriteString("last_batch := NOT FOUND;\n")
+	body.WriteString("WHILE NOT last_batch LOOP\n")
+	body.WriteString(fmt.Sprintf("  SELECT %s INTO batch_end FROM %s WHERE (%s) >= (%s) ORDER BY %s OFFSET %d LIMIT 1;\n",
+		keys, table, keys, bound("batch_start"), keys, backfillBatchSize))
+	body.WriteString("  last_batch := NOT FOUND;\n")
+	body.WriteString(fmt.Sprintf("  %s AND (%s) >= (%s) AND (last_batch OR (%s) < (%s));\n", update, keys, bound("batch_start"), keys, bound("batch_end")))
+	body.WriteString("  COMMIT;\n")
+	body.WriteString("  batch_start := batch_end;\n")
+	body.WriteString("END LOOP;\n")
+	body.WriteString(validations)
+	return anonymousBlock([]string{"batch_start record", "batch_end record", "last_batch boolean"}, body.String())
+}
+
+// backfillKey returns the primary key columns the table keeps through the
+// migration, which order its rows whichever direction is applied
+func backfillKey(tableDiff models.TableDiff) []string {
+	for _, idx := range tableDiff.IndexesSame {
+		if idx.IsPrimary {
+			return idx.Columns
+		}
+	}
+	var key []string
+	for _, col := range tableDiff.ColumnsSame {
+		if col.IsPrimary {
+			key = append(key, col.Name)
+		}
+	}
+	for _, change := range tableDiff.ColumnsModified {
+		if change.Source.IsPrimary && change.Target.IsPrimary {
+			key = append(key, change.Name)
+		}
+	}
+	return key
+}
+
+// columnDependents returns the unchanged indexes and foreign keys of a table
+// covering a column. Primary keys are left out, their columns are never
+// swapped.
+func columnDependents(tableDiff models.TableDiff, column string) ([]models.Index, []models.ForeignKey) {
+	var indexes []models.Index
+	for _, idx := range tableDiff.IndexesSame {
+		if !idx.IsPrimary && slices.Contains(idx.Columns, column) {
+			indexes = append(indexes, idx)
+		}
+	}
+	var foreignKeys []models.ForeignKey
+	for _, fk := range tableDiff.ForeignKeysSame {
+		if slices.Contains(fk.Columns, column) {
+			foreignKeys = append(foreignKeys, fk)
+		}
+	}
+	return indexes, foreignKeys
+}
+
+// swapColumn drops a column and renames its shadow column in its place. The
+// check and unique constraints of the column are read from the catalog and
+// re-added once it is swapped, the indexes and foreign keys rebuilt on the
+// shadow column take the names of those dropped with the column.
+func (p PostgreSQLDDL) swapColumn(schemaName, tableName, column string, indexes []models.Index, foreignKeys []models.ForeignKey) string {
+	table := fmt.Sprintf("%s.%s", quoteIdentifier(schemaName), quoteIdentifier(tableName))
+	shadow := shadowName(column)
+
+	var swap strings.Builder
+	swap.WriteString(fmt.Sprintf("SELECT coalesce(array_agg(CASE contype WHEN 'u' THEN format(%s, conname, conname) ELSE format(%s, conname, pg_get_constraintdef(oid)) END), '{}') INTO restored\n",
+		quoteLiteral("ALTER TABLE "+table+" ADD CONSTRAINT %I UNIQUE USING INDEX %I"), quoteLiteral("ALTER TABLE "+table+" ADD CONSTRAINT %I %s")))
+	swap.WriteString("  FROM pg_constraint\n")
+	swap.WriteString(fmt.Sprintf("  WHERE conrelid = %s::regclass AND contype IN ('c', 'u') AND (SELECT attnum FROM pg_attribute WHERE attrelid = conrelid AND attname = %s) = ANY (conkey);\n",
+		quoteLiteral(table), quoteLiteral(column)))
+	swap.WriteString(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;\n", table, quoteIdentifier(column)))
+	swap.WriteString(fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s;\n", table, quoteIdentifier(shadow), quoteIdentifier(column)))
+	for _, idx := range indexes {
+		swap.WriteString(fmt.Sprintf("ALTER INDEX %s.%s RENAME TO %s;\n", quoteIdentifier(schemaName), quoteIdentifier(shadowName(idx.Name)), quoteIdentifier(idx.Name)))
+	}
+	for _, fk := range foreignKeys {
+		swap.WriteString(fmt.Sprintf("ALTER TABLE %s RENAME CONSTRAINT %s TO %s;\n", table, quoteIdentifier(shadowName(fk.Name)), quoteIdentifier(fk.Name)))
+	}
+	swap.WriteString("FOREACH restore IN ARRAY restored LOOP\n  EXECUTE restore;\nEND LOOP;\n")
+
+	statements := swap.String()
+	if p.Idempotent {
+		// Once swapped the shadow column is gone, dropping the column again would lose it
+		statements = fmt.Sprintf("IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = %s AND table_name = %s AND column_name = %s) THEN\n%s\nEND IF;\n",
+			quoteLiteral(schemaName), quoteLiteral(tableName), quoteLiteral(shadow), indented(statements, "  "))
+	}
+	return anonymousBlock([]string{"restored text[]", "restore text"}, statements)
+}
+
+// shadowName names the copy of a column, index or constraint built ahead of a swap
+func shadowName(name string) string {
+	return name + "__new"
+}
+
+// replaced returns the columns with one of them renamed
+func replaced(columns []string, column, name string) []string {
+	result := slices.Clone(columns)
+	for i, col := range result {
+		if col == column {
+			result[i] = name
+		}
+	}
+	return result
+}
+
+// OnlineAddForeignKeySQL adds a foreign key without checking existing rows
+// under lock, they are validated afterwards
+func (p PostgreSQLDDL) OnlineAddForeignKeySQL(schemaName, tableName string, fk models.ForeignKey) PhasedSQL {
+	return PhasedSQL{
+		Expand: p.guardConstraint(schemaName, tableName, fk.Name, addForeignKey(schemaName, tableName, fk)+" NOT VALID"),
+		Migrate: fmt.Sprintf("ALTER TABLE %s.%s VALIDATE CONSTRAINT %s;\n",
+			quoteIdentifier(schemaName), quoteIdentifier(tableName), quoteIdentifier(fk.Name)),
+	}
+}
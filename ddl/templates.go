@@ -0,0 +1,117 @@
+package ddl
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+)
+
+// Templates overrides the output of DDL methods, keyed by method name. A
+// method without a template keeps its built-in rendering.
+type Templates map[string]*template.Template
+
+// TemplateData is what a template is executed against. Only the fields of
+// the overridden method are set, Default always holds the built-in output.
+type TemplateData struct {
+	SchemaName string
+	TableName  string
+	Name       string
+	Table      models.TableDiff
+	Column     models.Column
+	Index      models.Index
+	ForeignKey models.ForeignKey
+	Sequence   models.Sequence
+	Change     models.SequenceChange
+	Dependent  models.Dependent
+	Default    string
+}
+
+// TemplateMethods lists the methods whose output can be overridden
+var TemplateMethods = []string{
+	"CreateSchemaSQL",
+	"DropSchemaSQL",
+	"CreateTableSQL",
+	"AlterTableSQL",
+	"RevertAlterTableSQL",
+	"AddColumnSQL",
+	"DropColumnSQL",
+	"CreateIndexSQL",
+	"DropIndexSQL",
+	"AddForeignKeySQL",
+	"DropForeignKeySQL",
+	"DropTableSQL",
+	"CreateSequenceSQL",
+	"DropSequenceSQL",
+	"AlterSequenceSQL",
+	"RevertAlterSequenceSQL",
+	"CreateDependentSQL",
+	"DropDependentSQL",
+}
+
+var templateFuncs = template.FuncMap{
+	"quote":   quoteIdentifier,
+	"join":    strings.Join,
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"trim":    strings.TrimSpace,
+	"replace": strings.ReplaceAll,
+}
+
+// sampleTemplateData exercises every field so that templates referring to
+// missing fields or misusing functions are caught before they are stored
+var sampleTemplateData = TemplateData{
+	SchemaName: "public",
+	TableName:  "sample",
+	Name:       "sample_fkey",
+	Table: models.TableDiff{
+		SchemaName:   "public",
+		Name:         "sample",
+		ColumnsAdded: []models.Column{{Name: "id", DataType: "integer", IsPrimary: true}},
+	},
+	Column:     models.Column{Name: "id", DataType: "integer", IsPrimary: true},
+	Index:      models.Index{Name: "sample_id_idx", Columns: []string{"id"}},
+	ForeignKey: models.ForeignKey{Name: "sample_fkey", Columns: []string{"other_id"}, ReferencedTable: "other", ReferencedColumns: []string{"id"}, OnDelete: "NO ACTION", OnUpdate: "NO ACTION"},
+	Sequence:   models.Sequence{SchemaName: "public", Name: "sample_id_seq", Increment: 1, StartValue: 1, MinValue: 1},
+	Change:     models.SequenceChange{Name: "sample_id_seq", ChangedAttr: []string{"increment"}},
+	Dependent:  models.Dependent{SchemaName: "public", Name: "sample_view", Type: "view", Definition: "SELECT 1"},
+	Default:    "SELECT 1;\n",
+}
+
+// ParseTemplates compiles the templates of a project. Unknown method names,
+// syntax errors and templates that fail on sample data are rejected.
+func ParseTemplates(sources map[string]string) (Templates, error) {
+	templates := make(Templates, len(sources))
+	for method, source := range sources {
+		if !slices.Contains(TemplateMethods, method) {
+			return nil, fmt.Errorf("unknown template %q", method)
+		}
+		tmpl, err := template.New(method).Funcs(templateFuncs).Option("missingkey=error").Parse(source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template %q: %v", method, err)
+		}
+		if err := tmpl.Execute(&bytes.Buffer{}, sampleTemplateData); err != nil {
+			return nil, fmt.Errorf("invalid template %q: %v", method, err)
+		}
+		templates[method] = tmpl
+	}
+	return templates, nil
+}
+
+// render returns the output of the method's template, or the built-in SQL
+// when there is none or it fails on this data
+func (p PostgreSQLDDL) render(method string, data TemplateData, sql string) string {
+	tmpl, ok := p.Templates[method]
+	if !ok {
+		return sql
+	}
+	data.Default = sql
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return sql
+	}
+	return out.String()
+}
@@ -0,0 +1,90 @@
+package exporters
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+)
+
+// File is a migration file named the way its migration runner expects
+type File struct {
+	Name    string
+	Content []byte
+}
+
+// Exporter lays a migration plan out as the versioned files of a migration runner
+type Exporter interface {
+	Export(version, name string, plan services.MigrationPlan) ([]File, error)
+}
+
+// Formats lists the supported export formats
+var Formats = []string{"golang-migrate", "flyway", "goose", "liquibase-yaml", "liquibase-xml"}
+
+// NewExporter returns the exporter of a format, see Formats
+func NewExporter(format string) (Exporter, error) {
+	switch strings.ToLower(format) {
+	case "golang-migrate", "migrate":
+		return MigrateExporter{}, nil
+	case "flyway":
+		return FlywayExporter{}, nil
+	case "goose":
+		return GooseExporter{}, nil
+	case "liquibase-yaml", "liquibase":
+		return LiquibaseExporter{Format: "yaml"}, nil
+	case "liquibase-xml":
+		return LiquibaseExporter{Format: "xml"}, nil
+	default:
+		return nil, fmt.Errorf("unsupported export format: %s", format)
+	}
+}
+
+// WriteZip archives the files
+func WriteZip(w io.Writer, files []File) error {
+	archive := zip.NewWriter(w)
+	for _, file := range files {
+		entry, err := archive.Create(file.Name)
+		if err != nil {
+			return err
+		}
+		if _, err := entry.Write(file.Content); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// statements returns the script of a plan without transaction blocks, for
+// runners wrapping each migration in a transaction of their own
+func statements(plan services.MigrationPlan) services.MigrationScript {
+	plan.Transactions = false
+	return plan.Script()
+}
+
+// transactional reports whether all the steps can run inside the transaction
+// a runner wraps the migration in
+func transactional(steps ...[]services.MigrationStep) bool {
+	for _, direction := range steps {
+		for _, step := range direction {
+			if !step.Transactional {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+var unsafeNameChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// SafeName turns a migration description into a file name part, e.g.
+// "Add users.email" is "add_users_email"
+func SafeName(name string) string {
+	safe := strings.Trim(unsafeNameChars.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if safe == "" {
+		return "migration"
+	}
+	return safe
+}
@@ -0,0 +1,28 @@
+package exporters
+
+import (
+	"fmt"
+
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+)
+
+// FlywayExporter writes a Flyway versioned migration V<version>__name.sql and
+// its undo migration U<version>__name.sql. Scripts holding statements that
+// cannot run in a transaction get a .conf file turning Flyway's transaction off.
+type FlywayExporter struct{}
+
+func (FlywayExporter) Export(version, name string, plan services.MigrationPlan) ([]File, error) {
+	script := statements(plan)
+	var files []File
+	for _, migration := range []struct {
+		prefix, sql string
+		steps       []services.MigrationStep
+	}{{"V", script.Up, plan.Up}, {"U", script.Down, plan.Down}} {
+		file := fmt.Sprintf("%s%s__%s.sql", migration.prefix, version, SafeName(name))
+		files = append(files, File{Name: file, Content: []byte(migration.sql)})
+		if !transactional(migration.steps) {
+			files = append(files, File{Name: file + ".conf", Content: []byte("executeInTransaction=false\n")})
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,31 @@
+package exporters
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+)
+
+// GooseExporter writes a goose SQL migration, <version>_name.sql, holding both
+// directions. Each statement gets a statement block of its own so that goose
+// runs them one by one without splitting function bodies on their semicolons.
+type GooseExporter struct{}
+
+func (GooseExporter) Export(version, name string, plan services.MigrationPlan) ([]File, error) {
+	script := statements(plan)
+	var sql strings.Builder
+	if !transactional(plan.Up, plan.Down) {
+		sql.WriteString("-- +goose NO TRANSACTION\n")
+	}
+	for _, direction := range []struct{ annotation, sql string }{{"Up", script.Up}, {"Down", script.Down}} {
+		sql.WriteString("-- +goose " + direction.annotation + "\n")
+		for _, statement := range services.SplitStatements(direction.sql) {
+			sql.WriteString("-- +goose StatementBegin\n")
+			sql.WriteString(statement + "\n")
+			sql.WriteString("-- +goose StatementEnd\n")
+		}
+	}
+
+	return []File{{Name: fmt.Sprintf("%s_%s.sql", version, SafeName(name)), Content: []byte(sql.String())}}, nil
+}
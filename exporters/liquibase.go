@@ -0,0 +1,103 @@
+package exporters
+
+import (
+	"encoding/xml"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+)
+
+// LiquibaseExporter writes a Liquibase changelog, in YAML or XML, with one
+// changeset running the up script and rolling back with the down script
+type LiquibaseExporter struct {
+	Format string // yaml or xml
+}
+
+const liquibaseAuthor = "mammoth"
+
+func (e LiquibaseExporter) Export(version, name string, plan services.MigrationPlan) ([]File, error) {
+	id := fmt.Sprintf("%s_%s", version, SafeName(name))
+	script := statements(plan)
+	inTransaction := transactional(plan.Up, plan.Down)
+
+	var content []byte
+	var err error
+	switch e.Format {
+	case "xml":
+		content, err = liquibaseXML(id, inTransaction, script)
+	default:
+		content, err = liquibaseYAML(id, inTransaction, script)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return []File{{Name: fmt.Sprintf("db.changelog-%s.%s", id, e.Format), Content: content}}, nil
+}
+
+type liquibaseSQL struct {
+	SplitStatements bool   `yaml:"splitStatements"`
+	SQL             string `yaml:"sql"`
+}
+
+func liquibaseYAML(id string, inTransaction bool, script services.MigrationScript) ([]byte, error) {
+	changeSet := map[string]any{
+		"id":               id,
+		"author":           liquibaseAuthor,
+		"runInTransaction": inTransaction,
+		"changes":          []map[string]liquibaseSQL{{"sql": {SQL: script.Up}}},
+	}
+	if script.Down != "" {
+		changeSet["rollback"] = []map[string]liquibaseSQL{{"sql": {SQL: script.Down}}}
+	}
+
+	return yaml.Marshal(map[string]any{
+		"databaseChangeLog": []map[string]any{{"changeSet": changeSet}},
+	})
+}
+
+type xmlChangeLog struct {
+	XMLName        xml.Name     `xml:"databaseChangeLog"`
+	Namespace      string       `xml:"xmlns,attr"`
+	XSI            string       `xml:"xmlns:xsi,attr"`
+	SchemaLocation string       `xml:"xsi:schemaLocation,attr"`
+	ChangeSets     []xmlChanges `xml:"changeSet"`
+}
+
+type xmlChanges struct {
+	ID               string  `xml:"id,attr"`
+	Author           string  `xml:"author,attr"`
+	RunInTransaction bool    `xml:"runInTransaction,attr"`
+	SQL              xmlSQL  `xml:"sql"`
+	Rollback         *xmlSQL `xml:"rollback>sql,omitempty"`
+}
+
+type xmlSQL struct {
+	SplitStatements bool   `xml:"splitStatements,attr"`
+	SQL             string `xml:",cdata"`
+}
+
+func liquibaseXML(id string, inTransaction bool, script services.MigrationScript) ([]byte, error) {
+	changeSet := xmlChanges{
+		ID:               id,
+		Author:           liquibaseAuthor,
+		RunInTransaction: inTransaction,
+		SQL:              xmlSQL{SQL: script.Up},
+	}
+	if script.Down != "" {
+		changeSet.Rollback = &xmlSQL{SQL: script.Down}
+	}
+
+	content, err := xml.MarshalIndent(xmlChangeLog{
+		Namespace:      "http://www.liquibase.org/xml/ns/dbchangelog",
+		XSI:            "http://www.w3.org/2001/XMLSchema-instance",
+		SchemaLocation: "http://www.liquibase.org/xml/ns/dbchangelog http://www.liquibase.org/xml/ns/dbchangelog/dbchangelog-latest.xsd",
+		ChangeSets:     []xmlChanges{changeSet},
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(content, '\n')...), nil
+}
@@ -0,0 +1,21 @@
+package exporters
+
+import (
+	"fmt"
+
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+)
+
+// MigrateExporter writes golang-migrate files, NNN_name.up.sql and NNN_name.down.sql.
+// golang-migrate does not open transactions, the files keep the transaction
+// blocks of plans made with transactions.
+type MigrateExporter struct{}
+
+func (MigrateExporter) Export(version, name string, plan services.MigrationPlan) ([]File, error) {
+	script := plan.Script()
+	base := fmt.Sprintf("%s_%s", version, SafeName(name))
+	return []File{
+		{Name: base + ".up.sql", Content: []byte(script.Up)},
+		{Name: base + ".down.sql", Content: []byte(script.Down)},
+	}, nil
+}
@@ -3,11 +3,13 @@ package main
 import (
 	"log"
 	"os"
+	"strconv"
 
 	_ "github.com/Tsarbomba69-com/mammoth.server/docs"
 	"github.com/Tsarbomba69-com/mammoth.server/models"
 	"github.com/Tsarbomba69-com/mammoth.server/repositories"
 	"github.com/Tsarbomba69-com/mammoth.server/routes"
+	"github.com/Tsarbomba69-com/mammoth.server/services"
 	"github.com/joho/godotenv"
 	files "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
@@ -39,10 +41,36 @@ func main() {
 	if err := repositories.Context.AutoMigrate(
 		&models.DBConnection{},
 		&models.Project{},
+		&models.Snapshot{},
+		&models.DriftEvent{},
+		&models.Migration{},
+		&models.Job{},
 	); err != nil {
 		log.Fatal("Failed to migrate database: ", err)
 	}
 
+	// Start scheduled drift detection
+	services.Scheduler = services.NewDriftScheduler(repositories.Context, nil)
+	if err := services.Scheduler.Start(); err != nil {
+		log.Fatal("Failed to start drift scheduler: ", err)
+	}
+	defer services.Scheduler.Stop()
+
+	// Start background jobs
+	workers, err := strconv.Atoi(os.Getenv("JOB_WORKERS"))
+	if err != nil || workers < 1 {
+		workers = 4
+	}
+	queueSize, err := strconv.Atoi(os.Getenv("JOB_QUEUE_SIZE"))
+	if err != nil || queueSize < 1 {
+		queueSize = 100
+	}
+	services.Jobs = services.NewJobQueue(repositories.Context, workers, queueSize)
+	if err := services.Jobs.Start(); err != nil {
+		log.Fatal("Failed to start job queue: ", err)
+	}
+	defer services.Jobs.Stop()
+
 	// Set up router
 	r := routes.SetupRouter()
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(files.Handler))
@@ -23,16 +23,34 @@ func DBConnectionToModel(conn schemas.DBConnectionRequest) models.DBConnection {
 }
 
 func ProjectToModel(request schemas.ProjectRequest) models.Project {
+	var scratch *models.DBConnection
+	if request.Scratch != nil {
+		conn := DBConnectionToModel(*request.Scratch)
+		scratch = &conn
+	}
 	return models.Project{
 		Name:        request.Name,
 		Description: request.Description,
 		Source:      DBConnectionToModel(request.Source),
 		Target:      DBConnectionToModel(request.Target),
+		Filters:     request.Filters,
+		Scratch:     scratch,
+		LintRules:   request.LintRules,
+		Templates:   request.Templates,
+
+		DriftSchedule:   request.DriftSchedule,
+		DriftWebhookURL: request.DriftWebhookURL,
+		MaxRisk:         request.MaxRisk,
 	}
 }
 
 // Convert Project Model to ProjectResponse
 func ProjectToResponse(project models.Project) schemas.ProjectResponse {
+	var scratch *schemas.DBConnectionResponse
+	if project.Scratch != nil {
+		conn := DBConnectionToResponse(project.Scratch)
+		scratch = &conn
+	}
 	return schemas.ProjectResponse{
 		ID:          project.ID,
 		CreatedAt:   project.CreatedAt,
@@ -41,6 +59,14 @@ func ProjectToResponse(project models.Project) schemas.ProjectResponse {
 		Description: project.Description,
 		Source:      DBConnectionToResponse(&project.Source),
 		Target:      DBConnectionToResponse(&project.Target),
+		Filters:     project.Filters,
+		Scratch:     scratch,
+		LintRules:   project.LintRules,
+		Templates:   project.Templates,
+
+		DriftSchedule:   project.DriftSchedule,
+		DriftWebhookURL: project.DriftWebhookURL,
+		MaxRisk:         project.MaxRisk,
 	}
 }
 
@@ -55,3 +81,64 @@ func DBConnectionToResponse(model *models.DBConnection) schemas.DBConnectionResp
 		DBName:    model.DBName,
 	}
 }
+
+func SnapshotToResponse(snapshot models.Snapshot) schemas.SnapshotResponse {
+	return schemas.SnapshotResponse{
+		ID:             snapshot.ID,
+		CreatedAt:      snapshot.CreatedAt,
+		ProjectID:      snapshot.ProjectID,
+		DBConnectionID: snapshot.DBConnectionID,
+		Side:           snapshot.Side,
+		Label:          snapshot.Label,
+		Dialect:        snapshot.Dialect,
+		Schemas:        snapshot.Schemas,
+	}
+}
+
+func DriftEventToResponse(event models.DriftEvent) schemas.DriftEventResponse {
+	return schemas.DriftEventResponse{
+		ID:            event.ID,
+		CreatedAt:     event.CreatedAt,
+		ProjectID:     event.ProjectID,
+		HasDrift:      event.HasDrift,
+		Changed:       event.Changed,
+		Checksum:      event.Checksum,
+		Diff:          event.Diff,
+		Error:         event.Error,
+		WebhookStatus: event.WebhookStatus,
+		WebhookError:  event.WebhookError,
+	}
+}
+
+func MigrationToResponse(migration models.Migration) schemas.MigrationResponse {
+	return schemas.MigrationResponse{
+		ID:           migration.ID,
+		CreatedAt:    migration.CreatedAt,
+		ProjectID:    migration.ProjectID,
+		Direction:    migration.Direction,
+		Up:           migration.Up,
+		Down:         migration.Down,
+		Checksum:     migration.Checksum,
+		Status:       migration.Status,
+		AppliedAt:    migration.AppliedAt,
+		RolledBackAt: migration.RolledBackAt,
+		DurationMs:   migration.DurationMs,
+		AppliedBy:    migration.AppliedBy,
+		Error:        migration.Error,
+		SnapshotID:   migration.SnapshotID,
+	}
+}
+
+func JobToResponse(job models.Job) schemas.JobResponse {
+	return schemas.JobResponse{
+		ID:           job.ID,
+		CreatedAt:    job.CreatedAt,
+		ProjectID:    job.ProjectID,
+		Kind:         job.Kind,
+		Status:       job.Status,
+		StartedAt:    job.StartedAt,
+		FinishedAt:   job.FinishedAt,
+		Error:        job.Error,
+		ResultStatus: job.ResultStatus,
+	}
+}
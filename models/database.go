@@ -1,9 +1,10 @@
 package models
 
 type Schema struct {
-	Name      string        `json:"name"`
-	Tables    []TableSchema `json:"tables"`
-	Sequences []Sequence    `json:"sequences"`
+	Name       string        `json:"name"`
+	Tables     []TableSchema `json:"tables"`
+	Sequences  []Sequence    `json:"sequences"`
+	Dependents []Dependent   `json:"dependents,omitempty"`
 }
 
 type TableSchema struct {
@@ -15,11 +16,21 @@ type TableSchema struct {
 }
 
 type Column struct {
-	Name       string `json:"name"`
-	DataType   string `json:"data_type"`
-	IsNullable bool   `json:"is_nullable"`
-	IsPrimary  bool   `json:"is_primary"`
-	Default    string `json:"default"`
+	Name              string `json:"name"`
+	DataType          string `json:"data_type"`
+	IsNullable        bool   `json:"is_nullable"`
+	IsPrimary         bool   `json:"is_primary"`
+	Default           string `json:"default"`                      // As introspected, used to generate statements
+	NormalizedDefault string `json:"normalized_default,omitempty"` // Canonical form set by the dialect's normalizer, used to compare
+}
+
+// ComparedDefault returns the default compared between schemas, the
+// normalized one when the column went through a normalizer
+func (c Column) ComparedDefault() string {
+	if c.NormalizedDefault != "" {
+		return c.NormalizedDefault
+	}
+	return c.Default
 }
 
 type Index struct {
@@ -29,6 +40,26 @@ type Index struct {
 	IsPrimary bool     `json:"is_primary"`
 }
 
+// Dependent is a view, materialized view or function that depends on tables or
+// views. It is not compared but dropped and recreated around changes to the
+// objects it uses.
+type Dependent struct {
+	Type       string               `json:"type"` // view, materialized view or function
+	SchemaName string               `json:"schema_name"`
+	Name       string               `json:"name"`
+	Arguments  string               `json:"arguments,omitempty"` // Identity arguments of functions
+	Definition string               `json:"definition"`          // View query or complete CREATE FUNCTION statement
+	References []DependentReference `json:"references"`
+}
+
+// DependentReference is a table or view used by a dependent, with the columns
+// it uses (none when it depends on the whole relation)
+type DependentReference struct {
+	SchemaName string   `json:"schema_name"`
+	Name       string   `json:"name"`
+	Columns    []string `json:"columns,omitempty"`
+}
+
 type Sequence struct {
 	Name       string
 	SchemaName string
@@ -63,6 +94,9 @@ type SchemaDiff struct {
 	SequencesRemoved  []Sequence       `json:"sequences_removed"`
 	SequencesModified []SequenceChange `json:"sequences_modified"`
 	Summary           map[string]int   `json:"summary"`
+	Dependents        []Dependent      `json:"dependents,omitempty"` // Source dependents of removed or altered columns and tables
+	Severity          string           `json:"severity"`             // Riskiest severity of all changes
+	Risks             []ChangeRisk     `json:"risks"`                // Schema and sequence changes, table changes are on each TableDiff
 }
 
 type TableDiff struct {
@@ -80,13 +114,25 @@ type TableDiff struct {
 	ForeignKeyModified []ForeignKeyChange `json:"foreign_key_modified"`
 	ForeignKeyRemoved  []ForeignKey       `json:"foreign_key_removed"`
 	ForeignKeysSame    []ForeignKey       `json:"foreign_key_same"`
+	Severity           string             `json:"severity"`
+	Risks              []ChangeRisk       `json:"risks"`
 }
 
 type ColumnChange struct {
-	Name        string   `json:"name"`
-	Source      Column   `json:"source"`
-	Target      Column   `json:"target"`
-	ChangedAttr []string `json:"changed_attributes"`
+	Name        string            `json:"name"`
+	Source      Column            `json:"source"`
+	Target      Column            `json:"target"`
+	ChangedAttr []string          `json:"changed_attributes"`
+	Violations  []ColumnViolation `json:"violations,omitempty"` // Existing data the change cannot convert, see services.CheckFeasibility
+}
+
+// ColumnViolation reports rows of the migrated database that would make a
+// column change fail at apply time
+type ColumnViolation struct {
+	Check      string   `json:"check"` // null_values, max_length, out_of_range or invalid_format
+	Message    string   `json:"message"`
+	Count      int64    `json:"count"`
+	SampleKeys []string `json:"sample_keys"` // Primary key values (or row IDs) of offending rows
 }
 
 type IndexChange struct {
@@ -120,4 +166,31 @@ type QuerySet struct {
 	ForeignKey        string
 	Sequence          string
 	SequenceOwnership string
+	Dependent         string
+}
+
+type MergeConflict struct {
+	ObjectType   string `json:"object_type"`
+	SchemaName   string `json:"schema_name"`
+	TableName    string `json:"table_name,omitempty"`
+	Name         string `json:"name"`
+	OursAction   string `json:"ours_action"`
+	TheirsAction string `json:"theirs_action"`
+	Ours         any    `json:"ours,omitempty"`
+	Theirs       any    `json:"theirs,omitempty"`
+	Reason       string `json:"reason"`
+}
+
+type SchemaMerge struct {
+	Ours      SchemaDiff      `json:"ours"`
+	Theirs    SchemaDiff      `json:"theirs"`
+	Merged    SchemaDiff      `json:"merged"`
+	Conflicts []MergeConflict `json:"conflicts"`
+}
+
+// HasChanges reports whether the diff contains any added, removed or modified object
+func (d SchemaDiff) HasChanges() bool {
+	return len(d.SchemasAdded) > 0 || len(d.SchemasRemoved) > 0 ||
+		len(d.TablesAdded) > 0 || len(d.TablesRemoved) > 0 || len(d.TablesModified) > 0 ||
+		len(d.SequencesAdded) > 0 || len(d.SequencesRemoved) > 0 || len(d.SequencesModified) > 0
 }
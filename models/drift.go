@@ -0,0 +1,17 @@
+package models
+
+import "gorm.io/gorm"
+
+// DriftEvent records the outcome of one scheduled drift detection run
+type DriftEvent struct {
+	gorm.Model
+	ProjectID     uint       `json:"project_id" gorm:"index"`
+	Project       Project    `json:"-" gorm:"foreignKey:ProjectID;constraint:OnDelete:CASCADE;"`
+	HasDrift      bool       `json:"has_drift"`
+	Changed       bool       `json:"changed"` // Whether the diff differs from the previous run
+	Checksum      string     `json:"checksum"`
+	Diff          SchemaDiff `json:"diff" gorm:"serializer:json"`
+	Error         string     `json:"error,omitempty"`
+	WebhookStatus int        `json:"webhook_status,omitempty"`
+	WebhookError  string     `json:"webhook_error,omitempty"`
+}
@@ -0,0 +1,189 @@
+package models
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// regexPrefix marks a filter pattern as a regular expression instead of a glob
+const regexPrefix = "re:"
+
+// ObjectFilter holds the include/exclude rules applied to introspected schemas.
+// Patterns are globs (e.g. "flyway_*") unless prefixed with "re:", in which case
+// they are regular expressions. Table, column and sequence patterns are matched
+// against both the bare and the schema-qualified name.
+type ObjectFilter struct {
+	IncludeSchemas   []string `json:"include_schemas,omitempty"`
+	ExcludeSchemas   []string `json:"exclude_schemas,omitempty"`
+	IncludeTables    []string `json:"include_tables,omitempty"`
+	ExcludeTables    []string `json:"exclude_tables,omitempty"`
+	IncludeColumns   []string `json:"include_columns,omitempty"`
+	ExcludeColumns   []string `json:"exclude_columns,omitempty"`
+	IncludeSequences []string `json:"include_sequences,omitempty"`
+	ExcludeSequences []string `json:"exclude_sequences,omitempty"`
+	SkipIndexes      *bool    `json:"skip_indexes,omitempty"` // Toggles are unset rather than false so that merged overrides can turn them off
+	SkipForeignKeys  *bool    `json:"skip_foreign_keys,omitempty"`
+	SkipSequences    *bool    `json:"skip_sequences,omitempty"`
+}
+
+// Validate checks that every pattern in the filter compiles
+func (f ObjectFilter) Validate() error {
+	groups := [][]string{
+		f.IncludeSchemas, f.ExcludeSchemas,
+		f.IncludeTables, f.ExcludeTables,
+		f.IncludeColumns, f.ExcludeColumns,
+		f.IncludeSequences, f.ExcludeSequences,
+	}
+	for _, patterns := range groups {
+		for _, pattern := range patterns {
+			if expr, ok := strings.CutPrefix(pattern, regexPrefix); ok {
+				if _, err := compileRegex(expr); err != nil {
+					return fmt.Errorf("invalid regex pattern %q: %v", pattern, err)
+				}
+				continue
+			}
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid glob pattern %q: %v", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// IsEmpty reports whether the filter lets every object through
+func (f ObjectFilter) IsEmpty() bool {
+	return len(f.IncludeSchemas) == 0 && len(f.ExcludeSchemas) == 0 &&
+		len(f.IncludeTables) == 0 && len(f.ExcludeTables) == 0 &&
+		len(f.IncludeColumns) == 0 && len(f.ExcludeColumns) == 0 &&
+		len(f.IncludeSequences) == 0 && len(f.ExcludeSequences) == 0 &&
+		!f.SkipsIndexes() && !f.SkipsForeignKeys() && !f.SkipsSequences()
+}
+
+// SkipsIndexes reports whether indexes are left out
+func (f ObjectFilter) SkipsIndexes() bool {
+	return f.SkipIndexes != nil && *f.SkipIndexes
+}
+
+// SkipsForeignKeys reports whether foreign keys are left out
+func (f ObjectFilter) SkipsForeignKeys() bool {
+	return f.SkipForeignKeys != nil && *f.SkipForeignKeys
+}
+
+// SkipsSequences reports whether sequences are left out
+func (f ObjectFilter) SkipsSequences() bool {
+	return f.SkipSequences != nil && *f.SkipSequences
+}
+
+// MatchSchema reports whether the schema passes the filter
+func (f ObjectFilter) MatchSchema(name string) bool {
+	return allowed(f.IncludeSchemas, f.ExcludeSchemas, name)
+}
+
+// MatchTable reports whether the table passes the filter
+func (f ObjectFilter) MatchTable(schemaName, name string) bool {
+	return allowed(f.IncludeTables, f.ExcludeTables, name, schemaName+"."+name)
+}
+
+// MatchColumn reports whether the column passes the filter. Column patterns are
+// matched against "column", "table.column" and "schema.table.column".
+func (f ObjectFilter) MatchColumn(schemaName, tableName, name string) bool {
+	return allowed(f.IncludeColumns, f.ExcludeColumns,
+		name, tableName+"."+name, schemaName+"."+tableName+"."+name)
+}
+
+// MatchSequence reports whether the sequence passes the filter
+func (f ObjectFilter) MatchSequence(schemaName, name string) bool {
+	if f.SkipsSequences() {
+		return false
+	}
+	return allowed(f.IncludeSequences, f.ExcludeSequences, name, schemaName+"."+name)
+}
+
+// Merge returns a copy of the filter where every non-empty rule and every set
+// toggle of the override replaces the corresponding one of the receiver, so
+// that an explicit false turns a toggle off
+func (f ObjectFilter) Merge(override ObjectFilter) ObjectFilter {
+	merged := f
+	replace := func(dst *[]string, src []string) {
+		if len(src) > 0 {
+			*dst = src
+		}
+	}
+	toggle := func(dst **bool, src *bool) {
+		if src != nil {
+			*dst = src
+		}
+	}
+	replace(&merged.IncludeSchemas, override.IncludeSchemas)
+	replace(&merged.ExcludeSchemas, override.ExcludeSchemas)
+	replace(&merged.IncludeTables, override.IncludeTables)
+	replace(&merged.ExcludeTables, override.ExcludeTables)
+	replace(&merged.IncludeColumns, override.IncludeColumns)
+	replace(&merged.ExcludeColumns, override.ExcludeColumns)
+	replace(&merged.IncludeSequences, override.IncludeSequences)
+	replace(&merged.ExcludeSequences, override.ExcludeSequences)
+	toggle(&merged.SkipIndexes, override.SkipIndexes)
+	toggle(&merged.SkipForeignKeys, override.SkipForeignKeys)
+	toggle(&merged.SkipSequences, override.SkipSequences)
+	return merged
+}
+
+// allowed applies include-then-exclude semantics: an object is kept when it
+// matches any include pattern (or there are none) and no exclude pattern.
+func allowed(include, exclude []string, names ...string) bool {
+	if len(include) > 0 && !matchAny(include, names) {
+		return false
+	}
+	return !matchAny(exclude, names)
+}
+
+func matchAny(patterns, names []string) bool {
+	for _, pattern := range patterns {
+		for _, name := range names {
+			if matchPattern(pattern, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchPattern(pattern, name string) bool {
+	if expr, ok := strings.CutPrefix(pattern, regexPrefix); ok {
+		re, err := compileRegex(expr)
+		return err == nil && re.MatchString(name)
+	}
+	matched, err := path.Match(pattern, name)
+	return err == nil && matched
+}
+
+// maxCachedRegexes bounds the cache of compiled patterns, filters come from
+// requests and are not trusted to be few
+const maxCachedRegexes = 1024
+
+var (
+	regexCacheMu sync.Mutex
+	regexCache   = make(map[string]*regexp.Regexp)
+)
+
+// compileRegex compiles a regular expression pattern once, filters match it
+// against every introspected object
+func compileRegex(expr string) (*regexp.Regexp, error) {
+	regexCacheMu.Lock()
+	defer regexCacheMu.Unlock()
+	if re, ok := regexCache[expr]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(regexCache) >= maxCachedRegexes {
+		clear(regexCache)
+	}
+	regexCache[expr] = re
+	return re, nil
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Statuses of background jobs
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+)
+
+// Job is a request run in the background by the job queue
+type Job struct {
+	gorm.Model
+	ProjectID    uint       `json:"project_id" gorm:"index"`
+	Project      Project    `json:"-" gorm:"foreignKey:ProjectID;constraint:OnDelete:CASCADE;"`
+	Kind         string     `json:"kind"` // compare, dump or apply
+	Status       string     `json:"status" gorm:"index"`
+	StartedAt    *time.Time `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at"`
+	Error        string     `json:"error,omitempty"`
+	ResultStatus int        `json:"result_status,omitempty"` // HTTP status the request would have been answered with
+	ResultType   string     `json:"-"`                       // Content type of the result
+	Result       []byte     `json:"-"`
+}
+
+// Finished reports whether the job reached a final status
+func (j Job) Finished() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed || j.Status == JobCanceled
+}
@@ -0,0 +1,25 @@
+package models
+
+// Lint finding levels
+const (
+	LintError   = "error"   // The migration is likely to fail or break the application
+	LintWarning = "warning" // The migration works but may lock, rewrite or surprise
+)
+
+// LintFinding is a problem a lint rule found in a migration
+type LintFinding struct {
+	Rule    string `json:"rule"`
+	Level   string `json:"level"`
+	Object  string `json:"object"`         // Qualified name of the object concerned
+	Step    string `json:"step,omitempty"` // ID of the migration step concerned
+	Message string `json:"message"`
+}
+
+// LintRules enables or disables lint rules by name, rules not listed run
+type LintRules map[string]bool
+
+// Enabled reports whether the named rule runs
+func (r LintRules) Enabled(rule string) bool {
+	enabled, ok := r[rule]
+	return !ok || enabled
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Statuses of tracked migrations
+const (
+	MigrationPending    = "pending"
+	MigrationApplied    = "applied"
+	MigrationFailed     = "failed"
+	MigrationRolledBack = "rolled_back"
+)
+
+// Migration records a migration script generated for or run against a
+// project's target. Generated scripts stay pending until they are applied.
+type Migration struct {
+	gorm.Model
+	ProjectID    uint       `json:"project_id" gorm:"index"`
+	Project      Project    `json:"-" gorm:"foreignKey:ProjectID;constraint:OnDelete:CASCADE;"`
+	Direction    string     `json:"direction"` // Comparison direction the script was generated for, left or right
+	Up           string     `json:"up"`
+	Down         string     `json:"down"`
+	Checksum     string     `json:"checksum" gorm:"index"`
+	Status       string     `json:"status" gorm:"index"`
+	AppliedAt    *time.Time `json:"applied_at"`
+	RolledBackAt *time.Time `json:"rolled_back_at"`
+	DurationMs   float64    `json:"duration_ms"`
+	AppliedBy    string     `json:"applied_by"`
+	Error        string     `json:"error,omitempty"`
+	SnapshotID   *uint      `json:"snapshot_id"` // Target schema before the migration
+	Snapshot     *Snapshot  `json:"-" gorm:"foreignKey:SnapshotID;constraint:OnDelete:SET NULL;"`
+}
@@ -6,6 +6,9 @@ import (
 	"strings"
 
 	"github.com/Tsarbomba69-com/mammoth.server/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/stdlib"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -21,34 +24,84 @@ type DBConnection struct {
 
 type Project struct {
 	gorm.Model
-	Name        string       `json:"name"`
-	Description string       `json:"description"`
-	SourceID    uint         `json:"source_id"`
-	Source      DBConnection `json:"source" gorm:"foreignKey:SourceID;constraint:OnDelete:CASCADE;"`
-	TargetID    uint         `json:"target_id"`
-	Target      DBConnection `json:"target" gorm:"foreignKey:TargetID;constraint:OnDelete:CASCADE;"`
+	Name            string        `json:"name"`
+	Description     string        `json:"description"`
+	SourceID        uint          `json:"source_id"`
+	Source          DBConnection  `json:"source" gorm:"foreignKey:SourceID;constraint:OnDelete:CASCADE;"`
+	TargetID        uint          `json:"target_id"`
+	Target          DBConnection  `json:"target" gorm:"foreignKey:TargetID;constraint:OnDelete:CASCADE;"`
+	Filters         ObjectFilter  `json:"filters" gorm:"serializer:json"`
+	DriftSchedule   string        `json:"drift_schedule"` // Cron expression, drift detection is off when empty
+	DriftWebhookURL string        `json:"drift_webhook_url"`
+	MaxRisk         string        `json:"max_risk"` // Riskiest change severity /compare accepts, unlimited when empty
+	LintRules       LintRules     `json:"lint_rules" gorm:"serializer:json"`
+	Templates       DDLTemplates  `json:"templates" gorm:"serializer:json"`
+	ScratchID       *uint         `json:"scratch_id"`
+	Scratch         *DBConnection `json:"scratch" gorm:"foreignKey:ScratchID;constraint:OnDelete:SET NULL;"` // Disposable database migrations are verified on
 }
 
+// DDLTemplates maps DDL method names to text/template sources overriding
+// their generated SQL
+type DDLTemplates map[string]string
+
 // Connect establishes a connection to the database
 func (dbc *DBConnection) Connect() (*gorm.DB, error) {
+	dsn, err := dbc.dsn()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %v", err)
+	}
+
+	return db, nil
+}
+
+// ConnectWithNotices establishes a connection to the database that passes
+// the notices the server sends to onNotice
+func (dbc *DBConnection) ConnectWithNotices(onNotice func(message string)) (*gorm.DB, error) {
+	dsn, err := dbc.dsn()
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse connection settings: %v", err)
+	}
+	config.OnNotice = func(_ *pgconn.PgConn, notice *pgconn.Notice) {
+		onNotice(fmt.Sprintf("%s: %s", notice.Severity, notice.Message))
+	}
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: stdlib.OpenDB(*config)}), &gorm.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %v", err)
+	}
+
+	return db, nil
+}
+
+func (dbc *DBConnection) dsn() (string, error) {
 	pass, err := utils.Decrypt([]byte([]byte(os.Getenv("ENCRYPTION_KEY"))), dbc.Password)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt password: %v", err)
+		return "", fmt.Errorf("failed to decrypt password: %v", err)
 	}
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=disable",
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=disable",
 		dbc.Host,
 		dbc.User,
 		pass,
 		dbc.DBName,
 		dbc.Port,
-	)
+	), nil
+}
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to database: %v", err)
+// Close releases the connection pool of a database opened with Connect
+func Close(db *gorm.DB) {
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
 	}
-
-	return db, nil
 }
 
 // ConnectForProject establishes connections to both source and target databases
@@ -62,6 +115,7 @@ func (p *Project) ConnectForProject() (*gorm.DB, *gorm.DB, error) {
 	// Connect to target database
 	targetDB, err := p.Target.Connect()
 	if err != nil {
+		Close(sourceDB)
 		return nil, nil, fmt.Errorf("failed to connect to target database: %v", err)
 	}
 
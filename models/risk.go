@@ -0,0 +1,59 @@
+package models
+
+import "fmt"
+
+// Change severities, ordered from least to most risky
+const (
+	SeveritySafe        = "safe"
+	SeverityCaution     = "caution"
+	SeverityDestructive = "destructive"
+)
+
+// Reasons explaining the severity of a change
+const (
+	ReasonDataLoss                = "data_loss"
+	ReasonTypeNarrowing           = "type_narrowing"
+	ReasonRangeNarrowing          = "range_narrowing"
+	ReasonNotNullOnExistingColumn = "not_null_on_existing_column"
+	ReasonNotNullWithoutDefault   = "not_null_without_default"
+	ReasonTableRewrite            = "table_rewrite"
+	ReasonAccessExclusiveLock     = "access_exclusive_lock"
+	ReasonBlocksWrites            = "blocks_writes"
+)
+
+var severityRanks = map[string]int{
+	SeveritySafe:        0,
+	SeverityCaution:     1,
+	SeverityDestructive: 2,
+}
+
+// ChangeRisk describes how risky applying a single change is
+type ChangeRisk struct {
+	ObjectType string   `json:"object_type"`
+	TableName  string   `json:"table_name,omitempty"` // Qualified owning table of columns, indexes and foreign keys
+	Name       string   `json:"name"`                 // Qualified name of schemas, tables and sequences
+	Action     string   `json:"action"`
+	Severity   string   `json:"severity"`
+	Reasons    []string `json:"reasons"`
+}
+
+// ValidateSeverity checks that s names a known severity
+func ValidateSeverity(s string) error {
+	if _, ok := severityRanks[s]; !ok {
+		return fmt.Errorf("invalid risk level %q: expected safe, caution or destructive", s)
+	}
+	return nil
+}
+
+// SeverityExceeds reports whether severity s is riskier than limit
+func SeverityExceeds(s, limit string) bool {
+	return severityRanks[s] > severityRanks[limit]
+}
+
+// MaxSeverity returns the riskier of two severities
+func MaxSeverity(a, b string) string {
+	if a == "" || SeverityExceeds(b, a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,15 @@
+package models
+
+import "gorm.io/gorm"
+
+// Snapshot is a point-in-time copy of a project database's schema
+type Snapshot struct {
+	gorm.Model
+	ProjectID      uint     `json:"project_id" gorm:"index"`
+	Project        Project  `json:"-" gorm:"foreignKey:ProjectID;constraint:OnDelete:CASCADE;"`
+	DBConnectionID uint     `json:"db_connection_id"`
+	Side           string   `json:"side"` // "source" or "target"
+	Label          string   `json:"label"`
+	Dialect        string   `json:"dialect"`
+	Schemas        []Schema `json:"schemas" gorm:"serializer:json"`
+}
@@ -0,0 +1,137 @@
+package reports
+
+import (
+	"html/template"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+)
+
+// HTMLRenderer renders a self-contained HTML report with collapsible tables
+// and highlighted SQL
+type HTMLRenderer struct{}
+
+type htmlTable struct {
+	Name    string
+	Action  string
+	Entries []entry
+}
+
+type htmlReport struct {
+	Summary []htmlCount
+	Schemas []entry
+	Tables  []htmlTable
+	Others  []entry
+	Up      template.HTML
+	Down    template.HTML
+}
+
+type htmlCount struct {
+	Label string
+	Count int
+}
+
+var sqlKeywordPattern = regexp.MustCompile(`\b(CREATE|ALTER|DROP|TABLE|SCHEMA|SEQUENCE|INDEX|UNIQUE|ADD|COLUMN|CONSTRAINT|FOREIGN|PRIMARY|KEY|REFERENCES|ON|DELETE|UPDATE|NOT|NULL|DEFAULT|IF|EXISTS|CASCADE|OWNED|BY|INCREMENT|MINVALUE|MAXVALUE|START|WITH|CYCLE|NO|SET|TYPE|USING|BEGIN|COMMIT)\b`)
+
+// highlightSQL escapes the script and wraps SQL keywords for styling
+func highlightSQL(sql string) template.HTML {
+	escaped := template.HTMLEscapeString(sql)
+	return template.HTML(sqlKeywordPattern.ReplaceAllString(escaped, `<span class="kw">$1</span>`))
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Schema comparison</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2rem; color: #1f2328; }
+table.summary { border-collapse: collapse; margin-bottom: 1.5rem; }
+table.summary td, table.summary th { border: 1px solid #d0d7de; padding: .3rem .8rem; text-align: left; }
+details { border: 1px solid #d0d7de; border-radius: 6px; margin: .5rem 0; padding: .5rem 1rem; }
+summary { cursor: pointer; font-weight: 600; }
+.added { color: #1a7f37; } .removed { color: #cf222e; } .modified { color: #9a6700; }
+pre { background: #f6f8fa; padding: 1rem; border-radius: 6px; overflow-x: auto; }
+.kw { color: #0550ae; font-weight: 600; }
+</style>
+</head>
+<body>
+<h1>Schema comparison</h1>
+<table class="summary">
+<tr><th>Change</th><th>Count</th></tr>
+{{range .Summary}}<tr><td>{{.Label}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+{{if .Schemas}}<h2>Schemas</h2>
+<ul>{{range .Schemas}}<li class="{{.Action}}">{{.Name}} {{.Action}}</li>{{end}}</ul>
+{{end}}{{if .Tables}}<h2>Tables</h2>
+{{range .Tables}}<details>
+<summary class="{{.Action}}">{{.Name}} ({{.Action}})</summary>
+<ul>{{range .Entries}}<li class="{{.Action}}">{{.Kind}} <code>{{.Name}}</code> {{.Action}}{{if .Details}}<ul>{{range .Details}}<li>{{.}}</li>{{end}}</ul>{{end}}</li>{{end}}</ul>
+</details>
+{{end}}{{end}}{{if .Others}}<h2>Sequences</h2>
+<ul>{{range .Others}}<li class="{{.Action}}"><code>{{.Name}}</code> {{.Action}}{{if .Details}}<ul>{{range .Details}}<li>{{.}}</li>{{end}}</ul>{{end}}</li>{{end}}</ul>
+{{end}}{{if .Up}}<details open>
+<summary>Up migration</summary>
+<pre><code>{{.Up}}</code></pre>
+</details>
+{{end}}{{if .Down}}<details>
+<summary>Down migration</summary>
+<pre><code>{{.Down}}</code></pre>
+</details>
+{{end}}</body>
+</html>
+`))
+
+func (r HTMLRenderer) ContentType() string {
+	return "text/html; charset=utf-8"
+}
+
+func (r HTMLRenderer) Render(w io.Writer, diff models.SchemaDiff, script services.MigrationScript) error {
+	report := htmlReport{
+		Up:   highlightSQL(script.Up),
+		Down: highlightSQL(script.Down),
+	}
+
+	for _, key := range summaryKeys {
+		report.Summary = append(report.Summary, htmlCount{Label: strings.ReplaceAll(key, "_", " "), Count: diff.Summary[key]})
+	}
+
+	tables := make(map[string]int)
+	for _, e := range entries(diff) {
+		switch {
+		case e.Kind == "schema":
+			report.Schemas = append(report.Schemas, e)
+		case e.Kind == "table":
+			report.Tables = append(report.Tables, htmlTable{
+				Name:    e.Name,
+				Action:  e.Action,
+				Entries: detailEntries(e),
+			})
+		case e.Table != "":
+			pos, exists := tables[e.Table]
+			if !exists {
+				pos = len(report.Tables)
+				tables[e.Table] = pos
+				report.Tables = append(report.Tables, htmlTable{Name: e.Table, Action: "modified"})
+			}
+			report.Tables[pos].Entries = append(report.Tables[pos].Entries, e)
+		default:
+			report.Others = append(report.Others, e)
+		}
+	}
+
+	return htmlTemplate.Execute(w, report)
+}
+
+// detailEntries lists the columns of an added or removed table
+func detailEntries(table entry) []entry {
+	var result []entry
+	for _, detail := range table.Details {
+		name, definition, _ := strings.Cut(detail, " ")
+		result = append(result, entry{Kind: "column", Action: table.Action, Name: name, Details: []string{definition}})
+	}
+	return result
+}
@@ -0,0 +1,93 @@
+package reports
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+)
+
+// JUnitRenderer renders reports as JUnit XML, one failing test case per
+// drifted object, so CI systems can surface schema drift as test failures
+type JUnitRenderer struct{}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+	SystemOut string          `xml:"system-out,omitempty"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Body    string `xml:",chardata"`
+}
+
+func (r JUnitRenderer) ContentType() string {
+	return "application/xml; charset=utf-8"
+}
+
+func (r JUnitRenderer) Render(w io.Writer, diff models.SchemaDiff, script services.MigrationScript) error {
+	suite := junitTestSuite{Name: "schema-drift", SystemOut: script.Up}
+
+	for _, e := range entries(diff) {
+		className := e.Kind
+		if e.Table != "" {
+			className = e.Table
+		}
+		suite.TestCases = append(suite.TestCases, junitTestCase{
+			Name:      e.Kind + " " + e.Name,
+			ClassName: className,
+			Failure: &junitFailure{
+				Message: e.Title(),
+				Type:    e.Action,
+				Body:    strings.Join(e.Details, "\n"),
+			},
+		})
+		suite.Failures++
+	}
+
+	for _, name := range diff.TablesSame {
+		suite.TestCases = append(suite.TestCases, junitTestCase{Name: "table " + name, ClassName: "table"})
+	}
+	for _, name := range diff.SequencesSame {
+		suite.TestCases = append(suite.TestCases, junitTestCase{Name: "sequence " + name, ClassName: "sequence"})
+	}
+	suite.Tests = len(suite.TestCases)
+
+	report := junitTestSuites{
+		Name:     "mammoth",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Suites:   []junitTestSuite{suite},
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,59 @@
+package reports
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+)
+
+// MarkdownRenderer renders reports suitable for pull request comments
+type MarkdownRenderer struct{}
+
+func (r MarkdownRenderer) ContentType() string {
+	return "text/markdown; charset=utf-8"
+}
+
+func (r MarkdownRenderer) Render(w io.Writer, diff models.SchemaDiff, script services.MigrationScript) error {
+	var md strings.Builder
+
+	md.WriteString("## Schema comparison\n\n")
+	if diff.Severity != "" {
+		md.WriteString(fmt.Sprintf("Overall risk: **%s**\n\n", diff.Severity))
+	}
+	md.WriteString("| Change | Count |\n|---|---:|\n")
+	for _, key := range summaryKeys {
+		md.WriteString(fmt.Sprintf("| %s | %d |\n", strings.ReplaceAll(key, "_", " "), diff.Summary[key]))
+	}
+
+	changes := entries(diff)
+	if len(changes) == 0 {
+		md.WriteString("\nNo differences found.\n")
+	} else {
+		md.WriteString("\n### Changes\n\n")
+		for _, e := range changes {
+			md.WriteString(fmt.Sprintf("- **%s** `%s`", e.Action, e.Name))
+			if e.Table != "" {
+				md.WriteString(fmt.Sprintf(" (%s on `%s`)", strings.ReplaceAll(e.Kind, "_", " "), e.Table))
+			} else {
+				md.WriteString(fmt.Sprintf(" (%s)", e.Kind))
+			}
+			md.WriteString("\n")
+			for _, detail := range e.Details {
+				md.WriteString(fmt.Sprintf("  - %s\n", detail))
+			}
+		}
+	}
+
+	if script.Up != "" {
+		md.WriteString("\n### Up migration\n\n```sql\n" + script.Up + "```\n")
+	}
+	if script.Down != "" {
+		md.WriteString("\n### Down migration\n\n```sql\n" + script.Down + "```\n")
+	}
+
+	_, err := io.WriteString(w, md.String())
+	return err
+}
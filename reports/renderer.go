@@ -0,0 +1,226 @@
+package reports
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+)
+
+// Renderer turns a schema comparison into a human or machine readable report
+type Renderer interface {
+	ContentType() string
+	Render(w io.Writer, diff models.SchemaDiff, script services.MigrationScript) error
+}
+
+// NewRenderer returns the renderer for a format name ("markdown", "html" or
+// "junit"). An empty or "json" format returns nil, meaning the plain JSON response.
+func NewRenderer(format string) (Renderer, error) {
+	switch strings.ToLower(format) {
+	case "", "json":
+		return nil, nil
+	case "markdown", "md":
+		return MarkdownRenderer{}, nil
+	case "html":
+		return HTMLRenderer{}, nil
+	case "junit", "xml":
+		return JUnitRenderer{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported report format: %s", format)
+	}
+}
+
+// FormatFromAccept picks a report format from an Accept header, returning ""
+// when none of the report media types is acceptable
+func FormatFromAccept(accept string) string {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		switch mediaType {
+		case "text/markdown":
+			return "markdown"
+		case "text/html":
+			return "html"
+		case "application/xml", "text/xml", "application/junit+xml":
+			return "junit"
+		case "application/json":
+			return "json"
+		}
+	}
+	return ""
+}
+
+// entry is a single changed object of a diff, flattened for reporting
+type entry struct {
+	Kind    string // schema, table, column, index, foreign_key, sequence
+	Action  string // added, removed, modified
+	Table   string // Qualified table name for table elements
+	Name    string
+	Details []string
+}
+
+// Title returns a short human readable description of the change
+func (e entry) Title() string {
+	if e.Table != "" {
+		return fmt.Sprintf("%s %s %s on %s", strings.ReplaceAll(e.Kind, "_", " "), e.Name, e.Action, e.Table)
+	}
+	return fmt.Sprintf("%s %s %s", e.Kind, e.Name, e.Action)
+}
+
+func qualified(schemaName, name string) string {
+	if schemaName == "" {
+		return name
+	}
+	return schemaName + "." + name
+}
+
+// entries flattens the diff into the list of changed objects
+func entries(diff models.SchemaDiff) []entry {
+	var result []entry
+
+	for _, name := range diff.SchemasAdded {
+		result = append(result, entry{Kind: "schema", Action: "added", Name: name})
+	}
+	for _, name := range diff.SchemasRemoved {
+		result = append(result, entry{Kind: "schema", Action: "removed", Name: name})
+	}
+
+	for _, table := range diff.TablesAdded {
+		result = append(result, entry{Kind: "table", Action: "added", Name: qualified(table.SchemaName, table.Name),
+			Details: columnList(table.ColumnsAdded)})
+	}
+	for _, table := range diff.TablesRemoved {
+		result = append(result, entry{Kind: "table", Action: "removed", Name: qualified(table.SchemaName, table.Name),
+			Details: columnList(table.ColumnsAdded)})
+	}
+
+	for _, table := range diff.TablesModified {
+		result = append(result, tableEntries(table)...)
+	}
+
+	for _, seq := range diff.SequencesAdded {
+		result = append(result, entry{Kind: "sequence", Action: "added", Name: qualified(seq.SchemaName, seq.Name)})
+	}
+	for _, seq := range diff.SequencesRemoved {
+		result = append(result, entry{Kind: "sequence", Action: "removed", Name: qualified(seq.SchemaName, seq.Name)})
+	}
+	for _, change := range diff.SequencesModified {
+		var details []string
+		for _, attr := range change.ChangedAttr {
+			details = append(details, fmt.Sprintf("%s: %v → %v", attr, sequenceAttr(change.Source, attr), sequenceAttr(change.Target, attr)))
+		}
+		result = append(result, entry{Kind: "sequence", Action: "modified", Name: qualified(change.SchemaName, change.Name), Details: details})
+	}
+
+	return result
+}
+
+func tableEntries(table models.TableDiff) []entry {
+	var result []entry
+	tableName := qualified(table.SchemaName, table.Name)
+	add := func(kind, action, name string, details ...string) {
+		result = append(result, entry{Kind: kind, Action: action, Table: tableName, Name: name, Details: details})
+	}
+
+	for _, col := range table.ColumnsAdded {
+		add("column", "added", col.Name, columnDefinition(col))
+	}
+	for _, col := range table.ColumnsRemoved {
+		add("column", "removed", col.Name, columnDefinition(col))
+	}
+	for _, change := range table.ColumnsModified {
+		var details []string
+		for _, attr := range change.ChangedAttr {
+			details = append(details, fmt.Sprintf("%s: %v → %v", attr, columnAttr(change.Source, attr), columnAttr(change.Target, attr)))
+		}
+		for _, violation := range change.Violations {
+			details = append(details, fmt.Sprintf("blocked by %d rows (%s): %s, e.g. %s",
+				violation.Count, violation.Check, violation.Message, strings.Join(violation.SampleKeys, ", ")))
+		}
+		add("column", "modified", change.Name, details...)
+	}
+	for _, idx := range table.IndexesAdded {
+		add("index", "added", idx.Name, "columns: "+strings.Join(idx.Columns, ", "))
+	}
+	for _, idx := range table.IndexesRemoved {
+		add("index", "removed", idx.Name, "columns: "+strings.Join(idx.Columns, ", "))
+	}
+	for _, change := range table.IndexesModified {
+		add("index", "modified", change.Name, "changed: "+strings.Join(change.ChangedAttr, ", "))
+	}
+	for _, fk := range table.ForeignKeyAdded {
+		add("foreign_key", "added", fk.Name, "references "+fk.ReferencedTable+" ("+strings.Join(fk.ReferencedColumns, ", ")+")")
+	}
+	for _, fk := range table.ForeignKeyRemoved {
+		add("foreign_key", "removed", fk.Name, "references "+fk.ReferencedTable+" ("+strings.Join(fk.ReferencedColumns, ", ")+")")
+	}
+	for _, change := range table.ForeignKeyModified {
+		add("foreign_key", "modified", change.Name, "changed: "+strings.Join(change.ChangedAttr, ", "))
+	}
+
+	return result
+}
+
+func columnDefinition(col models.Column) string {
+	definition := col.DataType
+	if !col.IsNullable {
+		definition += " NOT NULL"
+	}
+	if col.Default != "" {
+		definition += " DEFAULT " + col.Default
+	}
+	if col.IsPrimary {
+		definition += " PRIMARY KEY"
+	}
+	return definition
+}
+
+func columnList(columns []models.Column) []string {
+	var result []string
+	for _, col := range columns {
+		result = append(result, col.Name+" "+columnDefinition(col))
+	}
+	return result
+}
+
+func columnAttr(col models.Column, attr string) any {
+	switch attr {
+	case "data_type":
+		return col.DataType
+	case "is_nullable":
+		return col.IsNullable
+	case "is_primary":
+		return col.IsPrimary
+	case "default":
+		if col.Default == "" {
+			return "(none)"
+		}
+		return col.Default
+	}
+	return ""
+}
+
+func sequenceAttr(seq models.Sequence, attr string) any {
+	switch attr {
+	case "increment":
+		return seq.Increment
+	case "is_cyclic":
+		return seq.IsCyclic
+	case "max_value":
+		return seq.MaxValue
+	case "min_value":
+		return seq.MinValue
+	case "start_value":
+		return seq.StartValue
+	}
+	return ""
+}
+
+// summaryKeys lists the summary counters in report order
+var summaryKeys = []string{
+	"schemas_added", "schemas_removed",
+	"tables_added", "tables_removed", "tables_modified", "tables_same",
+	"sequences_added", "sequences_removed", "sequences_modified", "sequences_same",
+	"risk_safe", "risk_caution", "risk_destructive",
+}
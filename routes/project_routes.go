@@ -10,7 +10,31 @@ func RegisterProjectRoutes(http *gin.Engine) {
 	{
 		r.POST("/", controllers.CreateProject)
 		r.GET("/", controllers.GetProjects)
-		r.GET("/:id/compare", controllers.Compare)
-		r.GET("/:id/dump", controllers.Dump)
+		r.GET("/:id/compare", controllers.Async("compare", controllers.Compare))
+		r.POST("/:id/compare", controllers.Async("compare", controllers.Compare))
+		r.PUT("/:id/filters", controllers.UpdateFilters)
+		r.PUT("/:id/policy", controllers.UpdateRiskPolicy)
+		r.PUT("/:id/scratch", controllers.UpdateScratchDatabase)
+		r.POST("/:id/merge", controllers.Merge)
+		r.POST("/:id/snapshots", controllers.CreateSnapshot)
+		r.GET("/:id/snapshots", controllers.GetSnapshots)
+		r.GET("/:id/snapshots/:sid", controllers.GetSnapshot)
+		r.DELETE("/:id/snapshots/:sid", controllers.DeleteSnapshot)
+		r.PUT("/:id/drift", controllers.UpdateDriftConfig)
+		r.GET("/:id/drift/events", controllers.GetDriftEvents)
+		r.GET("/:id/dump", controllers.Async("dump", controllers.Dump))
+		r.GET("/:id/export", controllers.ExportMigration)
+		r.GET("/:id/lint", controllers.Lint)
+		r.PUT("/:id/lint/rules", controllers.UpdateLintRules)
+		r.PUT("/:id/templates", controllers.UpdateTemplates)
+		r.GET("/:id/migrations", controllers.GetMigrations)
+		r.POST("/:id/migrations/apply", controllers.Async("apply", controllers.ApplyMigration))
+		r.GET("/:id/migrations/:mid", controllers.GetMigration)
+		r.POST("/:id/migrations/:mid/rollback", controllers.RollbackMigration)
+		r.GET("/:id/migrations/:mid/export", controllers.ExportStoredMigration)
+		r.GET("/:id/jobs/:jid", controllers.GetJob)
+		r.GET("/:id/jobs/:jid/result", controllers.GetJobResult)
+		r.POST("/:id/jobs/:jid/cancel", controllers.CancelJob)
+		r.GET("/:id/jobs/:jid/events", controllers.StreamJobEvents)
 	}
 }
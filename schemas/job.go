@@ -0,0 +1,15 @@
+package schemas
+
+import "time"
+
+type JobResponse struct {
+	ID           uint       `json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ProjectID    uint       `json:"project_id"`
+	Kind         string     `json:"kind"`
+	Status       string     `json:"status"`
+	StartedAt    *time.Time `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at"`
+	Error        string     `json:"error,omitempty"`
+	ResultStatus int        `json:"result_status,omitempty"`
+}
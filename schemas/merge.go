@@ -0,0 +1,26 @@
+package schemas
+
+import (
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+)
+
+// SchemaSourceRequest selects where one side of a comparison is read from:
+// a stored snapshot, an ad-hoc connection or the project's "source"/"target"
+// database, in that order of precedence
+type SchemaSourceRequest struct {
+	Side       string               `json:"side"`
+	Connection *DBConnectionRequest `json:"connection"`
+	SnapshotID *uint                `json:"snapshot_id"`
+}
+
+type MergeRequest struct {
+	Base   SchemaSourceRequest `json:"base" binding:"required"`
+	Ours   SchemaSourceRequest `json:"ours" binding:"required"`
+	Theirs SchemaSourceRequest `json:"theirs" binding:"required"`
+}
+
+type MergeResponse struct {
+	models.SchemaMerge
+	MigrationScript services.MigrationScript `json:"migration_script"`
+}
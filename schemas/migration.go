@@ -0,0 +1,48 @@
+package schemas
+
+import (
+	"time"
+
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+)
+
+// ApplyMigrationRequest is a migration script to run against a project's target
+type ApplyMigrationRequest struct {
+	Script    string `json:"script" binding:"required"`                      // Generated or edited SQL, statements separated by semicolons
+	Down      string `json:"down"`                                           // Script reverting this one, kept for rollbacks
+	Direction string `json:"direction" binding:"omitempty,oneof=left right"` // Comparison direction the script was generated for
+	AppliedBy string `json:"applied_by"`
+	DryRun    bool   `json:"dry_run"` // Run in a transaction that is rolled back, nothing is recorded
+	// Dry runs only
+	StatementTimeout int                  `json:"statement_timeout" binding:"omitempty,min=0"` // Milliseconds, 30000 when unset
+	Intended         *SchemaSourceRequest `json:"intended"`                                    // Schema the migration should produce, the project's source when unset
+}
+
+// ApplyMigrationResponse is the execution of an applied script and the
+// migration it was recorded as
+type ApplyMigrationResponse struct {
+	MigrationID uint `json:"migration_id"`
+	services.MigrationExecution
+}
+
+type MigrationResponse struct {
+	ID           uint       `json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ProjectID    uint       `json:"project_id"`
+	Direction    string     `json:"direction"`
+	Up           string     `json:"up"`
+	Down         string     `json:"down"`
+	Checksum     string     `json:"checksum"`
+	Status       string     `json:"status"`
+	AppliedAt    *time.Time `json:"applied_at"`
+	RolledBackAt *time.Time `json:"rolled_back_at"`
+	DurationMs   float64    `json:"duration_ms"`
+	AppliedBy    string     `json:"applied_by"`
+	Error        string     `json:"error,omitempty"`
+	SnapshotID   *uint      `json:"snapshot_id"`
+}
+
+// RollbackResponse lists the migrations rolled back, newest first
+type RollbackResponse struct {
+	Rollbacks []services.MigrationRollback `json:"rollbacks"`
+}
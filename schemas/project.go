@@ -16,10 +16,25 @@ type DBConnectionRequest struct {
 }
 
 type ProjectRequest struct {
-	Name        string              `json:"name" binding:"required"`
-	Description string              `json:"description"`
-	Source      DBConnectionRequest `json:"source" binding:"required"`
-	Target      DBConnectionRequest `json:"target" binding:"required"`
+	Name        string               `json:"name" binding:"required"`
+	Description string               `json:"description"`
+	Source      DBConnectionRequest  `json:"source" binding:"required"`
+	Target      DBConnectionRequest  `json:"target" binding:"required"`
+	Filters     models.ObjectFilter  `json:"filters"`
+	Scratch     *DBConnectionRequest `json:"scratch"`
+	LintRules   models.LintRules     `json:"lint_rules"`
+	Templates   models.DDLTemplates  `json:"templates"`
+	DriftConfigRequest
+	RiskPolicyRequest
+}
+
+type RiskPolicyRequest struct {
+	MaxRisk string `json:"max_risk" binding:"omitempty,oneof=safe caution destructive"`
+}
+
+type DriftConfigRequest struct {
+	DriftSchedule   string `json:"drift_schedule"`
+	DriftWebhookURL string `json:"drift_webhook_url" binding:"omitempty,url"`
 }
 
 type DBConnectionResponse struct {
@@ -33,16 +48,74 @@ type DBConnectionResponse struct {
 }
 
 type ProjectResponse struct {
-	ID          uint                 `json:"id"`
-	CreatedAt   time.Time            `json:"created_at"`
-	UpdatedAt   time.Time            `json:"updated_at"`
-	Name        string               `json:"name"`
-	Description string               `json:"description"`
-	Source      DBConnectionResponse `json:"source"`
-	Target      DBConnectionResponse `json:"target"`
+	ID              uint                  `json:"id"`
+	CreatedAt       time.Time             `json:"created_at"`
+	UpdatedAt       time.Time             `json:"updated_at"`
+	Name            string                `json:"name"`
+	Description     string                `json:"description"`
+	Source          DBConnectionResponse  `json:"source"`
+	Target          DBConnectionResponse  `json:"target"`
+	Filters         models.ObjectFilter   `json:"filters"`
+	DriftSchedule   string                `json:"drift_schedule"`
+	DriftWebhookURL string                `json:"drift_webhook_url"`
+	MaxRisk         string                `json:"max_risk"`
+	Scratch         *DBConnectionResponse `json:"scratch,omitempty"`
+	LintRules       models.LintRules      `json:"lint_rules"`
+	Templates       models.DDLTemplates   `json:"templates"`
 }
 
 type SchemaComparisonResponse struct {
-	Differences     models.SchemaDiff        `json:"differences"`
-	MigrationScript services.MigrationScript `json:"migration_script"`
+	Differences     models.SchemaDiff               `json:"differences"`
+	MigrationScript services.MigrationScript        `json:"migration_script"`
+	MigrationPlan   services.MigrationPlan          `json:"migration_plan"`
+	Policy          *RiskPolicyResult               `json:"policy,omitempty"`
+	Verification    *services.MigrationVerification `json:"verification,omitempty"`
+	LintFindings    []models.LintFinding            `json:"lint_findings"`
+	MigrationID     *uint                           `json:"migration_id,omitempty"` // Pending migration recorded with record=true
+}
+
+type LintRuleStatus struct {
+	services.LintRule
+	Enabled bool `json:"enabled"`
+}
+
+type LintResponse struct {
+	Rules    []LintRuleStatus     `json:"rules"`
+	Findings []models.LintFinding `json:"findings"`
+}
+
+type RiskPolicyResult struct {
+	MaxRisk    string              `json:"max_risk"`
+	Severity   string              `json:"severity"`
+	Passed     bool                `json:"passed"`
+	Violations []models.ChangeRisk `json:"violations"`
+}
+
+type SnapshotRequest struct {
+	Label string `json:"label" binding:"required"`
+	Side  string `json:"side" binding:"required,oneof=source target"`
+}
+
+type SnapshotResponse struct {
+	ID             uint            `json:"id"`
+	CreatedAt      time.Time       `json:"created_at"`
+	ProjectID      uint            `json:"project_id"`
+	DBConnectionID uint            `json:"db_connection_id"`
+	Side           string          `json:"side"`
+	Label          string          `json:"label"`
+	Dialect        string          `json:"dialect"`
+	Schemas        []models.Schema `json:"schemas,omitempty"`
+}
+
+type DriftEventResponse struct {
+	ID            uint              `json:"id"`
+	CreatedAt     time.Time         `json:"created_at"`
+	ProjectID     uint              `json:"project_id"`
+	HasDrift      bool              `json:"has_drift"`
+	Changed       bool              `json:"changed"`
+	Checksum      string            `json:"checksum"`
+	Diff          models.SchemaDiff `json:"diff"`
+	Error         string            `json:"error,omitempty"`
+	WebhookStatus int               `json:"webhook_status,omitempty"`
+	WebhookError  string            `json:"webhook_error,omitempty"`
 }
@@ -3,12 +3,16 @@ package services
 import (
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/Tsarbomba69-com/mammoth.server/models"
 	"gorm.io/gorm"
 )
 
+var dialectQueriesMu sync.RWMutex
+
 var dialectQueries = map[string]models.QuerySet{
 	"postgres": {
 		Schema: `
@@ -28,28 +32,33 @@ var dialectQueries = map[string]models.QuerySet{
 		`,
 		Column: `
 			SELECT 
+				c.table_schema,
 				c.table_name,
 				c.column_name,
 				c.data_type,
 				c.is_nullable,
 				EXISTS (
 					SELECT 1 FROM information_schema.key_column_usage k
-					WHERE k.table_name = c.table_name 
+					WHERE k.table_schema = c.table_schema
+					AND k.table_name = c.table_name 
 					AND k.column_name = c.column_name
 					AND k.constraint_name IN (
 						SELECT constraint_name 
 						FROM information_schema.table_constraints 
 						WHERE constraint_type = 'PRIMARY KEY'
+						AND table_schema = c.table_schema
+						AND table_name = c.table_name
 					)
 				) AS is_primary,
 				c.column_default AS default_value
 			FROM information_schema.columns c
 			WHERE c.table_schema NOT LIKE 'pg_%'
 			AND c.table_schema != 'information_schema'
-			ORDER BY c.table_name, c.ordinal_position
+			ORDER BY c.table_schema, c.table_name, c.ordinal_position
 		`,
 		Index: `
 			SELECT
+				n.nspname AS table_schema,
 				t.relname AS table_name,
 				i.relname AS index_name,
 				a.attname AS column_name,
@@ -59,21 +68,26 @@ var dialectQueries = map[string]models.QuerySet{
 				pg_class t,
 				pg_class i,
 				pg_index idx,
-				pg_attribute a
+				pg_attribute a,
+				pg_namespace n
 			WHERE
 				t.oid = idx.indrelid
 				AND i.oid = idx.indexrelid
 				AND a.attrelid = t.oid
 				AND a.attnum = ANY(idx.indkey)
 				AND t.relkind = 'r'
-				AND t.relnamespace = (SELECT oid FROM pg_namespace WHERE nspname = current_schema())
+				AND n.oid = t.relnamespace
+				AND n.nspname NOT LIKE 'pg_%'
+				AND n.nspname != 'information_schema'
 			ORDER BY
+				n.nspname,
 				t.relname,
 				i.relname,
 				array_position(idx.indkey, a.attnum)
 		`,
 		ForeignKey: `
 			SELECT
+				tc.table_schema,
 				tc.table_name,
 				tc.constraint_name,
 				kcu.column_name,
@@ -98,6 +112,7 @@ var dialectQueries = map[string]models.QuerySet{
 				AND tc.table_schema NOT LIKE 'pg_%' 
 				AND tc.table_schema != 'information_schema'
 			ORDER BY
+				tc.table_schema,
 				tc.table_name,
 				tc.constraint_name,
 				kcu.ordinal_position
@@ -131,8 +146,58 @@ var dialectQueries = map[string]models.QuerySet{
             JOIN pg_attribute attr ON attr.attrelid = tab.oid AND attr.attnum = dep.refobjsubid
             WHERE dep.deptype = 'a'
             AND seq.relkind = 'S'
-            AND seq_ns.nspname = current_schema()
+            AND seq_ns.nspname NOT LIKE 'pg_%'
+            AND seq_ns.nspname != 'information_schema'
         `,
+		Dependent: `
+			SELECT type, schema_name, name, arguments, definition, ref_schema, ref_name, column_name
+			FROM (
+				SELECT DISTINCT
+					CASE v.relkind WHEN 'm' THEN 'materialized view' ELSE 'view' END AS type,
+					vn.nspname AS schema_name,
+					v.relname AS name,
+					'' AS arguments,
+					pg_get_viewdef(v.oid) AS definition,
+					rn.nspname AS ref_schema,
+					r.relname AS ref_name,
+					a.attname AS column_name
+				FROM pg_depend d
+				JOIN pg_rewrite rw ON rw.oid = d.objid
+				JOIN pg_class v ON v.oid = rw.ev_class
+				JOIN pg_namespace vn ON vn.oid = v.relnamespace
+				JOIN pg_class r ON r.oid = d.refobjid
+				JOIN pg_namespace rn ON rn.oid = r.relnamespace
+				LEFT JOIN pg_attribute a ON a.attrelid = r.oid AND a.attnum = d.refobjsubid AND d.refobjsubid > 0
+				WHERE d.classid = 'pg_rewrite'::regclass
+				AND d.refclassid = 'pg_class'::regclass
+				AND d.deptype = 'n'
+				AND v.oid <> r.oid
+				AND vn.nspname NOT LIKE 'pg_%'
+				AND vn.nspname != 'information_schema'
+				UNION
+				SELECT DISTINCT
+					'function' AS type,
+					pn.nspname AS schema_name,
+					p.proname AS name,
+					pg_get_function_identity_arguments(p.oid) AS arguments,
+					pg_get_functiondef(p.oid) AS definition,
+					rn.nspname AS ref_schema,
+					r.relname AS ref_name,
+					a.attname AS column_name
+				FROM pg_depend d
+				JOIN pg_proc p ON p.oid = d.objid
+				JOIN pg_namespace pn ON pn.oid = p.pronamespace
+				JOIN pg_class r ON r.oid = d.refobjid
+				JOIN pg_namespace rn ON rn.oid = r.relnamespace
+				LEFT JOIN pg_attribute a ON a.attrelid = r.oid AND a.attnum = d.refobjsubid AND d.refobjsubid > 0
+				WHERE d.classid = 'pg_proc'::regclass
+				AND d.refclassid = 'pg_class'::regclass
+				AND d.deptype = 'n'
+				AND pn.nspname NOT LIKE 'pg_%'
+				AND pn.nspname != 'information_schema'
+			) dependents
+			ORDER BY schema_name, name, arguments, ref_schema, ref_name, column_name
+		`, // View dependencies come from their rewrite rules, function ones from SQL-standard bodies
 	},
 	"sqlite": {
 		Schema: `
@@ -140,7 +205,7 @@ var dialectQueries = map[string]models.QuerySet{
         UNION
         SELECT name AS schema_name
         FROM pragma_database_list
-        WHERE name != 'main'
+        WHERE name NOT IN ('main', 'temp') -- temp only holds objects of the current connection
         ORDER BY schema_name
 		`,
 		Table: `
@@ -157,6 +222,7 @@ var dialectQueries = map[string]models.QuerySet{
 		`,
 		Column: `
 			SELECT 
+				'main' AS table_schema,
 				m.name AS table_name,
 				p.name AS column_name,
 				p.type AS data_type,
@@ -170,6 +236,7 @@ var dialectQueries = map[string]models.QuerySet{
 		`,
 		Index: `
 			SELECT
+				'main' AS table_schema,
 				m.name AS table_name,
 				il.name AS index_name,
 				ii.name AS column_name,
@@ -183,6 +250,7 @@ var dialectQueries = map[string]models.QuerySet{
 		`,
 		ForeignKey: `
 			SELECT
+				'main' AS table_schema,
 				m.name AS table_name,
 				fk.id AS constraint_name,
 				fk."from" AS column_name,
@@ -222,6 +290,7 @@ var dialectQueries = map[string]models.QuerySet{
 		`,
 		Column: `
 			SELECT 
+				table_schema,
 				table_name,
 				column_name,
 				data_type,
@@ -234,6 +303,7 @@ var dialectQueries = map[string]models.QuerySet{
 		`,
 		Index: `
 			SELECT
+				table_schema,
 				table_name,
 				index_name,
 				column_name,
@@ -245,6 +315,7 @@ var dialectQueries = map[string]models.QuerySet{
 		`,
 		ForeignKey: `
 			SELECT
+				table_schema,
 				table_name,
 				constraint_name,
 				column_name,
@@ -283,19 +354,42 @@ var dialectQueries = map[string]models.QuerySet{
 	},
 }
 
-func DumpSchema(db *gorm.DB) ([]models.Schema, error) {
-	// Use channels for parallel execution
-	schemasChan := make(chan []models.Schema)
-	tablesChan := make(chan map[string][]struct{ Name, SchemaName string })
-	columnsChan := make(chan map[string][]models.Column)
-	indexesChan := make(chan map[string][]models.Index)
-	fksChan := make(chan map[string][]models.ForeignKey)
-	seqsChan := make(chan []models.Sequence)
-	errChan := make(chan error, 6)
+// DumpSchema introspects every schema of the database and normalizes it for the
+// database's dialect. When filters are given the objects they reject are left
+// out of the result.
+func DumpSchema(db *gorm.DB, filters ...models.ObjectFilter) ([]models.Schema, error) {
+	// Use channels for parallel execution, buffered so that goroutines still
+	// running when the dump returns early on an error do not block forever
+	schemasChan := make(chan []models.Schema, 1)
+	tablesChan := make(chan map[string][]struct{ Name, SchemaName string }, 1)
+	columnsChan := make(chan map[string][]models.Column, 1)
+	indexesChan := make(chan map[string][]models.Index, 1)
+	fksChan := make(chan map[string][]models.ForeignKey, 1)
+	seqsChan := make(chan []models.Sequence, 1)
+	depsChan := make(chan []models.Dependent, 1)
+	errChan := make(chan error, 7)
+
+	// A transaction holds a single connection, its queries cannot overlap
+	var serial sync.Mutex
+	_, inTransaction := db.Statement.ConnPool.(gorm.TxCommitter)
+	lock := func() func() {
+		if !inTransaction {
+			return func() {}
+		}
+		serial.Lock()
+		return serial.Unlock
+	}
+	introspecting := func(kind string) func() {
+		return StartPhase(db.Statement.Context, PhaseIntrospect+":"+kind)
+	}
 
 	// Launch goroutines for each metadata type
 	go func() {
+		unlock := lock()
+		done := introspecting("schemas")
 		schemas, err := getAllSchemas(db)
+		done()
+		unlock()
 		if err != nil {
 			errChan <- err
 			return
@@ -304,7 +398,11 @@ func DumpSchema(db *gorm.DB) ([]models.Schema, error) {
 	}()
 
 	go func() {
+		unlock := lock()
+		done := introspecting("tables")
 		tables, err := getAllTables(db)
+		done()
+		unlock()
 		if err != nil {
 			errChan <- err
 			return
@@ -313,7 +411,11 @@ func DumpSchema(db *gorm.DB) ([]models.Schema, error) {
 	}()
 
 	go func() {
+		unlock := lock()
+		done := introspecting("columns")
 		cols, err := getAllColumns(db)
+		done()
+		unlock()
 		if err != nil {
 			errChan <- err
 			return
@@ -322,7 +424,11 @@ func DumpSchema(db *gorm.DB) ([]models.Schema, error) {
 	}()
 
 	go func() {
+		unlock := lock()
+		done := introspecting("indexes")
 		idxs, err := getAllIndexes(db)
+		done()
+		unlock()
 		if err != nil {
 			errChan <- err
 			return
@@ -331,7 +437,11 @@ func DumpSchema(db *gorm.DB) ([]models.Schema, error) {
 	}()
 
 	go func() {
+		unlock := lock()
+		done := introspecting("foreign_keys")
 		fks, err := getAllForeignKeys(db)
+		done()
+		unlock()
 		if err != nil {
 			errChan <- err
 			return
@@ -340,7 +450,11 @@ func DumpSchema(db *gorm.DB) ([]models.Schema, error) {
 	}()
 
 	go func() {
+		unlock := lock()
+		done := introspecting("sequences")
 		seqs, err := getAllSequences(db)
+		done()
+		unlock()
 		if err != nil {
 			errChan <- err
 			return
@@ -348,6 +462,19 @@ func DumpSchema(db *gorm.DB) ([]models.Schema, error) {
 		seqsChan <- seqs
 	}()
 
+	go func() {
+		unlock := lock()
+		done := introspecting("dependents")
+		deps, err := getAllDependents(db)
+		done()
+		unlock()
+		if err != nil {
+			errChan <- err
+			return
+		}
+		depsChan <- deps
+	}()
+
 	// Collect results
 	var schemas []models.Schema
 	var tables map[string][]struct{ Name, SchemaName string }
@@ -355,8 +482,9 @@ func DumpSchema(db *gorm.DB) ([]models.Schema, error) {
 	var indexesByTable map[string][]models.Index
 	var fksByTable map[string][]models.ForeignKey
 	var sequences []models.Sequence
+	var dependents []models.Dependent
 
-	for i := 0; i < 6; i++ {
+	for i := 0; i < 7; i++ {
 		select {
 		case err := <-errChan:
 			return nil, err
@@ -372,26 +500,42 @@ func DumpSchema(db *gorm.DB) ([]models.Schema, error) {
 			schemas = ss
 		case seqs := <-seqsChan:
 			sequences = seqs
+		case deps := <-depsChan:
+			dependents = deps
 		}
 	}
 
 	// Build schemas
+	result := make([]models.Schema, 0, len(schemas))
 	for _, schema := range schemas {
 		schema.Tables = make([]models.TableSchema, 0, len(tables[schema.Name]))
-		schema.Sequences = sequences
+		for _, seq := range sequences {
+			if seq.SchemaName == schema.Name {
+				schema.Sequences = append(schema.Sequences, seq)
+			}
+		}
+		for _, dep := range dependents {
+			if dep.SchemaName == schema.Name {
+				schema.Dependents = append(schema.Dependents, dep)
+			}
+		}
 		for _, table := range tables[schema.Name] {
 			schema.Tables = append(schema.Tables, models.TableSchema{
 				Name:        table.Name,
 				SchemaName:  table.SchemaName,
-				Columns:     columnsByTable[table.Name],
-				Indexes:     indexesByTable[table.Name],
-				ForeignKeys: fksByTable[table.Name],
+				Columns:     columnsByTable[table.SchemaName+"."+table.Name],
+				Indexes:     indexesByTable[table.SchemaName+"."+table.Name],
+				ForeignKeys: fksByTable[table.SchemaName+"."+table.Name],
 			})
 		}
-		schemas = append(schemas, schema)
+		result = append(result, schema)
+	}
+
+	for _, filter := range filters {
+		result = FilterSchemas(result, filter)
 	}
 
-	return schemas, nil
+	return result, nil
 }
 
 func getAllSequences(db *gorm.DB) ([]models.Sequence, error) {
@@ -443,14 +587,93 @@ func getAllSequences(db *gorm.DB) ([]models.Sequence, error) {
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("error after reading sequence rows: %w", err)
 	}
-	// TODO: Implement sequence ownership query if needed
-	// if qs.SequenceOwnership != "" {
-	// 	panic("Sequence ownership query not implemented for this dialect")
-	// }
+
+	if qs.SequenceOwnership == "" {
+		return sequences, nil
+	}
+	var owners []struct {
+		SequenceSchema string
+		SequenceName   string
+		TableSchema    string
+		TableName      string
+		ColumnName     string
+	}
+	if err := db.Raw(qs.SequenceOwnership).Scan(&owners).Error; err != nil {
+		return nil, fmt.Errorf("failed to query sequence ownership: %w", err)
+	}
+	for _, owner := range owners {
+		for i := range sequences {
+			if sequences[i].SchemaName != owner.SequenceSchema || sequences[i].Name != owner.SequenceName {
+				continue
+			}
+			sequences[i].OwnedByTable = owner.TableName
+			if owner.TableSchema != owner.SequenceSchema {
+				sequences[i].OwnedByTable = owner.TableSchema + "." + owner.TableName
+			}
+			sequences[i].OwnedByColumn = owner.ColumnName
+		}
+	}
 
 	return sequences, nil
 }
 
+// getAllDependents reads the views and functions depending on tables or views,
+// for dialects that track such dependencies
+func getAllDependents(db *gorm.DB) ([]models.Dependent, error) {
+	qs, err := getQuerySet(db)
+	if err != nil {
+		return nil, err
+	}
+	if qs.Dependent == "" {
+		return nil, nil
+	}
+
+	var rows []struct {
+		Type       string
+		SchemaName string
+		Name       string
+		Arguments  string
+		Definition string
+		RefSchema  string
+		RefName    string
+		ColumnName *string
+	}
+
+	if err := db.Raw(qs.Dependent).Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to get dependent objects: %v", err)
+	}
+
+	var result []models.Dependent
+	positions := make(map[string]int)
+	for _, row := range rows {
+		key := row.Type + ":" + row.SchemaName + "." + row.Name + "(" + row.Arguments + ")"
+		pos, exists := positions[key]
+		if !exists {
+			pos = len(result)
+			positions[key] = pos
+			result = append(result, models.Dependent{
+				Type:       row.Type,
+				SchemaName: row.SchemaName,
+				Name:       row.Name,
+				Arguments:  row.Arguments,
+				Definition: row.Definition,
+			})
+		}
+
+		dep := &result[pos]
+		refs := len(dep.References)
+		if refs == 0 || dep.References[refs-1].SchemaName != row.RefSchema || dep.References[refs-1].Name != row.RefName {
+			dep.References = append(dep.References, models.DependentReference{SchemaName: row.RefSchema, Name: row.RefName})
+			refs++
+		}
+		if row.ColumnName != nil {
+			dep.References[refs-1].Columns = append(dep.References[refs-1].Columns, *row.ColumnName)
+		}
+	}
+
+	return result, nil
+}
+
 func getAllSchemas(db *gorm.DB) ([]models.Schema, error) {
 	qs, err := getQuerySet(db)
 	if err != nil {
@@ -495,10 +718,20 @@ func getAllTables(db *gorm.DB) (map[string][]struct{ Name, SchemaName string },
 	return result, nil
 }
 
-func CompareSchemas(source, target []models.Schema) models.SchemaDiff {
+// CompareSchemas computes the differences needed to turn source into target.
+// Both sides are compared in the dialect's normalized form, and when filters
+// are given they are filtered before comparing.
+func CompareSchemas(dialect string, source, target []models.Schema, filters ...models.ObjectFilter) models.SchemaDiff {
 	var diff models.SchemaDiff
 	diff.Summary = make(map[string]int)
 
+	source = Normalize(dialect, source)
+	target = Normalize(dialect, target)
+	for _, filter := range filters {
+		source = FilterSchemas(source, filter)
+		target = FilterSchemas(target, filter)
+	}
+
 	// Create maps for quick lookup
 	sourceSchemas := make(map[string]models.Schema)
 	targetSchemas := make(map[string]models.Schema)
@@ -510,106 +743,120 @@ func CompareSchemas(source, target []models.Schema) models.SchemaDiff {
 	for _, schema := range source {
 		sourceSchemas[schema.Name] = schema
 		for _, table := range schema.Tables {
-			sourceTables[table.Name] = table
+			sourceTables[table.SchemaName+"."+table.Name] = table
 		}
 
-		for _, table := range schema.Sequences {
-			sourceSeqs[table.Name] = table
+		for _, seq := range schema.Sequences {
+			sourceSeqs[seq.SchemaName+"."+seq.Name] = seq
 		}
 	}
 
 	for _, schema := range target {
 		targetSchemas[schema.Name] = schema
 		for _, table := range schema.Tables {
-			targetTables[table.Name] = table
+			targetTables[table.SchemaName+"."+table.Name] = table
 		}
 
-		for _, table := range schema.Sequences {
-			targetSeqs[table.Name] = table
+		for _, seq := range schema.Sequences {
+			targetSeqs[seq.SchemaName+"."+seq.Name] = seq
 		}
 	}
 
-	// Find added and removed schemas
-	for name, targetSchema := range targetSchemas {
-		if _, exists := sourceSchemas[name]; !exists {
-			diff.SchemasAdded = append(diff.SchemasAdded, targetSchema.Name)
+	schemaNames := sortedKeys(sourceSchemas, targetSchemas)
+	tableKeys := sortedKeys(sourceTables, targetTables)
+	seqKeys := sortedKeys(sourceSeqs, targetSeqs)
+	sortByQualifiedName(tableKeys, func(key string) (string, string) {
+		if table, exists := targetTables[key]; exists {
+			return table.SchemaName, table.Name
 		}
-	}
-
-	for name, sourceSchema := range sourceSchemas {
-		if _, exists := targetSchemas[name]; !exists {
-			diff.SchemasRemoved = append(diff.SchemasRemoved, sourceSchema.Name)
-		} else {
+		return sourceTables[key].SchemaName, sourceTables[key].Name
+	})
+	sortByQualifiedName(seqKeys, func(key string) (string, string) {
+		if seq, exists := targetSeqs[key]; exists {
+			return seq.SchemaName, seq.Name
+		}
+		return sourceSeqs[key].SchemaName, sourceSeqs[key].Name
+	})
+
+	// Find added, removed and unchanged schemas
+	for _, name := range schemaNames {
+		_, inSource := sourceSchemas[name]
+		_, inTarget := targetSchemas[name]
+		switch {
+		case !inSource:
+			diff.SchemasAdded = append(diff.SchemasAdded, name)
+		case !inTarget:
+			diff.SchemasRemoved = append(diff.SchemasRemoved, name)
+		default:
 			diff.SchemasSame = append(diff.SchemasSame, name)
 		}
 	}
 
-	// Find added and removed tables
-	for name, targetTable := range targetTables {
-		if _, exists := sourceTables[name]; !exists {
+	// Find added, removed and modified tables
+	for _, key := range tableKeys {
+		sourceTable, inSource := sourceTables[key]
+		targetTable, inTarget := targetTables[key]
+		switch {
+		case !inSource:
 			diff.TablesAdded = append(diff.TablesAdded, models.TableDiff{
-				Name:            name,
+				Name:            targetTable.Name,
 				SchemaName:      targetTable.SchemaName,
 				ColumnsAdded:    targetTable.Columns,
-				IndexesAdded:    targetTable.Indexes,
-				ForeignKeyAdded: targetTable.ForeignKeys,
+				IndexesAdded:    sortedByName(targetTable.Indexes, indexName),
+				ForeignKeyAdded: sortedByName(targetTable.ForeignKeys, foreignKeyName),
 			})
-		}
-	}
-
-	for name, sourceTable := range sourceTables {
-		if _, exists := targetTables[name]; !exists {
+		case !inTarget:
 			diff.TablesRemoved = append(diff.TablesRemoved, models.TableDiff{
-				Name:            name,
+				Name:            sourceTable.Name,
 				SchemaName:      sourceTable.SchemaName,
 				ColumnsAdded:    sourceTable.Columns,
-				IndexesAdded:    sourceTable.Indexes,
-				ForeignKeyAdded: sourceTable.ForeignKeys,
+				IndexesAdded:    sortedByName(sourceTable.Indexes, indexName),
+				ForeignKeyAdded: sortedByName(sourceTable.ForeignKeys, foreignKeyName),
 			})
-		}
-	}
-
-	// Compare tables that exist in both schemas
-	for name, sourceTable := range sourceTables {
-		if targetTable, exists := targetTables[name]; exists {
+		default:
 			tableDiff := compareTables(sourceTable, targetTable)
 			if len(tableDiff.ColumnsAdded) > 0 || len(tableDiff.ColumnsRemoved) > 0 ||
 				len(tableDiff.ColumnsModified) > 0 || len(tableDiff.IndexesAdded) > 0 ||
 				len(tableDiff.IndexesRemoved) > 0 || len(tableDiff.IndexesModified) > 0 ||
-				len(tableDiff.ForeignKeyAdded) > 0 || len(tableDiff.ForeignKeyModified) > 0 {
+				len(tableDiff.ForeignKeyAdded) > 0 || len(tableDiff.ForeignKeyRemoved) > 0 ||
+				len(tableDiff.ForeignKeyModified) > 0 {
 				diff.TablesModified = append(diff.TablesModified, tableDiff)
 			} else {
-				diff.TablesSame = append(diff.TablesSame, name)
+				diff.TablesSame = append(diff.TablesSame, sourceTable.Name)
 			}
 		}
 	}
 
-	// Find added and removed schemas
-	for name, targetSeq := range targetSeqs {
-		if _, exists := sourceSeqs[name]; !exists {
+	// Find added, removed and modified sequences
+	for _, key := range seqKeys {
+		sourceSeq, inSource := sourceSeqs[key]
+		targetSeq, inTarget := targetSeqs[key]
+		switch {
+		case !inSource:
 			diff.SequencesAdded = append(diff.SequencesAdded, targetSeq)
-		}
-	}
-
-	for name, sourceSeq := range sourceSeqs {
-		if _, exists := targetSeqs[name]; !exists {
+		case !inTarget:
 			diff.SequencesRemoved = append(diff.SequencesRemoved, sourceSeq)
-		}
-	}
-
-	// Compare sequences that exist in both schemas
-	for name, sourceSeq := range sourceSeqs {
-		if targetSeq, exists := targetSeqs[name]; exists {
+		default:
 			var seqDiff = compareSequences(sourceSeq, targetSeq)
 			if seqDiff.ChangedAttr != nil {
 				diff.SequencesModified = append(diff.SequencesModified, seqDiff)
 			} else {
-				diff.SequencesSame = append(diff.SequencesSame, name)
+				diff.SequencesSame = append(diff.SequencesSame, sourceSeq.Name)
 			}
 		}
 	}
 
-	// Generate summary
+	diff.Dependents = affectedDependents(source, diff)
+
+	summarize(&diff)
+	return diff
+}
+
+// summarize fills the summary counters and risk annotations of the diff
+func summarize(diff *models.SchemaDiff) {
+	if diff.Summary == nil {
+		diff.Summary = make(map[string]int)
+	}
 	diff.Summary["tables_added"] = len(diff.TablesAdded)
 	diff.Summary["tables_removed"] = len(diff.TablesRemoved)
 	diff.Summary["tables_modified"] = len(diff.TablesModified)
@@ -620,7 +867,7 @@ func CompareSchemas(source, target []models.Schema) models.SchemaDiff {
 	diff.Summary["sequences_removed"] = len(diff.SequencesRemoved)
 	diff.Summary["sequences_modified"] = len(diff.SequencesModified)
 	diff.Summary["sequences_same"] = len(diff.SequencesSame)
-	return diff
+	classifyRisks(diff)
 }
 
 func compareSequences(source, target models.Sequence) models.SequenceChange {
@@ -678,46 +925,45 @@ func compareTables(source, target models.TableSchema) models.TableDiff {
 		targetColumns[col.Name] = col
 	}
 
-	// Find added and removed columns
-	for name, col := range targetColumns {
-		if _, exists := sourceColumns[name]; !exists {
+	// Find added columns, keeping their ordinal position in the target
+	for _, col := range target.Columns {
+		if _, exists := sourceColumns[col.Name]; !exists {
 			diff.ColumnsAdded = append(diff.ColumnsAdded, col)
 		}
 	}
 
-	for name, col := range sourceColumns {
-		if _, exists := targetColumns[name]; !exists {
-			diff.ColumnsRemoved = append(diff.ColumnsRemoved, col)
+	// Find removed and modified columns, keeping their ordinal position in the source
+	for _, sourceCol := range source.Columns {
+		name := sourceCol.Name
+		targetCol, exists := targetColumns[name]
+		if !exists {
+			diff.ColumnsRemoved = append(diff.ColumnsRemoved, sourceCol)
+			continue
 		}
-	}
 
-	// Compare columns that exist in both
-	for name, sourceCol := range sourceColumns {
-		if targetCol, exists := targetColumns[name]; exists {
-			if !reflect.DeepEqual(sourceCol, targetCol) {
-				var changed []string
-				if sourceCol.DataType != targetCol.DataType {
-					changed = append(changed, "data_type")
-				}
-				if sourceCol.IsNullable != targetCol.IsNullable {
-					changed = append(changed, "is_nullable")
-				}
-				if sourceCol.IsPrimary != targetCol.IsPrimary {
-					changed = append(changed, "is_primary")
-				}
-				if sourceCol.Default != targetCol.Default {
-					changed = append(changed, "default")
-				}
-
-				diff.ColumnsModified = append(diff.ColumnsModified, models.ColumnChange{
-					Name:        name,
-					Source:      sourceCol,
-					Target:      targetCol,
-					ChangedAttr: changed,
-				})
-			} else {
-				diff.ColumnsSame = append(diff.ColumnsSame, sourceCol)
-			}
+		var changed []string
+		if sourceCol.DataType != targetCol.DataType {
+			changed = append(changed, "data_type")
+		}
+		if sourceCol.IsNullable != targetCol.IsNullable {
+			changed = append(changed, "is_nullable")
+		}
+		if sourceCol.IsPrimary != targetCol.IsPrimary {
+			changed = append(changed, "is_primary")
+		}
+		if sourceCol.ComparedDefault() != targetCol.ComparedDefault() {
+			changed = append(changed, "default")
+		}
+
+		if len(changed) > 0 {
+			diff.ColumnsModified = append(diff.ColumnsModified, models.ColumnChange{
+				Name:        name,
+				Source:      sourceCol,
+				Target:      targetCol,
+				ChangedAttr: changed,
+			})
+		} else {
+			diff.ColumnsSame = append(diff.ColumnsSame, sourceCol)
 		}
 	}
 
@@ -733,43 +979,34 @@ func compareTables(source, target models.TableSchema) models.TableDiff {
 		targetIndexes[idx.Name] = idx
 	}
 
-	// Find added and removed indexes
-	for name, idx := range targetIndexes {
-		if _, exists := sourceIndexes[name]; !exists {
-			diff.IndexesAdded = append(diff.IndexesAdded, idx)
-		}
-	}
-
-	for name, idx := range sourceIndexes {
-		if _, exists := targetIndexes[name]; !exists {
-			diff.IndexesRemoved = append(diff.IndexesRemoved, idx)
-		}
-	}
-
-	// Compare indexes that exist in both
-	for name, sourceIdx := range sourceIndexes {
-		if targetIdx, exists := targetIndexes[name]; exists {
-			if !reflect.DeepEqual(sourceIdx, targetIdx) {
-				var changed []string
-				if !stringSlicesEqual(sourceIdx.Columns, targetIdx.Columns) {
-					changed = append(changed, "columns")
-				}
-				if sourceIdx.IsUnique != targetIdx.IsUnique {
-					changed = append(changed, "is_unique")
-				}
-				if sourceIdx.IsPrimary != targetIdx.IsPrimary {
-					changed = append(changed, "is_primary")
-				}
-
-				diff.IndexesModified = append(diff.IndexesModified, models.IndexChange{
-					Name:        name,
-					Source:      sourceIdx,
-					Target:      targetIdx,
-					ChangedAttr: changed,
-				})
-			} else {
-				diff.IndexesSame = append(diff.IndexesSame, sourceIdx)
+	for _, name := range sortedKeys(sourceIndexes, targetIndexes) {
+		sourceIdx, inSource := sourceIndexes[name]
+		targetIdx, inTarget := targetIndexes[name]
+		switch {
+		case !inSource:
+			diff.IndexesAdded = append(diff.IndexesAdded, targetIdx)
+		case !inTarget:
+			diff.IndexesRemoved = append(diff.IndexesRemoved, sourceIdx)
+		case !reflect.DeepEqual(sourceIdx, targetIdx):
+			var changed []string
+			if !stringSlicesEqual(sourceIdx.Columns, targetIdx.Columns) {
+				changed = append(changed, "columns")
 			}
+			if sourceIdx.IsUnique != targetIdx.IsUnique {
+				changed = append(changed, "is_unique")
+			}
+			if sourceIdx.IsPrimary != targetIdx.IsPrimary {
+				changed = append(changed, "is_primary")
+			}
+
+			diff.IndexesModified = append(diff.IndexesModified, models.IndexChange{
+				Name:        name,
+				Source:      sourceIdx,
+				Target:      targetIdx,
+				ChangedAttr: changed,
+			})
+		default:
+			diff.IndexesSame = append(diff.IndexesSame, sourceIdx)
 		}
 	}
 
@@ -785,55 +1022,107 @@ func compareTables(source, target models.TableSchema) models.TableDiff {
 		targetForeignKeys[idx.Name] = idx
 	}
 
-	// Find added and removed ForeignKeys
-	for name, idx := range targetForeignKeys {
-		if _, exists := sourceForeignKeys[name]; !exists {
-			diff.ForeignKeyAdded = append(diff.ForeignKeyAdded, idx)
+	for _, name := range sortedKeys(sourceForeignKeys, targetForeignKeys) {
+		sourceFk, inSource := sourceForeignKeys[name]
+		targetFk, inTarget := targetForeignKeys[name]
+		switch {
+		case !inSource:
+			diff.ForeignKeyAdded = append(diff.ForeignKeyAdded, targetFk)
+		case !inTarget:
+			diff.ForeignKeyRemoved = append(diff.ForeignKeyRemoved, sourceFk)
+		case !reflect.DeepEqual(sourceFk, targetFk):
+			var changed []string
+			if !stringSlicesEqual(sourceFk.Columns, targetFk.Columns) {
+				changed = append(changed, "columns")
+			}
+			if sourceFk.Name != targetFk.Name {
+				changed = append(changed, "name")
+			}
+			if sourceFk.OnDelete != targetFk.OnDelete {
+				changed = append(changed, "on_delete")
+			}
+			if sourceFk.OnUpdate != targetFk.OnUpdate {
+				changed = append(changed, "on_update")
+			}
+			if sourceFk.ReferencedTable != targetFk.ReferencedTable {
+				changed = append(changed, "referenced_table")
+			}
+
+			diff.ForeignKeyModified = append(diff.ForeignKeyModified, models.ForeignKeyChange{
+				Name:        name,
+				Source:      sourceFk,
+				Target:      targetFk,
+				ChangedAttr: changed,
+			})
+		default:
+			diff.ForeignKeysSame = append(diff.ForeignKeysSame, sourceFk)
 		}
 	}
 
-	for name, idx := range sourceForeignKeys {
-		if _, exists := targetForeignKeys[name]; !exists {
-			diff.ForeignKeyRemoved = append(diff.ForeignKeyRemoved, idx)
+	return diff
+}
+
+// sortedKeys returns the union of the keys of both maps in ascending order
+func sortedKeys[V any](source, target map[string]V) []string {
+	seen := make(map[string]bool, len(source)+len(target))
+	keys := make([]string, 0, len(source)+len(target))
+	for _, m := range []map[string]V{source, target} {
+		for key := range m {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
 		}
 	}
+	sort.Strings(keys)
+	return keys
+}
 
-	// Compare ForeignKeys that exist in both
-	for name, sourceFk := range sourceForeignKeys {
-		if targetFk, exists := targetForeignKeys[name]; exists {
-			if !reflect.DeepEqual(sourceFk, targetFk) {
-				var changed []string
-				if !stringSlicesEqual(sourceFk.Columns, targetFk.Columns) {
-					changed = append(changed, "columns")
-				}
-				if sourceFk.Name != targetFk.Name {
-					changed = append(changed, "name")
-				}
-				if sourceFk.OnDelete != targetFk.OnDelete {
-					changed = append(changed, "on_delete")
-				}
-				if sourceFk.OnUpdate != targetFk.OnUpdate {
-					changed = append(changed, "on_update")
-				}
-				if sourceFk.ReferencedTable != targetFk.ReferencedTable {
-					changed = append(changed, "referenced_table")
-				}
-
-				diff.ForeignKeyModified = append(diff.ForeignKeyModified, models.ForeignKeyChange{
-					Name:        name,
-					Source:      sourceFk,
-					Target:      targetFk,
-					ChangedAttr: changed,
-				})
-			} else {
-				diff.ForeignKeysSame = append(diff.ForeignKeysSame, sourceFk)
-			}
+// sortByQualifiedName orders keys by the schema and then the name they refer to
+func sortByQualifiedName(keys []string, nameOf func(key string) (string, string)) {
+	sort.SliceStable(keys, func(i, j int) bool {
+		si, ni := nameOf(keys[i])
+		sj, nj := nameOf(keys[j])
+		if si != sj {
+			return si < sj
 		}
+		return ni < nj
+	})
+}
+
+// sortedByName returns a copy of the items ordered by name
+func sortedByName[T any](items []T, nameOf func(T) string) []T {
+	if items == nil {
+		return nil
 	}
+	sorted := append([]T(nil), items...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return nameOf(sorted[i]) < nameOf(sorted[j])
+	})
+	return sorted
+}
 
-	return diff
+// sortedByQualifiedName returns a copy of the items ordered by schema and then name
+func sortedByQualifiedName[T any](items []T, nameOf func(T) (string, string)) []T {
+	if items == nil {
+		return nil
+	}
+	sorted := append([]T(nil), items...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		si, ni := nameOf(sorted[i])
+		sj, nj := nameOf(sorted[j])
+		if si != sj {
+			return si < sj
+		}
+		return ni < nj
+	})
+	return sorted
 }
 
+func indexName(idx models.Index) string { return idx.Name }
+
+func foreignKeyName(fk models.ForeignKey) string { return fk.Name }
+
 func stringSlicesEqual(a, b []string) bool {
 	if len(a) != len(b) {
 		return false
@@ -869,6 +1158,7 @@ func GetForeignKeys(db *gorm.DB, tableName string) ([]models.ForeignKey, error)
 	}()
 
 	constraintMap := map[string]*models.ForeignKey{}
+	var order []string
 
 	for rows.Next() {
 		var name, column, refTable, refColumn, onUpdate, onDelete string
@@ -883,6 +1173,7 @@ func GetForeignKeys(db *gorm.DB, tableName string) ([]models.ForeignKey, error)
 				OnUpdate:        onUpdate,
 				OnDelete:        onDelete,
 			}
+			order = append(order, name)
 		}
 		info := constraintMap[name]
 		info.Columns = append(info.Columns, column)
@@ -890,8 +1181,8 @@ func GetForeignKeys(db *gorm.DB, tableName string) ([]models.ForeignKey, error)
 	}
 
 	var result []models.ForeignKey
-	for _, fk := range constraintMap {
-		result = append(result, *fk)
+	for _, name := range order {
+		result = append(result, *constraintMap[name])
 	}
 
 	return result, nil
@@ -904,6 +1195,7 @@ func getAllColumns(db *gorm.DB) (map[string][]models.Column, error) {
 	}
 
 	var columns []struct {
+		TableSchema  string
 		TableName    string
 		ColumnName   string
 		DataType     string
@@ -923,7 +1215,8 @@ func getAllColumns(db *gorm.DB) (map[string][]models.Column, error) {
 			defaultValue = *c.DefaultValue
 		}
 
-		result[c.TableName] = append(result[c.TableName], models.Column{
+		key := c.TableSchema + "." + c.TableName
+		result[key] = append(result[key], models.Column{
 			Name:       c.ColumnName,
 			DataType:   c.DataType,
 			IsNullable: c.IsNullable == "YES",
@@ -934,7 +1227,8 @@ func getAllColumns(db *gorm.DB) (map[string][]models.Column, error) {
 	return result, nil
 }
 
-func getQuerySet(db *gorm.DB) (models.QuerySet, error) {
+// dialectName maps the gorm driver name to the dialect key used by the services
+func dialectName(db *gorm.DB) string {
 	dialect := db.Name()
 
 	// Normalize dialect names
@@ -947,7 +1241,28 @@ func getQuerySet(db *gorm.DB) (models.QuerySet, error) {
 		dialect = "mysql"
 	}
 
+	return dialect
+}
+
+// RegisterQuerySet installs (or replaces) the introspection queries used for
+// a dialect
+func RegisterQuerySet(dialect string, qs models.QuerySet) {
+	dialectQueriesMu.Lock()
+	defer dialectQueriesMu.Unlock()
+	dialectQueries[dialect] = qs
+}
+
+// QuerySetFor returns the introspection queries of a dialect
+func QuerySetFor(dialect string) (models.QuerySet, bool) {
+	dialectQueriesMu.RLock()
+	defer dialectQueriesMu.RUnlock()
 	qs, ok := dialectQueries[dialect]
+	return qs, ok
+}
+
+func getQuerySet(db *gorm.DB) (models.QuerySet, error) {
+	dialect := dialectName(db)
+	qs, ok := QuerySetFor(dialect)
 	if !ok {
 		return models.QuerySet{}, fmt.Errorf("unsupported database dialect: %s", dialect)
 	}
@@ -962,11 +1277,12 @@ func getAllIndexes(db *gorm.DB) (map[string][]models.Index, error) {
 	}
 
 	var indexes []struct {
-		TableName  string
-		IndexName  string
-		ColumnName string
-		IsUnique   bool
-		IsPrimary  bool
+		TableSchema string
+		TableName   string
+		IndexName   string
+		ColumnName  string
+		IsUnique    bool
+		IsPrimary   bool
 	}
 
 	if err := db.Raw(qs.Index).Scan(&indexes).Error; err != nil {
@@ -975,29 +1291,32 @@ func getAllIndexes(db *gorm.DB) (map[string][]models.Index, error) {
 
 	result := make(map[string][]models.Index)
 	indexMap := make(map[string]map[string]*models.Index)
+	indexOrder := make(map[string][]string) // Preserves the query order per table
 
 	for _, idx := range indexes {
-		if _, exists := indexMap[idx.TableName]; !exists {
-			indexMap[idx.TableName] = make(map[string]*models.Index)
+		table := idx.TableSchema + "." + idx.TableName
+		if _, exists := indexMap[table]; !exists {
+			indexMap[table] = make(map[string]*models.Index)
 		}
 
-		if _, exists := indexMap[idx.TableName][idx.IndexName]; !exists {
-			indexMap[idx.TableName][idx.IndexName] = &models.Index{
+		if _, exists := indexMap[table][idx.IndexName]; !exists {
+			indexMap[table][idx.IndexName] = &models.Index{
 				Name:      idx.IndexName,
 				IsUnique:  idx.IsUnique,
 				IsPrimary: idx.IsPrimary,
 			}
+			indexOrder[table] = append(indexOrder[table], idx.IndexName)
 		}
 
-		indexMap[idx.TableName][idx.IndexName].Columns = append(
-			indexMap[idx.TableName][idx.IndexName].Columns,
+		indexMap[table][idx.IndexName].Columns = append(
+			indexMap[table][idx.IndexName].Columns,
 			idx.ColumnName,
 		)
 	}
 
-	for tableName, indexes := range indexMap {
-		for _, index := range indexes {
-			result[tableName] = append(result[tableName], *index)
+	for table, names := range indexOrder {
+		for _, name := range names {
+			result[table] = append(result[table], *indexMap[table][name])
 		}
 	}
 
@@ -1011,6 +1330,7 @@ func getAllForeignKeys(db *gorm.DB) (map[string][]models.ForeignKey, error) {
 	}
 
 	var fks []struct {
+		TableSchema    string
 		TableName      string
 		ConstraintName string
 		ColumnName     string
@@ -1026,39 +1346,42 @@ func getAllForeignKeys(db *gorm.DB) (map[string][]models.ForeignKey, error) {
 
 	result := make(map[string][]models.ForeignKey)
 	fkMap := make(map[string]map[string]*models.ForeignKey)
+	fkOrder := make(map[string][]string) // Preserves the query order per table
 
 	for _, fk := range fks {
-		if _, exists := fkMap[fk.TableName]; !exists {
-			fkMap[fk.TableName] = make(map[string]*models.ForeignKey)
+		table := fk.TableSchema + "." + fk.TableName
+		if _, exists := fkMap[table]; !exists {
+			fkMap[table] = make(map[string]*models.ForeignKey)
 		}
 
-		if _, exists := fkMap[fk.TableName][fk.ConstraintName]; !exists {
-			fkMap[fk.TableName][fk.ConstraintName] = &models.ForeignKey{
+		if _, exists := fkMap[table][fk.ConstraintName]; !exists {
+			fkMap[table][fk.ConstraintName] = &models.ForeignKey{
 				Name:            fk.ConstraintName,
 				ReferencedTable: fk.ForeignTable,
 				OnDelete:        fk.OnDelete,
 				OnUpdate:        fk.OnUpdate,
 			}
+			fkOrder[table] = append(fkOrder[table], fk.ConstraintName)
 		}
 
-		if !contains(fkMap[fk.TableName][fk.ConstraintName].Columns, fk.ColumnName) {
-			fkMap[fk.TableName][fk.ConstraintName].Columns = append(
-				fkMap[fk.TableName][fk.ConstraintName].Columns,
+		if !contains(fkMap[table][fk.ConstraintName].Columns, fk.ColumnName) {
+			fkMap[table][fk.ConstraintName].Columns = append(
+				fkMap[table][fk.ConstraintName].Columns,
 				fk.ColumnName,
 			)
 		}
 
-		if !contains(fkMap[fk.TableName][fk.ConstraintName].ReferencedColumns, fk.ForeignColumn) {
-			fkMap[fk.TableName][fk.ConstraintName].ReferencedColumns = append(
-				fkMap[fk.TableName][fk.ConstraintName].ReferencedColumns,
+		if !contains(fkMap[table][fk.ConstraintName].ReferencedColumns, fk.ForeignColumn) {
+			fkMap[table][fk.ConstraintName].ReferencedColumns = append(
+				fkMap[table][fk.ConstraintName].ReferencedColumns,
 				fk.ForeignColumn,
 			)
 		}
 	}
 
-	for tableName, constraints := range fkMap {
-		for _, constraint := range constraints {
-			result[tableName] = append(result[tableName], *constraint)
+	for table, names := range fkOrder {
+		for _, name := range names {
+			result[table] = append(result[table], *fkMap[table][name])
 		}
 	}
 
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+)
+
+// dependentKey identifies a dependent; functions are qualified by their arguments
+func dependentKey(dep models.Dependent) string {
+	if dep.Type == "function" {
+		return dep.SchemaName + "." + dep.Name + "(" + dep.Arguments + ")"
+	}
+	return dep.SchemaName + "." + dep.Name
+}
+
+// affectedDependents returns the source dependents that use a removed table,
+// a removed column or a column whose type changes, directly or through other
+// affected views. PostgreSQL refuses such changes while the dependents exist.
+func affectedDependents(source []models.Schema, diff models.SchemaDiff) []models.Dependent {
+	var all []models.Dependent
+	seen := make(map[string]bool)
+	for _, schema := range source {
+		for _, dep := range schema.Dependents {
+			if key := dependentKey(dep); !seen[key] {
+				seen[key] = true
+				all = append(all, dep)
+			}
+		}
+	}
+	if len(all) == 0 {
+		return nil
+	}
+
+	removed, changed := changedRelations(diff, true)
+	affected := make(map[string]bool)
+	for found := true; found; {
+		found = false
+		for _, dep := range all {
+			key := dependentKey(dep)
+			if !affected[key] && usesAny(dep, removed, changed, affected) {
+				affected[key] = true
+				found = true
+			}
+		}
+	}
+
+	var result []models.Dependent
+	for _, dep := range all {
+		if affected[dependentKey(dep)] {
+			result = append(result, dep)
+		}
+	}
+	return result
+}
+
+// changedRelations lists the removed tables and the removed columns (plus the
+// columns whose type changes when withTypeChanges is set), keyed by qualified name
+func changedRelations(diff models.SchemaDiff, withTypeChanges bool) (tables, columns map[string]bool) {
+	tables = make(map[string]bool)
+	columns = make(map[string]bool)
+	for _, table := range diff.TablesRemoved {
+		tables[table.SchemaName+"."+table.Name] = true
+	}
+	for _, table := range diff.TablesModified {
+		prefix := table.SchemaName + "." + table.Name + "."
+		for _, col := range table.ColumnsRemoved {
+			columns[prefix+col.Name] = true
+		}
+		if !withTypeChanges {
+			continue
+		}
+		for _, change := range table.ColumnsModified {
+			if contains(change.ChangedAttr, "data_type") {
+				columns[prefix+change.Name] = true
+			}
+		}
+	}
+	return tables, columns
+}
+
+// usesAny reports whether the dependent references one of the given tables,
+// columns or dependents
+func usesAny(dep models.Dependent, tables, columns, dependents map[string]bool) bool {
+	for _, ref := range dep.References {
+		relation := ref.SchemaName + "." + ref.Name
+		if tables[relation] || dependents[relation] {
+			return true
+		}
+		for _, col := range ref.Columns {
+			if columns[relation+"."+col] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// brokenDependents returns the keys of the affected dependents that cannot be
+// recreated after the migration because an object they use is removed
+func brokenDependents(diff models.SchemaDiff) map[string]bool {
+	removed, columns := changedRelations(diff, false)
+	broken := make(map[string]bool)
+	for found := true; found; {
+		found = false
+		for _, dep := range diff.Dependents {
+			key := dependentKey(dep)
+			if !broken[key] && usesAny(dep, removed, columns, broken) {
+				broken[key] = true
+				found = true
+			}
+		}
+	}
+	return broken
+}
+
+// qualifiedTable resolves a possibly unqualified table name against a schema
+func qualifiedTable(schemaName, table string) string {
+	if strings.Contains(table, ".") {
+		return table
+	}
+	return schemaName + "." + table
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+)
+
+// Scheduler is the drift scheduler started by the server, nil when not running
+var Scheduler *DriftScheduler
+
+// DriftDetector computes the drift of a project, i.e. the diff from the
+// expected (source) schema to the actual (target) one
+type DriftDetector func(project models.Project) (models.SchemaDiff, error)
+
+// DriftWebhookPayload is the body posted to a project's drift webhook
+type DriftWebhookPayload struct {
+	ProjectID   uint           `json:"project_id"`
+	ProjectName string         `json:"project_name"`
+	EventID     uint           `json:"event_id"`
+	HasDrift    bool           `json:"has_drift"`
+	Changed     bool           `json:"changed"`
+	Summary     map[string]int `json:"summary"`
+	CheckedAt   time.Time      `json:"checked_at"`
+}
+
+// DriftScheduler runs drift detection for every project with a drift schedule
+type DriftScheduler struct {
+	db      *gorm.DB
+	cron    *cron.Cron
+	detect  DriftDetector
+	client  *http.Client
+	mu      sync.Mutex
+	entries map[uint]cron.EntryID
+}
+
+// NewDriftScheduler creates a scheduler storing its events in db. A nil
+// detector compares the project's live databases.
+func NewDriftScheduler(db *gorm.DB, detect DriftDetector) *DriftScheduler {
+	if detect == nil {
+		detect = DetectDrift
+	}
+	return &DriftScheduler{
+		db:      db,
+		cron:    cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.DefaultLogger))), // A slow detection skips the next ticks
+		detect:  detect,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		entries: make(map[uint]cron.EntryID),
+	}
+}
+
+// ValidateCron checks a drift schedule expression
+func ValidateCron(expr string) error {
+	if _, err := cron.ParseStandard(expr); err != nil {
+		return fmt.Errorf("invalid cron expression %q: %v", expr, err)
+	}
+	return nil
+}
+
+// Start registers every scheduled project and starts the cron loop
+func (s *DriftScheduler) Start() error {
+	var projects []models.Project
+	if err := s.db.Where("drift_schedule <> ''").Find(&projects).Error; err != nil {
+		return fmt.Errorf("failed to load scheduled projects: %w", err)
+	}
+
+	for _, project := range projects {
+		if err := s.Schedule(project); err != nil {
+			log.Printf("drift: skipping project %d: %v", project.ID, err)
+		}
+	}
+
+	s.cron.Start()
+	return nil
+}
+
+// Stop halts the cron loop and waits for running detections
+func (s *DriftScheduler) Stop() {
+	<-s.cron.Stop().Done()
+}
+
+// Schedule (re)registers the project's drift schedule, removing it when empty
+func (s *DriftScheduler) Schedule(project models.Project) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id, exists := s.entries[project.ID]; exists {
+		s.cron.Remove(id)
+		delete(s.entries, project.ID)
+	}
+
+	if project.DriftSchedule == "" {
+		return nil
+	}
+
+	projectID := project.ID
+	id, err := s.cron.AddFunc(project.DriftSchedule, func() {
+		if _, err := s.Run(projectID); err != nil {
+			log.Printf("drift: project %d: %v", projectID, err)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("invalid cron expression %q: %v", project.DriftSchedule, err)
+	}
+
+	s.entries[project.ID] = id
+	return nil
+}
+
+// Run performs one drift detection for the project, stores the event and
+// fires the webhook when there is drift or the drift changed since last run
+func (s *DriftScheduler) Run(projectID uint) (models.DriftEvent, error) {
+	var project models.Project
+	if err := s.db.Preload("Source").Preload("Target").First(&project, projectID).Error; err != nil {
+		return models.DriftEvent{}, fmt.Errorf("failed to load project: %w", err)
+	}
+
+	var previous models.DriftEvent
+	hasPrevious := s.db.Where("project_id = ? AND error = ''", project.ID).
+		Order("id DESC").Limit(1).Find(&previous).RowsAffected > 0
+
+	event := models.DriftEvent{ProjectID: project.ID}
+	diff, err := s.detect(project)
+	if err != nil {
+		event.Error = err.Error()
+	} else {
+		event.Diff = diff
+		event.HasDrift = diff.HasChanges()
+		event.Checksum = DiffChecksum(diff)
+		if hasPrevious {
+			event.Changed = event.Checksum != previous.Checksum
+		} else {
+			event.Changed = event.HasDrift
+		}
+	}
+
+	if err := s.db.Create(&event).Error; err != nil {
+		return event, fmt.Errorf("failed to store drift event: %w", err)
+	}
+
+	if event.Error == "" && project.DriftWebhookURL != "" && (event.HasDrift || event.Changed) {
+		event.WebhookStatus, err = s.notify(project, event)
+		if err != nil {
+			event.WebhookError = err.Error()
+		}
+		s.db.Model(&event).Select("WebhookStatus", "WebhookError").Updates(&event)
+	}
+
+	return event, nil
+}
+
+func (s *DriftScheduler) notify(project models.Project, event models.DriftEvent) (int, error) {
+	body, err := json.Marshal(DriftWebhookPayload{
+		ProjectID:   project.ID,
+		ProjectName: project.Name,
+		EventID:     event.ID,
+		HasDrift:    event.HasDrift,
+		Changed:     event.Changed,
+		Summary:     event.Diff.Summary,
+		CheckedAt:   event.CreatedAt,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := s.client.Post(project.DriftWebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// DetectDrift compares the project's live source (expected) and target (actual) databases
+func DetectDrift(project models.Project) (models.SchemaDiff, error) {
+	source, target, err := project.ConnectForProject()
+	if err != nil {
+		return models.SchemaDiff{}, err
+	}
+	defer models.Close(source)
+	defer models.Close(target)
+
+	sourceSchema, err := DumpSchema(source, project.Filters)
+	if err != nil {
+		return models.SchemaDiff{}, err
+	}
+
+	targetSchema, err := DumpSchema(target, project.Filters)
+	if err != nil {
+		return models.SchemaDiff{}, err
+	}
+
+	return CompareSchemas(dialectName(target), sourceSchema, targetSchema), nil
+}
+
+// DiffChecksum hashes the changes of a diff, ignoring unchanged objects
+func DiffChecksum(diff models.SchemaDiff) string {
+	diff.SchemasSame = nil
+	diff.TablesSame = nil
+	diff.SequencesSame = nil
+	diff.Summary = nil
+	diff.TablesModified = append([]models.TableDiff(nil), diff.TablesModified...)
+	for i := range diff.TablesModified {
+		diff.TablesModified[i].ColumnsSame = nil
+		diff.TablesModified[i].IndexesSame = nil
+		diff.TablesModified[i].ForeignKeysSame = nil
+	}
+
+	data, _ := json.Marshal(diff)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
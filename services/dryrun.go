@@ -0,0 +1,99 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"gorm.io/gorm"
+)
+
+// DryRun is the outcome of running a migration in a transaction that is
+// rolled back
+type DryRun struct {
+	MigrationExecution
+	Errors      []StatementResult `json:"errors"`
+	Notices     []string          `json:"notices"`
+	Schema      []models.Schema   `json:"schema"`      // Schema left by the migration, before the rollback
+	Differences models.SchemaDiff `json:"differences"` // From the migrated schema to the intended one
+	Matches     bool              `json:"matches"`     // Migration produces the intended schema
+}
+
+var concurrentlyPattern = regexp.MustCompile(`(?i)\s+CONCURRENTLY\b`)
+
+// blockCommitPattern matches the commits of batched anonymous blocks
+var blockCommitPattern = regexp.MustCompile(`(?im)^[ \t]*COMMIT;\n`)
+
+// DryRunMigration runs every step in a single transaction and rolls it back.
+// Each statement runs under a savepoint so that a failure is recorded and the
+// following statements still run, statements that cannot run in a transaction
+// are run without CONCURRENTLY and batches are not committed. The schema is dumped before the rollback and
+// compared with the intended one, both filtered by the filters given.
+// Errors are returned when the transaction cannot be opened or dumped.
+func DryRunMigration(db *gorm.DB, steps []MigrationStep, timeout time.Duration, intended []models.Schema, filters ...models.ObjectFilter) (DryRun, error) {
+	result := DryRun{
+		MigrationExecution: MigrationExecution{Success: true, Statements: make([]StatementResult, 0, len(steps))},
+		Errors:             []StatementResult{},
+		Notices:            []string{},
+	}
+	started := time.Now()
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		return result, fmt.Errorf("failed to begin transaction: %v", tx.Error)
+	}
+	defer tx.Rollback()
+
+	if timeout > 0 && dialectName(db) == "postgres" {
+		if err := tx.Exec(fmt.Sprintf("SET LOCAL statement_timeout = %d", timeout.Milliseconds())).Error; err != nil {
+			return result, fmt.Errorf("failed to set statement timeout: %v", err)
+		}
+	}
+
+	endExecuting := StartPhase(db.Statement.Context, PhaseExecuting)
+	for i, step := range steps {
+		ReportStep(db.Statement.Context, i+1, len(steps), step.ID)
+		sql := step.SQL
+		if !step.Transactional {
+			sql = concurrentlyPattern.ReplaceAllString(sql, "")
+			sql = blockCommitPattern.ReplaceAllString(sql, "")
+		}
+
+		savepoint := fmt.Sprintf("dry_run_%d", i)
+		if err := tx.SavePoint(savepoint).Error; err != nil {
+			return result, fmt.Errorf("failed to create savepoint: %v", err)
+		}
+		statement := StatementResult{Step: step.ID, SQL: step.SQL, Status: StatementRolledBack}
+		statementStarted := time.Now()
+		err := tx.Exec(sql).Error
+		statement.DurationMs = milliseconds(time.Since(statementStarted))
+		if err != nil {
+			statement.Status = StatementFailed
+			statement.Error = err.Error()
+			if err := tx.RollbackTo(savepoint).Error; err != nil {
+				return result, fmt.Errorf("failed to roll back to savepoint: %v", err)
+			}
+			result.Errors = append(result.Errors, statement)
+			if result.Success {
+				result.Success = false
+				result.Failed = &statement
+			}
+		}
+		result.Statements = append(result.Statements, statement)
+	}
+	endExecuting()
+
+	schema, err := DumpSchema(tx, filters...)
+	if err != nil {
+		return result, fmt.Errorf("failed to dump migrated schema: %v", err)
+	}
+	for _, filter := range filters {
+		intended = FilterSchemas(intended, filter)
+	}
+	result.Schema = schema
+	result.Differences = CompareSchemas(dialectName(tx), schema, intended)
+	result.Matches = !result.Differences.HasChanges()
+	result.DurationMs = milliseconds(time.Since(started))
+	return result, nil
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Statuses of executed statements
+const (
+	StatementApplied    = "applied"
+	StatementFailed     = "failed"
+	StatementRolledBack = "rolled_back" // Ran, then undone with the rest of its transaction
+	StatementSkipped    = "skipped"     // Not run because an earlier statement failed
+)
+
+// StatementResult is the outcome of one statement of an executed migration
+type StatementResult struct {
+	Step       string  `json:"step"`
+	SQL        string  `json:"sql"`
+	Status     string  `json:"status"`
+	DurationMs float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// MigrationExecution is the outcome of running migration steps against a
+// database
+type MigrationExecution struct {
+	Success    bool              `json:"success"`
+	Statements []StatementResult `json:"statements"`
+	Failed     *StatementResult  `json:"failed,omitempty"` // First failing statement
+	DurationMs float64           `json:"duration_ms"`
+}
+
+// transactionControlPattern matches statements opening or closing transaction
+// blocks, the executor manages transactions itself
+var transactionControlPattern = regexp.MustCompile(`(?i)^(BEGIN|START\s+TRANSACTION|COMMIT|END|ROLLBACK)(\s+(WORK|TRANSACTION))?$`)
+
+// ScriptSteps splits a SQL script into one step per statement, numbered in
+// script order. Semicolons inside quotes, dollar-quoted bodies and comments do
+// not end statements. Transaction control statements are dropped.
+func ScriptSteps(script string) []MigrationStep {
+	var steps []MigrationStep
+	for _, statement := range SplitStatements(script) {
+		if transactionControlPattern.MatchString(strings.TrimSuffix(statement, ";")) {
+			continue
+		}
+		steps = append(steps, MigrationStep{
+			ID:            fmt.Sprintf("statement:%d", len(steps)+1),
+			Kind:          "statement",
+			SQL:           statement + "\n",
+			Transactional: Transactional(statement),
+		})
+	}
+	return steps
+}
+
+// ScriptPlan plans a script written or stored as SQL, one step per statement
+func ScriptPlan(script MigrationScript) MigrationPlan {
+	return MigrationPlan{Up: ScriptSteps(script.Up), Down: ScriptSteps(script.Down)}
+}
+
+// ScriptChecksum hashes the statements of a script, so that blank lines and
+// indentation around statements do not change it
+func ScriptChecksum(script string) string {
+	hash := sha256.New()
+	for _, step := range ScriptSteps(script) {
+		hash.Write([]byte(step.SQL))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// SplitStatements cuts a script at top-level semicolons, keeping them.
+// Statements are trimmed and comment-only ones are dropped.
+func SplitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	flush := func() {
+		if statement := strings.TrimSpace(current.String()); statement != "" && !onlyComments(statement) {
+			statements = append(statements, statement)
+		}
+		current.Reset()
+	}
+
+	for i := 0; i < len(script); i++ {
+		rest := script[i:]
+		switch {
+		case rest[0] == '\'' || rest[0] == '"':
+			end := closingQuote(rest, rest[0])
+			current.WriteString(rest[:end])
+			i += end - 1
+		case strings.HasPrefix(rest, "--"):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			current.WriteString(rest[:end])
+			i += end - 1
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				end = len(rest)
+			} else {
+				end += 4
+			}
+			current.WriteString(rest[:end])
+			i += end - 1
+		case rest[0] == '$':
+			if tag := dollarTag(rest); tag != "" {
+				end := strings.Index(rest[len(tag):], tag)
+				if end < 0 {
+					end = len(rest)
+				} else {
+					end += 2 * len(tag)
+				}
+				current.WriteString(rest[:end])
+				i += end - 1
+				continue
+			}
+			current.WriteByte(rest[0])
+		case rest[0] == ';':
+			current.WriteByte(';')
+			flush()
+		default:
+			current.WriteByte(rest[0])
+		}
+	}
+	flush()
+	return statements
+}
+
+// closingQuote returns the length of the quoted text at the start of s,
+// doubled quotes being escapes
+func closingQuote(s string, quote byte) int {
+	for i := 1; i < len(s); i++ {
+		if s[i] != quote {
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == quote {
+			i++
+			continue
+		}
+		return i + 1
+	}
+	return len(s)
+}
+
+var dollarTagPattern = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+
+// dollarTag returns the dollar quote opening s, if any
+func dollarTag(s string) string {
+	return dollarTagPattern.FindString(s)
+}
+
+func onlyComments(statement string) bool {
+	for _, line := range strings.Split(statement, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
+
+// ApplyMigration runs steps one by one against a database and stops at the
+// first failure. Runs of transactional steps share a transaction, so a
+// failure rolls back the statements of its run, steps that cannot run in a
+// transaction are executed on their own. Each statement is reported to the
+// progress of the database's context.
+func ApplyMigration(db *gorm.DB, steps []MigrationStep) MigrationExecution {
+	execution := MigrationExecution{Success: true, Statements: make([]StatementResult, 0, len(steps))}
+	started := time.Now()
+	ctx := db.Statement.Context
+	defer StartPhase(ctx, PhaseExecuting)()
+
+	for _, batch := range Batches(steps) {
+		if !execution.Success {
+			for _, step := range batch {
+				execution.Statements = append(execution.Statements, StatementResult{Step: step.ID, SQL: step.SQL, Status: StatementSkipped})
+			}
+			continue
+		}
+
+		first := len(execution.Statements)
+		run := func(tx *gorm.DB) error {
+			for _, step := range batch {
+				result := StatementResult{Step: step.ID, SQL: step.SQL, Status: StatementApplied}
+				ReportStep(ctx, len(execution.Statements)+1, len(steps), step.ID)
+				statementStarted := time.Now()
+				err := tx.Exec(step.SQL).Error
+				result.DurationMs = milliseconds(time.Since(statementStarted))
+				if err != nil {
+					result.Status = StatementFailed
+					result.Error = err.Error()
+				}
+				execution.Statements = append(execution.Statements, result)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		var err error
+		transactional := batch[0].Transactional // Batches only group transactional steps
+		if transactional {
+			err = db.Transaction(run)
+		} else {
+			err = run(db)
+		}
+		if err == nil {
+			continue
+		}
+
+		execution.Success = false
+		last := len(execution.Statements) - 1
+		if transactional {
+			for i := first; i < last; i++ {
+				execution.Statements[i].Status = StatementRolledBack
+			}
+		}
+		for _, step := range batch[last-first+1:] {
+			execution.Statements = append(execution.Statements, StatementResult{Step: step.ID, SQL: step.SQL, Status: StatementSkipped})
+		}
+		failed := execution.Statements[last]
+		execution.Failed = &failed
+	}
+
+	execution.DurationMs = milliseconds(time.Since(started))
+	return execution
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"gorm.io/gorm"
+)
+
+// integerRanges holds the value range of each integer type
+var integerRanges = map[string][2]int64{
+	"smallint": {-32768, 32767},
+	"integer":  {-2147483648, 2147483647},
+	"bigint":   {-9223372036854775808, 9223372036854775807},
+}
+
+// numericPatterns match text values castable to the integer and numeric types
+var numericPatterns = map[bool]string{
+	true:  `^\s*[-+]?[0-9]+\s*$`,
+	false: `^\s*[-+]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][-+]?[0-9]+)?\s*$`,
+}
+
+// feasibilityCheck is a query condition matching rows a column change cannot convert
+type feasibilityCheck struct {
+	check     string
+	message   string
+	condition string
+}
+
+// CheckFeasibility queries the database the migration will run against (the
+// source side of the diff) for existing data that would make a narrowing type
+// change or a new NOT NULL constraint fail, attaching the violations to the
+// column changes. At most sampleSize offending keys are kept per violation.
+func CheckFeasibility(db *gorm.DB, diff *models.SchemaDiff, sampleSize int) error {
+	dialect := dialectName(db)
+	blocking := 0
+
+	for i := range diff.TablesModified {
+		table := &diff.TablesModified[i]
+		tableName := quoteIdent(table.SchemaName) + "." + quoteIdent(table.Name)
+		key := rowKeyExpression(dialect, *table)
+
+		for j := range table.ColumnsModified {
+			change := &table.ColumnsModified[j]
+			change.Violations = nil
+
+			for _, check := range feasibilityChecks(dialect, *change) {
+				var count int64
+				query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", tableName, check.condition)
+				if err := db.Raw(query).Scan(&count).Error; err != nil {
+					return fmt.Errorf("failed to check %s.%s: %w", table.Name, change.Name, err)
+				}
+				if count == 0 {
+					continue
+				}
+
+				var keys []string
+				query = fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY 1 LIMIT %d", key, tableName, check.condition, sampleSize)
+				if err := db.Raw(query).Scan(&keys).Error; err != nil {
+					return fmt.Errorf("failed to sample %s.%s: %w", table.Name, change.Name, err)
+				}
+
+				change.Violations = append(change.Violations, models.ColumnViolation{
+					Check:      check.check,
+					Message:    check.message,
+					Count:      count,
+					SampleKeys: keys,
+				})
+				blocking++
+			}
+		}
+	}
+
+	if diff.Summary == nil {
+		diff.Summary = make(map[string]int)
+	}
+	diff.Summary["blocking_violations"] = blocking
+	return nil
+}
+
+// feasibilityChecks lists the data conditions that would make the column change fail
+func feasibilityChecks(dialect string, change models.ColumnChange) []feasibilityCheck {
+	var checks []feasibilityCheck
+	column := quoteIdent(change.Name)
+
+	for _, attr := range change.ChangedAttr {
+		switch attr {
+		case "is_nullable":
+			if change.Source.IsNullable && !change.Target.IsNullable {
+				checks = append(checks, feasibilityCheck{
+					check:     "null_values",
+					message:   "rows with NULL values block SET NOT NULL",
+					condition: column + " IS NULL",
+				})
+			}
+		case "data_type":
+			checks = append(checks, typeChecks(dialect, column, change.Source.DataType, change.Target.DataType)...)
+		}
+	}
+	return checks
+}
+
+func typeChecks(dialect, column, from, to string) []feasibilityCheck {
+	source, target := parseType(from), parseType(to)
+	if source.array || target.array {
+		return nil
+	}
+
+	var checks []feasibilityCheck
+	text := fmt.Sprintf("CAST(%s AS TEXT)", column)
+	sourceIsNumber := integerRanks[source.base] > 0 || source.base == "numeric" || floatRanks[source.base] > 0
+
+	switch {
+	case stringTypes[target.base] && len(target.modifiers) > 0:
+		if !stringTypes[source.base] || modifiersNarrowed(source.modifiers, target.modifiers) {
+			checks = append(checks, feasibilityCheck{
+				check:     "max_length",
+				message:   fmt.Sprintf("values longer than %d characters do not fit %s", target.modifiers[0], to),
+				condition: fmt.Sprintf("LENGTH(%s) > %d", text, target.modifiers[0]),
+			})
+		}
+	case integerRanks[target.base] > 0 && sourceIsNumber:
+		bounds := integerRanges[target.base]
+		if integerRanks[source.base] <= integerRanks[target.base] && source.base != "numeric" && floatRanks[source.base] == 0 {
+			break
+		}
+		checks = append(checks, feasibilityCheck{
+			check:     "out_of_range",
+			message:   fmt.Sprintf("values outside [%d, %d] do not fit %s", bounds[0], bounds[1], to),
+			condition: fmt.Sprintf("(%s < %d OR %s > %d)", column, bounds[0], column, bounds[1]),
+		})
+	case target.base == "numeric" && len(target.modifiers) > 0 && sourceIsNumber:
+		scale := 0
+		if len(target.modifiers) > 1 {
+			scale = target.modifiers[1]
+		}
+		if !modifiersNarrowed(source.modifiers, target.modifiers) && source.base == "numeric" {
+			break
+		}
+		limit := "1" + strings.Repeat("0", target.modifiers[0]-scale)
+		checks = append(checks, feasibilityCheck{
+			check:     "out_of_range",
+			message:   fmt.Sprintf("values with an absolute value of %s or more do not fit %s", limit, to),
+			condition: fmt.Sprintf("ABS(%s) >= %s", column, limit),
+		})
+	}
+
+	// Only PostgreSQL supports the regular expressions needed to find text
+	// values that cannot be cast to a number
+	if dialect == "postgres" && stringTypes[source.base] && (integerRanks[target.base] > 0 || target.base == "numeric") {
+		checks = append(checks, feasibilityCheck{
+			check:     "invalid_format",
+			message:   fmt.Sprintf("values that are not valid %s literals cannot be cast", target.base),
+			condition: fmt.Sprintf("%s !~ '%s'", text, numericPatterns[integerRanks[target.base] > 0]),
+		})
+	}
+
+	return checks
+}
+
+// rowKeyExpression builds a text expression identifying a row by its primary
+// key, falling back to the physical row ID for tables without one
+func rowKeyExpression(dialect string, table models.TableDiff) string {
+	var keys []string
+	addKey := func(col models.Column) {
+		if col.IsPrimary {
+			keys = append(keys, fmt.Sprintf("CAST(%s AS TEXT)", quoteIdent(col.Name)))
+		}
+	}
+	for _, col := range table.ColumnsSame {
+		addKey(col)
+	}
+	for _, change := range table.ColumnsModified {
+		addKey(change.Source)
+	}
+	for _, col := range table.ColumnsRemoved {
+		addKey(col)
+	}
+
+	if len(keys) == 0 {
+		if dialect == "postgres" {
+			return "CAST(ctid AS TEXT)"
+		}
+		return "CAST(rowid AS TEXT)"
+	}
+	return strings.Join(keys, " || ',' || ")
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
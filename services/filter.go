@@ -0,0 +1,86 @@
+package services
+
+import (
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+)
+
+// FilterSchemas drops every schema, table, column, index, foreign key and
+// sequence rejected by the given filter
+func FilterSchemas(schemas []models.Schema, filter models.ObjectFilter) []models.Schema {
+	if filter.IsEmpty() {
+		return schemas
+	}
+
+	result := make([]models.Schema, 0, len(schemas))
+	for _, schema := range schemas {
+		if !filter.MatchSchema(schema.Name) {
+			continue
+		}
+
+		filtered := models.Schema{Name: schema.Name}
+		for _, table := range schema.Tables {
+			if !filter.MatchSchema(table.SchemaName) || !filter.MatchTable(table.SchemaName, table.Name) {
+				continue
+			}
+			filtered.Tables = append(filtered.Tables, filterTable(table, filter))
+		}
+
+		for _, seq := range schema.Sequences {
+			if !filter.MatchSchema(seq.SchemaName) || !filter.MatchSequence(seq.SchemaName, seq.Name) {
+				continue
+			}
+			filtered.Sequences = append(filtered.Sequences, seq)
+		}
+
+		// Dependents are kept for their schema, they are only used to order
+		// the migration of the tables they depend on
+		filtered.Dependents = schema.Dependents
+		result = append(result, filtered)
+	}
+
+	return result
+}
+
+func filterTable(table models.TableSchema, filter models.ObjectFilter) models.TableSchema {
+	filtered := models.TableSchema{
+		Name:       table.Name,
+		SchemaName: table.SchemaName,
+	}
+
+	kept := make(map[string]bool)
+	for _, col := range table.Columns {
+		if filter.MatchColumn(table.SchemaName, table.Name, col.Name) {
+			filtered.Columns = append(filtered.Columns, col)
+			kept[col.Name] = true
+		}
+	}
+
+	// Indexes and foreign keys go with the columns they cover, a diff keeping
+	// them would reference columns it does not know about
+	covered := func(columns []string) bool {
+		for _, col := range columns {
+			if !kept[col] {
+				return false
+			}
+		}
+		return true
+	}
+
+	if !filter.SkipsIndexes() {
+		for _, idx := range table.Indexes {
+			if covered(idx.Columns) {
+				filtered.Indexes = append(filtered.Indexes, idx)
+			}
+		}
+	}
+
+	if !filter.SkipsForeignKeys() {
+		for _, fk := range table.ForeignKeys {
+			if covered(fk.Columns) {
+				filtered.ForeignKeys = append(filtered.ForeignKeys, fk)
+			}
+		}
+	}
+
+	return filtered
+}
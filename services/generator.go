@@ -1,7 +1,7 @@
 package services
 
 import (
-	"strings"
+	"slices"
 
 	"github.com/Tsarbomba69-com/mammoth.server/ddl"
 	"github.com/Tsarbomba69-com/mammoth.server/models"
@@ -9,94 +9,662 @@ import (
 
 // MigrationScript represents a generated migration script
 type MigrationScript struct {
-	Up   string `json:"up"`   // SQL for applying changes
-	Down string `json:"down"` // SQL for reverting changes
+	Up     string        `json:"up"`               // SQL for applying changes
+	Down   string        `json:"down"`             // SQL for reverting changes
+	Phases []PhaseScript `json:"phases,omitempty"` // Online migrations split by phase
+}
+
+// GenerateOptions tunes how migrations are generated
+type GenerateOptions struct {
+	Transactions bool          // Wrap transactional statements in transaction blocks
+	Concurrently bool          // Create and drop indexes of existing tables concurrently
+	Online       bool          // Split changes to existing tables into expand, migrate and contract phases
+	Idempotent   bool          // Generate statements that can be run again after a partial run
+	Templates    ddl.Templates // Project overrides of the generated SQL
 }
 
 // Generate creates migration scripts from schema differences
-func Generate(dialect string, diff models.SchemaDiff) MigrationScript {
-	var upSQL, downSQL strings.Builder
-	var gen = ddl.NewDDL(dialect) // Change to your desired dialect
+func Generate(dialect string, diff models.SchemaDiff, opts ...GenerateOptions) MigrationScript {
+	return PlanMigration(dialect, diff, opts...).Script()
+}
 
-	// Create schema if it doesn't exist
-	for _, schema := range diff.SchemasAdded {
-		upSQL.WriteString(gen.CreateSchemaSQL(schema))
+// PlanMigration creates the migration plan for schema differences. Statements
+// are planned phase by phase (schemas, sequences, tables, foreign keys, drops)
+// and reordered where foreign keys, sequence ownership or dependent views and
+// functions require another order.
+func PlanMigration(dialect string, diff models.SchemaDiff, opts ...GenerateOptions) MigrationPlan {
+	var options GenerateOptions
+	if len(opts) > 0 {
+		options = opts[0]
 	}
+	var gen = ddl.NewDDL(dialect, ddl.Options{
+		Concurrently: options.Concurrently,
+		Idempotent:   options.Idempotent,
+		Templates:    options.Templates,
+	})
 
-	// Create sequences objects
-	for _, seq := range diff.SequencesAdded {
-		upSQL.WriteString(gen.CreateSequenceSQL(seq))
+	plan := MigrationPlan{
+		Up:           upStatements(gen, diff, options.Online).order(),
+		Down:         downStatements(gen, diff, options.Online).order(),
+		Transactions: options.Transactions,
+		Online:       options.Online,
+	}
+	if plan.Online {
+		plan.Up, plan.Down = byPhase(plan.Up), byPhase(plan.Down)
+	}
+	plan.linkReverses()
+	return plan
+}
+
+// upStatements builds the statements turning the source schema into the target one
+func upStatements(gen ddl.DDL, diff models.SchemaDiff, online bool) *statementGraph {
+	g := &statementGraph{}
+	broken := brokenDependents(diff)
+	created := tableKeys(diff.TablesAdded)
+	dropped := referencingForeignKeys(diff.TablesRemoved, removedForeignKeys(diff.TablesModified))
+
+	// Views and functions using altered columns are dropped first and come back last
+	for _, dep := range diff.Dependents {
+		g.add("drop_dependent", dependentKey(dep), gen.DropDependentSQL(dep), prefixed("drop_dependent:", usersOf(dep, diff.Dependents))...)
+	}
+
+	for _, schema := range diff.SchemasAdded {
+		g.add("create_schema", schema, gen.CreateSchemaSQL(schema))
 	}
 
+	owned := addSequences(g, gen, diff.SequencesAdded, created, diff.TablesModified)
+
 	for _, seqDiff := range diff.SequencesModified {
-		upSQL.WriteString(gen.AlterSequenceSQL(seqDiff))
-		downSQL.WriteString(gen.RevertAlterSequenceSQL(seqDiff))
+		owner := qualifiedTable(seqDiff.SchemaName, seqDiff.Target.OwnedByTable)
+		g.add("alter_sequence", seqDiff.SchemaName+"."+seqDiff.Name, gen.AlterSequenceSQL(seqDiff), "create_table:"+owner, "alter_table:"+owner)
 	}
 
 	// Create tables first (without foreign keys)
 	for _, table := range diff.TablesAdded {
-		upSQL.WriteString(gen.CreateTableSQL(table))
+		columns := append(append([]models.Column{}, table.ColumnsSame...), table.ColumnsAdded...)
+		deps := append([]string{"create_schema:" + table.SchemaName}, prefixed("create_sequence:", sequencesUsedBy(table.SchemaName, columns))...)
+		g.add("create_table", tableKey(table), gen.CreateTableSQL(table), deps...)
+	}
+
+	ownSequences(g, gen, owned)
+
+	for _, table := range diff.TablesAdded {
+		for _, fk := range table.ForeignKeyAdded {
+			ref := qualifiedTable(table.SchemaName, fk.ReferencedTable)
+			g.addForeignKey("add_fk", foreignKeyObject(table, fk), gen.AddForeignKeySQL(table.SchemaName, table.Name, fk),
+				"create_table:"+tableKey(table), "create_table:"+ref, "alter_table:"+ref)
+		}
+	}
+
+	for _, table := range diff.TablesModified {
+		for _, fk := range table.ForeignKeyRemoved {
+			g.add("drop_fk", foreignKeyObject(table, fk), gen.DropForeignKeySQL(table.SchemaName, table.Name, fk.Name))
+		}
+	}
+
+	// Modified tables
+	for _, table := range diff.TablesModified {
+		key := tableKey(table)
+		deps := prefixed("create_sequence:", sequencesUsedBy(table.SchemaName, targetColumns(table)))
+		deps = append(deps, prefixed("drop_dependent:", dependentsOf(key, diff.Dependents))...)
+		deps = append(deps, dropped[key]...)
+		for _, fk := range table.ForeignKeyRemoved {
+			deps = append(deps, "drop_fk:"+foreignKeyObject(table, fk))
+		}
+		for _, change := range table.ForeignKeyModified {
+			deps = append(deps, "create_table:"+qualifiedTable(table.SchemaName, change.Target.ReferencedTable))
+		}
+
+		for _, change := range tableChanges(table, false) {
+			if online && change.kind == "alter_column" {
+				addOnlineColumn(g, gen, table, change.diff.ColumnsModified[0], change.object, change.destructive, key, deps)
+				continue
+			}
+			step := newStep(change.kind, change.object, gen.AlterTableSQL(change.diff))
+			step.Destructive = step.Destructive || change.destructive
+			if online {
+				step.Phase = retypedIndexPhase(table, step.Kind, change.diff)
+			}
+			g.push(statement{step: step, groups: []string{"alter_table:" + key}, deps: deps})
+		}
+	}
+
+	for _, table := range diff.TablesModified {
+		for _, fk := range table.ForeignKeyAdded {
+			ref := qualifiedTable(table.SchemaName, fk.ReferencedTable)
+			addForeignKey(g, gen, table, fk, online, "alter_table:"+tableKey(table), "create_table:"+ref, "alter_table:"+ref)
+		}
+	}
+
+	for _, dep := range diff.Dependents {
+		if !broken[dependentKey(dep)] {
+			addDependent(g, gen, dep)
+		}
+	}
+
+	// Drop removed tables after the foreign keys referencing them
+	for _, table := range diff.TablesRemoved {
+		for _, fk := range table.ForeignKeyAdded {
+			g.add("drop_fk", foreignKeyObject(table, fk), gen.DropForeignKeySQL(table.SchemaName, table.Name, fk.Name))
+		}
+	}
+
+	for _, table := range diff.TablesRemoved {
+		key := tableKey(table)
+		deps := append(prefixed("drop_dependent:", dependentsOf(key, diff.Dependents)), dropped[key]...)
+		g.add("drop_table", key, gen.DropTableSQL(table.SchemaName, table.Name), deps...)
+	}
+
+	for _, seq := range diff.SequencesRemoved {
+		key := seq.SchemaName + "." + seq.Name
+		deps := append(sequenceUsers(key, diff.TablesRemoved, "drop_table:", tableColumns),
+			sequenceUsers(key, diff.TablesModified, "alter_table:", sourceColumns)...)
+		g.add("drop_sequence", key, gen.DropSequenceSQL(seq.SchemaName, seq.Name), deps...)
+	}
+
+	for _, schema := range diff.SchemasRemoved {
+		g.add("drop_schema", schema, gen.DropSchemaSQL(schema), schemaObjects(schema, "drop_table:", diff.TablesRemoved, "drop_sequence:", diff.SequencesRemoved)...)
+	}
+
+	return g
+}
+
+// downStatements builds the statements reverting the target schema to the source one
+func downStatements(gen ddl.DDL, diff models.SchemaDiff, online bool) *statementGraph {
+	g := &statementGraph{}
+	broken := brokenDependents(diff)
+	restored := tableKeys(diff.TablesRemoved)
+	dropped := referencingForeignKeys(diff.TablesAdded, addedForeignKeys(diff.TablesModified))
+
+	// Dependents recreated by the up migration use the altered columns again
+	for _, dep := range diff.Dependents {
+		if !broken[dependentKey(dep)] {
+			g.add("drop_dependent", dependentKey(dep), gen.DropDependentSQL(dep), prefixed("drop_dependent:", usersOf(dep, diff.Dependents))...)
+		}
+	}
+
+	for _, seqDiff := range diff.SequencesModified {
+		g.add("alter_sequence", seqDiff.SchemaName+"."+seqDiff.Name, gen.RevertAlterSequenceSQL(seqDiff))
+	}
+
+	for _, table := range diff.TablesModified {
+		for _, fk := range table.ForeignKeyAdded {
+			g.add("drop_fk", foreignKeyObject(table, fk), gen.DropForeignKeySQL(table.SchemaName, table.Name, fk.Name))
+		}
 	}
 
 	for _, table := range diff.TablesAdded {
 		for _, fk := range table.ForeignKeyAdded {
-			upSQL.WriteString(gen.AddForeignKeySQL(table.SchemaName, table.Name, fk))
-			downSQL.WriteString(gen.DropForeignKeySQL(table.SchemaName, table.Name, fk.Name))
+			g.add("drop_fk", foreignKeyObject(table, fk), gen.DropForeignKeySQL(table.SchemaName, table.Name, fk.Name))
 		}
 	}
 
 	for _, table := range diff.TablesAdded {
-		downSQL.WriteString(gen.DropTableSQL(table.SchemaName, table.Name))
+		key := tableKey(table)
+		g.add("drop_table", key, gen.DropTableSQL(table.SchemaName, table.Name), dropped[key]...)
 	}
 
 	for _, seq := range diff.SequencesAdded {
-		downSQL.WriteString(gen.DropSequenceSQL(seq.SchemaName, seq.Name))
+		key := seq.SchemaName + "." + seq.Name
+		deps := append(sequenceUsers(key, diff.TablesAdded, "drop_table:", tableColumns),
+			sequenceUsers(key, diff.TablesModified, "alter_table:", targetColumns)...)
+		g.add("drop_sequence", key, gen.DropSequenceSQL(seq.SchemaName, seq.Name), deps...)
 	}
 
 	for _, schema := range diff.SchemasAdded {
-		downSQL.WriteString(gen.DropSchemaSQL(schema))
+		g.add("drop_schema", schema, gen.DropSchemaSQL(schema), schemaObjects(schema, "drop_table:", diff.TablesAdded, "drop_sequence:", diff.SequencesAdded)...)
 	}
 
-	// Modified tables (columns only, for now)
-	for _, tableDiff := range diff.TablesModified {
-		upSQL.WriteString(gen.AlterTableSQL(tableDiff))
-		downSQL.WriteString(gen.RevertAlterTableSQL(tableDiff))
+	// Revert modified tables
+	for _, table := range diff.TablesModified {
+		key := tableKey(table)
+		deps := prefixed("create_sequence:", sequencesUsedBy(table.SchemaName, sourceColumns(table)))
+		deps = append(deps, prefixed("drop_dependent:", dependentsOf(key, diff.Dependents))...)
+		deps = append(deps, dropped[key]...)
+
+		for _, change := range tableChanges(table, true) {
+			if online && change.kind == "alter_column" {
+				column := change.diff.ColumnsModified[0]
+				column.Source, column.Target = column.Target, column.Source
+				addOnlineColumn(g, gen, table, column, change.object, change.revertDestructive, key, deps)
+				continue
+			}
+			step := newStep(reverseKinds[change.kind], change.object, gen.RevertAlterTableSQL(change.diff))
+			step.Destructive = step.Destructive || change.revertDestructive
+			if online {
+				step.Phase = retypedIndexPhase(table, step.Kind, change.diff)
+			}
+			g.push(statement{step: step, groups: []string{"alter_table:" + key}, deps: deps})
+		}
 	}
 
 	// Reverse: re-create removed tables (with FKs)
 	for _, schema := range diff.SchemasRemoved {
-		downSQL.WriteString(gen.CreateSchemaSQL(schema))
+		g.add("create_schema", schema, gen.CreateSchemaSQL(schema))
 	}
 
-	for _, seq := range diff.SequencesRemoved {
-		downSQL.WriteString(gen.CreateSequenceSQL(seq))
-	}
+	owned := addSequences(g, gen, diff.SequencesRemoved, restored, nil)
 
 	for _, table := range diff.TablesRemoved {
-		downSQL.WriteString(gen.CreateTableSQL(table))
+		deps := append([]string{"create_schema:" + table.SchemaName}, prefixed("create_sequence:", sequencesUsedBy(table.SchemaName, table.ColumnsAdded))...)
+		g.add("create_table", tableKey(table), gen.CreateTableSQL(table), deps...)
 	}
 
+	ownSequences(g, gen, owned)
+
+	// Removed tables hold their source foreign keys in ForeignKeyAdded, like their columns and indexes
 	for _, table := range diff.TablesRemoved {
 		for _, fk := range table.ForeignKeyAdded {
-			downSQL.WriteString(gen.AddForeignKeySQL(table.SchemaName, table.Name, fk))
-			upSQL.WriteString(gen.DropForeignKeySQL(table.SchemaName, table.Name, fk.Name))
+			ref := qualifiedTable(table.SchemaName, fk.ReferencedTable)
+			g.addForeignKey("add_fk", foreignKeyObject(table, fk), gen.AddForeignKeySQL(table.SchemaName, table.Name, fk),
+				"create_table:"+tableKey(table), "create_table:"+ref, "alter_table:"+ref)
 		}
 	}
 
-	for _, table := range diff.TablesRemoved {
-		upSQL.WriteString(gen.DropTableSQL(table.SchemaName, table.Name))
+	for _, table := range diff.TablesModified {
+		for _, fk := range table.ForeignKeyRemoved {
+			ref := qualifiedTable(table.SchemaName, fk.ReferencedTable)
+			addForeignKey(g, gen, table, fk, online, "alter_table:"+tableKey(table), "create_table:"+ref, "alter_table:"+ref)
+		}
 	}
 
-	for _, seq := range diff.SequencesRemoved {
-		upSQL.WriteString(gen.DropSequenceSQL(seq.SchemaName, seq.Name))
+	for _, dep := range diff.Dependents {
+		addDependent(g, gen, dep)
 	}
 
-	for _, schema := range diff.SchemasRemoved {
-		upSQL.WriteString(gen.DropSchemaSQL(schema))
+	return g
+}
+
+// tableChange is a single element change of a modified table
+type tableChange struct {
+	kind              string           // Kind of the up step
+	object            string           // Qualified name of the element
+	diff              models.TableDiff // The table diff holding only this change
+	destructive       bool             // Whether applying the change loses data
+	revertDestructive bool             // Whether reverting the change loses data
+}
+
+// tableChanges splits a modified table into its element changes, in the
+// order AlterTableSQL applies them. A changed primary key is dropped before
+// the other changes and added after them, which are swapped when reverting.
+func tableChanges(table models.TableDiff, revert bool) []tableChange {
+	var changes []tableChange
+	key := tableKey(table)
+	add := func(kind, name string, diff models.TableDiff, destructive, revertDestructive bool) {
+		diff.Name, diff.SchemaName = table.Name, table.SchemaName
+		changes = append(changes, tableChange{kind, key + "." + name, diff, destructive, revertDestructive})
+	}
+
+	source, target := primaryKeys(table)
+	pkChanged := !slices.Equal(source.Columns, target.Columns)
+	dropKey := func(pk models.Index) {
+		if pkChanged && len(pk.Columns) > 0 {
+			add("drop_primary_key", "primary_key", models.TableDiff{IndexesRemoved: []models.Index{pk}}, false, false)
+		}
+	}
+	addKey := func(pk models.Index) {
+		if pkChanged && len(pk.Columns) > 0 {
+			add("add_primary_key", "primary_key", models.TableDiff{IndexesAdded: []models.Index{pk}}, false, false)
+		}
+	}
+	if revert {
+		addKey(target)
+	} else {
+		dropKey(source)
+	}
+
+	for _, col := range table.ColumnsAdded {
+		add("add_column", col.Name, models.TableDiff{ColumnsAdded: []models.Column{col}}, false, false)
+	}
+	for _, col := range table.ColumnsRemoved {
+		add("drop_column", col.Name, models.TableDiff{ColumnsRemoved: []models.Column{col}}, false, false)
+	}
+	for _, change := range table.ColumnsModified {
+		// Primary keys are changed as a whole
+		change.ChangedAttr = slices.DeleteFunc(slices.Clone(change.ChangedAttr), func(attr string) bool { return attr == "is_primary" })
+		if len(change.ChangedAttr) == 0 {
+			continue
+		}
+		add("alter_column", change.Name, models.TableDiff{ColumnsModified: []models.ColumnChange{change}},
+			losesData(change.Source, change.Target), losesData(change.Target, change.Source))
+	}
+	for _, idx := range table.IndexesAdded {
+		if !idx.IsPrimary {
+			add("create_index", idx.Name, models.TableDiff{IndexesAdded: []models.Index{idx}}, false, false)
+		}
+	}
+	for _, idx := range table.IndexesRemoved {
+		if !idx.IsPrimary {
+			add("drop_index", idx.Name, models.TableDiff{IndexesRemoved: []models.Index{idx}}, false, false)
+		}
+	}
+	for _, change := range table.IndexesModified {
+		if !change.Source.IsPrimary && !change.Target.IsPrimary {
+			add("alter_index", change.Name, models.TableDiff{IndexesModified: []models.IndexChange{change}}, false, false)
+		}
+	}
+	for _, change := range table.ForeignKeyModified {
+		add("alter_fk", change.Name, models.TableDiff{ForeignKeyModified: []models.ForeignKeyChange{change}}, false, false)
+	}
+
+	if revert {
+		dropKey(source)
+	} else {
+		addKey(target)
+	}
+	return changes
+}
+
+// primaryKeys returns the primary keys of both sides of a modified table, as
+// indexes holding every key column. The name and column order come from the
+// introspected primary index when it has the same columns, otherwise the key
+// has Postgres' default name.
+func primaryKeys(table models.TableDiff) (source, target models.Index) {
+	var sourceColumns, targetColumns []string
+	for _, col := range table.ColumnsSame {
+		if col.IsPrimary {
+			sourceColumns = append(sourceColumns, col.Name)
+			targetColumns = append(targetColumns, col.Name)
+		}
 	}
+	for _, change := range table.ColumnsModified {
+		if change.Source.IsPrimary {
+			sourceColumns = append(sourceColumns, change.Name)
+		}
+		if change.Target.IsPrimary {
+			targetColumns = append(targetColumns, change.Name)
+		}
+	}
+	for _, col := range table.ColumnsRemoved {
+		if col.IsPrimary {
+			sourceColumns = append(sourceColumns, col.Name)
+		}
+	}
+	for _, col := range table.ColumnsAdded {
+		if col.IsPrimary {
+			targetColumns = append(targetColumns, col.Name)
+		}
+	}
+
+	sourceIndexes := append(slices.Clone(table.IndexesSame), table.IndexesRemoved...)
+	targetIndexes := append(slices.Clone(table.IndexesSame), table.IndexesAdded...)
+	for _, change := range table.IndexesModified {
+		sourceIndexes = append(sourceIndexes, change.Source)
+		targetIndexes = append(targetIndexes, change.Target)
+	}
+	return primaryKey(table.Name, sourceColumns, sourceIndexes), primaryKey(table.Name, targetColumns, targetIndexes)
+}
+
+func primaryKey(tableName string, columns []string, indexes []models.Index) models.Index {
+	pk := models.Index{Name: tableName + "_pkey", Columns: columns, IsPrimary: true, IsUnique: true}
+	for _, idx := range indexes {
+		if idx.IsPrimary && len(idx.Columns) == len(columns) && !slices.ContainsFunc(columns, func(col string) bool { return !contains(idx.Columns, col) }) {
+			pk.Name, pk.Columns = idx.Name, idx.Columns
+		}
+	}
+	return pk
+}
+
+// addOnlineColumn adds a column change of an existing table as expand,
+// backfill and contract steps
+func addOnlineColumn(g *statementGraph, gen ddl.DDL, table models.TableDiff, change models.ColumnChange, object string, destructive bool, key string, deps []string) {
+	phased := gen.OnlineAlterColumnSQL(table, change)
+	groups := []string{"alter_table:" + key}
+	g.push(statement{step: newStep("expand_column", object, phased.Expand), groups: groups, deps: deps})
+	for _, idx := range phased.Indexes {
+		g.push(statement{step: newStep("expand_index", key+"."+idx.Name, gen.CreateIndexSQL(table.SchemaName, table.Name, idx)), groups: groups, deps: deps})
+	}
+	g.push(statement{step: newStep("backfill_column", object, phased.Migrate), groups: groups, deps: deps})
+
+	contract := newStep("contract_column", object, phased.Contract)
+	contract.Destructive = destructive
+	g.push(statement{step: contract, groups: groups, deps: deps})
+}
+
+// addForeignKey adds a foreign key to an existing table, in online plans
+// without validating existing rows until the migrate phase
+func addForeignKey(g *statementGraph, gen ddl.DDL, table models.TableDiff, fk models.ForeignKey, online bool, deps ...string) {
+	object := foreignKeyObject(table, fk)
+	if !online {
+		g.addForeignKey("add_fk", object, gen.AddForeignKeySQL(table.SchemaName, table.Name, fk), deps...)
+		return
+	}
+
+	phased := gen.OnlineAddForeignKeySQL(table.SchemaName, table.Name, fk)
+	g.addForeignKey("add_fk", object, phased.Expand, deps...)
+	g.add("validate_fk", object, phased.Migrate, "add_fk:"+object)
+}
+
+// retypedIndexPhase returns the phase of an index step covering a column
+// whose type change swaps in a shadow column: the index is dropped before the
+// swap and built after it. Other steps keep the phase of their kind.
+func retypedIndexPhase(table models.TableDiff, kind string, element models.TableDiff) string {
+	phases := map[string]string{"drop_index": PhaseExpand, "create_index": PhaseContract}
+	if phases[kind] == "" {
+		return ""
+	}
+	for _, idx := range append(element.IndexesAdded, element.IndexesRemoved...) {
+		for _, change := range table.ColumnsModified {
+			if contains(idx.Columns, change.Name) && contains(change.ChangedAttr, "data_type") && !change.Source.IsPrimary && !change.Target.IsPrimary {
+				return phases[kind]
+			}
+		}
+	}
+	return ""
+}
+
+// losesData reports whether converting a column to another type may lose data
+func losesData(from, to models.Column) bool {
+	return from.DataType != to.DataType && contains(typeChangeReasons(from.DataType, to.DataType), models.ReasonDataLoss)
+}
+
+// addSequences adds the creation of sequences. The ownership of sequences owned
+// by a table created (or a column added) in the same migration is split off
+// and returned, to be set once the owning column exists.
+func addSequences(g *statementGraph, gen ddl.DDL, sequences []models.Sequence, created map[string]bool, modified []models.TableDiff) []models.Sequence {
+	var owned []models.Sequence
+	for _, seq := range sequences {
+		if seq.OwnedByTable != "" && ownerCreated(seq, created, modified) {
+			owned = append(owned, seq)
+			seq.OwnedByTable, seq.OwnedByColumn = "", ""
+		}
+		g.add("create_sequence", seq.SchemaName+"."+seq.Name, gen.CreateSequenceSQL(seq), "create_schema:"+seq.SchemaName)
+	}
+	return owned
+}
+
+func ownerCreated(seq models.Sequence, created map[string]bool, modified []models.TableDiff) bool {
+	owner := qualifiedTable(seq.SchemaName, seq.OwnedByTable)
+	if created[owner] {
+		return true
+	}
+	for _, table := range modified {
+		if tableKey(table) != owner {
+			continue
+		}
+		for _, col := range table.ColumnsAdded {
+			if col.Name == seq.OwnedByColumn {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ownSequences sets the ownership split off by addSequences
+func ownSequences(g *statementGraph, gen ddl.DDL, owned []models.Sequence) {
+	for _, seq := range owned {
+		key := seq.SchemaName + "." + seq.Name
+		owner := qualifiedTable(seq.SchemaName, seq.OwnedByTable)
+		ownership := models.SequenceChange{
+			Name:        seq.Name,
+			SchemaName:  seq.SchemaName,
+			Target:      seq,
+			ChangedAttr: []string{"OwnedByTable"},
+		}
+		g.add("own_sequence", key, gen.AlterSequenceSQL(ownership), "create_sequence:"+key, "create_table:"+owner, "alter_table:"+owner)
+	}
+}
+
+// addDependent recreates a dependent after the tables and views it uses
+func addDependent(g *statementGraph, gen ddl.DDL, dep models.Dependent) {
+	deps := []string{"drop_dependent:" + dependentKey(dep)}
+	for _, ref := range dep.References {
+		relation := ref.SchemaName + "." + ref.Name
+		deps = append(deps, "alter_table:"+relation, "create_table:"+relation, "create_dependent:"+relation)
+	}
+	g.add("create_dependent", dependentKey(dep), gen.CreateDependentSQL(dep), deps...)
+}
+
+func tableKey(table models.TableDiff) string {
+	return table.SchemaName + "." + table.Name
+}
+
+func tableKeys(tables []models.TableDiff) map[string]bool {
+	keys := make(map[string]bool)
+	for _, table := range tables {
+		keys[tableKey(table)] = true
+	}
+	return keys
+}
+
+func foreignKeyObject(table models.TableDiff, fk models.ForeignKey) string {
+	return tableKey(table) + "." + fk.Name
+}
+
+func prefixed(prefix string, keys []string) []string {
+	result := make([]string, len(keys))
+	for i, key := range keys {
+		result[i] = prefix + key
+	}
+	return result
+}
+
+// foreignKeyOwner pairs a foreign key with its table
+type foreignKeyOwner struct {
+	table models.TableDiff
+	fk    models.ForeignKey
+}
+
+func removedForeignKeys(tables []models.TableDiff) []foreignKeyOwner {
+	var result []foreignKeyOwner
+	for _, table := range tables {
+		for _, fk := range table.ForeignKeyRemoved {
+			result = append(result, foreignKeyOwner{table, fk})
+		}
+	}
+	return result
+}
+
+func addedForeignKeys(tables []models.TableDiff) []foreignKeyOwner {
+	var result []foreignKeyOwner
+	for _, table := range tables {
+		for _, fk := range table.ForeignKeyAdded {
+			result = append(result, foreignKeyOwner{table, fk})
+		}
+	}
+	return result
+}
+
+// referencingForeignKeys maps each referenced table to the drop_fk keys of the
+// foreign keys of the dropped tables plus the given extra ones
+func referencingForeignKeys(tables []models.TableDiff, extra []foreignKeyOwner) map[string][]string {
+	result := make(map[string][]string)
+	for _, table := range tables {
+		for _, fk := range table.ForeignKeyAdded {
+			extra = append(extra, foreignKeyOwner{table, fk})
+		}
+	}
+	for _, owner := range extra {
+		ref := qualifiedTable(owner.table.SchemaName, owner.fk.ReferencedTable)
+		if ref != tableKey(owner.table) {
+			result[ref] = append(result[ref], "drop_fk:"+foreignKeyObject(owner.table, owner.fk))
+		}
+	}
+	return result
+}
+
+// sequencesUsedBy lists the sequences the columns draw their defaults from
+func sequencesUsedBy(schemaName string, columns []models.Column) []string {
+	var result []string
+	for _, col := range columns {
+		if match := nextvalPattern.FindStringSubmatch(col.Default); match != nil {
+			result = append(result, schemaName+"."+match[1])
+		}
+	}
+	return result
+}
+
+// tableColumns lists the columns of an added or removed table
+func tableColumns(table models.TableDiff) []models.Column {
+	return table.ColumnsAdded
+}
+
+// sourceColumns lists the columns of a modified table that the up migration
+// removes or redefines
+func sourceColumns(table models.TableDiff) []models.Column {
+	columns := append([]models.Column{}, table.ColumnsRemoved...)
+	for _, change := range table.ColumnsModified {
+		columns = append(columns, change.Source)
+	}
+	return columns
+}
+
+// targetColumns lists the columns of a modified table that the up migration
+// adds or redefines
+func targetColumns(table models.TableDiff) []models.Column {
+	columns := append([]models.Column{}, table.ColumnsAdded...)
+	for _, change := range table.ColumnsModified {
+		columns = append(columns, change.Target)
+	}
+	return columns
+}
+
+// sequenceUsers returns the keys of the tables whose given columns use the sequence
+func sequenceUsers(sequence string, tables []models.TableDiff, prefix string, columnsOf func(models.TableDiff) []models.Column) []string {
+	var result []string
+	for _, table := range tables {
+		if contains(sequencesUsedBy(table.SchemaName, columnsOf(table)), sequence) {
+			result = append(result, prefix+tableKey(table))
+		}
+	}
+	return result
+}
+
+// schemaObjects returns the keys of the tables and sequences of a schema
+func schemaObjects(schema, tablePrefix string, tables []models.TableDiff, sequencePrefix string, sequences []models.Sequence) []string {
+	var result []string
+	for _, table := range tables {
+		if table.SchemaName == schema {
+			result = append(result, tablePrefix+tableKey(table))
+		}
+	}
+	for _, seq := range sequences {
+		if seq.SchemaName == schema {
+			result = append(result, sequencePrefix+seq.SchemaName+"."+seq.Name)
+		}
+	}
+	return result
+}
+
+// dependentsOf returns the keys of the dependents using the table or view
+func dependentsOf(relation string, dependents []models.Dependent) []string {
+	var result []string
+	for _, dep := range dependents {
+		for _, ref := range dep.References {
+			if ref.SchemaName+"."+ref.Name == relation {
+				result = append(result, dependentKey(dep))
+				break
+			}
+		}
+	}
+	return result
+}
 
-	return MigrationScript{
-		Up:   upSQL.String(),
-		Down: downSQL.String(),
+// usersOf returns the keys of the dependents using the given view
+func usersOf(dep models.Dependent, dependents []models.Dependent) []string {
+	if dep.Type == "function" {
+		return nil
 	}
+	return dependentsOf(dep.SchemaName+"."+dep.Name, dependents)
 }
@@ -0,0 +1,292 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"gorm.io/gorm"
+)
+
+// Jobs is the job queue started by the server, nil when not running
+var Jobs *JobQueue
+
+// ErrQueueFull is returned when a job is submitted to a queue at capacity
+var ErrQueueFull = errors.New("job queue is full")
+
+// ErrQueueStopped is returned when a job is submitted to a stopped queue
+var ErrQueueStopped = errors.New("job queue is stopped")
+
+// JobFunc does the work of a job. It stores its result on the job and
+// should stop when the context is done.
+type JobFunc func(ctx context.Context, job *models.Job) error
+
+// Names of the events streamed for a job
+const (
+	JobEventStatus = "status" // Data is a JobStatusEvent
+	JobEventPhase  = "phase"  // Data is a ProgressEvent
+)
+
+// JobEvent is an event of a job's stream
+type JobEvent struct {
+	Name string
+	Data any
+}
+
+// JobStatusEvent reports a job changing status. The final one carries the
+// time spent in each phase of the job.
+type JobStatusEvent struct {
+	Status  string        `json:"status"`
+	Error   string        `json:"error,omitempty"`
+	Timings []PhaseTiming `json:"timings,omitempty"`
+}
+
+// JobEvents is the event stream of a queued or running job. Events are kept
+// until the job finishes so that late subscribers see them all.
+type JobEvents struct {
+	events []JobEvent
+	closed bool
+	notify chan struct{}
+	mu     sync.Mutex
+}
+
+func newJobEvents() *JobEvents {
+	return &JobEvents{notify: make(chan struct{})}
+}
+
+// publish appends an event and wakes up the subscribers, the last event
+// closes the stream
+func (e *JobEvents) publish(event JobEvent, last bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return
+	}
+	e.events = append(e.events, event)
+	e.closed = last
+	close(e.notify)
+	e.notify = make(chan struct{})
+}
+
+// Since returns the events following the first n, whether the stream is
+// closed and a channel closed on the next publish
+func (e *JobEvents) Since(n int) ([]JobEvent, bool, <-chan struct{}) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if n > len(e.events) {
+		n = len(e.events)
+	}
+	return append([]JobEvent(nil), e.events[n:]...), e.closed, e.notify
+}
+
+type queuedJob struct {
+	job *models.Job
+	fn  JobFunc
+	ctx context.Context
+}
+
+// JobQueue runs jobs on a bounded pool of workers. Jobs are persisted in the
+// metadata database as they go from queued to running to a final status.
+type JobQueue struct {
+	db      *gorm.DB
+	workers int
+	queue   chan queuedJob
+	cancels map[uint]context.CancelFunc
+	streams map[uint]*JobEvents
+	stopped bool
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+}
+
+// NewJobQueue creates a queue of workers goroutines accepting up to capacity
+// waiting jobs
+func NewJobQueue(db *gorm.DB, workers, capacity int) *JobQueue {
+	return &JobQueue{
+		db:      db,
+		workers: workers,
+		queue:   make(chan queuedJob, capacity),
+		cancels: make(map[uint]context.CancelFunc),
+		streams: make(map[uint]*JobEvents),
+	}
+}
+
+// Start marks jobs interrupted by a previous shutdown as failed and starts
+// the workers
+func (q *JobQueue) Start() error {
+	now := time.Now()
+	err := q.db.Model(&models.Job{}).
+		Where("status IN ?", []string{models.JobQueued, models.JobRunning}).
+		Updates(map[string]any{"status": models.JobFailed, "error": "interrupted by a server restart", "finished_at": now}).Error
+	if err != nil {
+		return fmt.Errorf("failed to recover jobs: %v", err)
+	}
+
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	return nil
+}
+
+// Stop cancels running jobs and waits for the workers to exit
+func (q *JobQueue) Stop() {
+	q.mu.Lock()
+	if q.stopped {
+		q.mu.Unlock()
+		return
+	}
+	q.stopped = true
+	for _, cancel := range q.cancels {
+		cancel()
+	}
+	// Submit sends under the lock, so nothing is sent on the closed queue
+	close(q.queue)
+	q.mu.Unlock()
+	q.wg.Wait()
+}
+
+// Submit persists a queued job and hands it to the workers. Jobs that cannot
+// be queued are saved as failed.
+func (q *JobQueue) Submit(projectID uint, kind string, fn JobFunc) (models.Job, error) {
+	q.mu.Lock()
+	stopped := q.stopped
+	q.mu.Unlock()
+	if stopped {
+		return models.Job{}, ErrQueueStopped
+	}
+
+	job := &models.Job{ProjectID: projectID, Kind: kind, Status: models.JobQueued}
+	if err := q.db.Create(job).Error; err != nil {
+		return *job, fmt.Errorf("failed to save job: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := newJobEvents()
+	stream.publish(JobEvent{Name: JobEventStatus, Data: JobStatusEvent{Status: job.Status}}, false)
+	submitted := *job // Workers own the job once it is queued
+
+	q.mu.Lock()
+	q.cancels[job.ID] = cancel
+	q.streams[job.ID] = stream
+	err := ErrQueueStopped // Stopped while the job was saved
+	if !q.stopped {
+		select {
+		case q.queue <- queuedJob{job: job, fn: fn, ctx: ctx}:
+			err = nil
+		default:
+			err = ErrQueueFull
+		}
+	}
+	q.mu.Unlock()
+
+	if err != nil {
+		q.finish(ctx, job, err)
+		return *job, err
+	}
+	return submitted, nil
+}
+
+// Cancel cancels the context of a queued or running job. It reports false
+// for jobs that are not in the queue.
+func (q *JobQueue) Cancel(id uint) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	cancel, ok := q.cancels[id]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// Events returns the event stream of a queued or running job. It reports
+// false for jobs that are not in the queue.
+func (q *JobQueue) Events(id uint) (*JobEvents, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stream, ok := q.streams[id]
+	return stream, ok
+}
+
+func (q *JobQueue) work() {
+	defer q.wg.Done()
+	for queued := range q.queue {
+		q.run(queued)
+	}
+}
+
+func (q *JobQueue) run(queued queuedJob) {
+	job := queued.job
+	if queued.ctx.Err() != nil {
+		q.finish(queued.ctx, job, queued.ctx.Err())
+		return
+	}
+
+	startedAt := time.Now()
+	job.Status = models.JobRunning
+	job.StartedAt = &startedAt
+	if err := q.db.Save(job).Error; err != nil {
+		log.Printf("job %d: failed to save status: %v", job.ID, err)
+	}
+
+	stream, _ := q.Events(job.ID)
+	stream.publish(JobEvent{Name: JobEventStatus, Data: JobStatusEvent{Status: job.Status}}, false)
+	ctx := WithProgress(queued.ctx, NewProgress(func(event ProgressEvent) {
+		stream.publish(JobEvent{Name: JobEventPhase, Data: event}, false)
+	}))
+
+	var err error
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("job panicked: %v", r)
+			}
+		}()
+		err = queued.fn(ctx, job)
+	}()
+	q.finish(ctx, job, err)
+}
+
+// finish saves the final status of a job, closes its event stream with the
+// timings of its phases and forgets it
+func (q *JobQueue) finish(ctx context.Context, job *models.Job, err error) {
+	canceled := ctx.Err() != nil
+	q.mu.Lock()
+	if cancel, ok := q.cancels[job.ID]; ok {
+		cancel()
+		delete(q.cancels, job.ID)
+	}
+	stream := q.streams[job.ID]
+	q.mu.Unlock()
+
+	finishedAt := time.Now()
+	job.FinishedAt = &finishedAt
+	switch {
+	case canceled:
+		job.Status = models.JobCanceled
+		job.Error = "canceled"
+	case err != nil:
+		job.Status = models.JobFailed
+		job.Error = err.Error()
+	default:
+		job.Status = models.JobSucceeded
+	}
+	if err := q.db.Save(job).Error; err != nil {
+		log.Printf("job %d: failed to save status: %v", job.ID, err)
+	}
+
+	final := JobStatusEvent{Status: job.Status, Error: job.Error}
+	if progress := progressFrom(ctx); progress != nil {
+		final.Timings = progress.Timings()
+	}
+	if stream != nil {
+		stream.publish(JobEvent{Name: JobEventStatus, Data: final}, true)
+	}
+	// Dropped once saved, subscribers coming later read the saved status
+	q.mu.Lock()
+	delete(q.streams, job.ID)
+	q.mu.Unlock()
+}
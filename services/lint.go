@@ -0,0 +1,233 @@
+package services
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+)
+
+// LintRule reviews a migration for a single kind of problem
+type LintRule struct {
+	Name        string `json:"name"`
+	Level       string `json:"level"`
+	Description string `json:"description"`
+	check       func(diff models.SchemaDiff, plan MigrationPlan) []models.LintFinding
+}
+
+// LintRules lists the available rules, in the order their findings are reported
+var LintRules = []LintRule{
+	{
+		Name:        "not-null-without-default",
+		Level:       models.LintError,
+		Description: "Adding a NOT NULL column without a default to an existing table fails when the table has rows",
+		check:       lintNotNullWithoutDefault,
+	},
+	{
+		Name:        "index-not-concurrent",
+		Level:       models.LintWarning,
+		Description: "Creating an index on an existing table without CONCURRENTLY blocks writes while it builds",
+		check:       lintIndexNotConcurrent,
+	},
+	{
+		Name:        "volatile-default",
+		Level:       models.LintWarning,
+		Description: "Adding a column with a volatile default rewrites the whole table under an exclusive lock",
+		check:       lintVolatileDefault,
+	},
+	{
+		Name:        "drop-referenced-column",
+		Level:       models.LintError,
+		Description: "Dropping a column still used by a view breaks the view, which is dropped and not recreated",
+		check:       lintDropReferencedColumn,
+	},
+	{
+		Name:        "column-rename",
+		Level:       models.LintWarning,
+		Description: "A column dropped while another of the same definition is added looks like a rename, which loses the data and breaks code using the old name",
+		check:       lintColumnRename,
+	},
+	{
+		Name:        "foreign-key-without-index",
+		Level:       models.LintWarning,
+		Description: "New foreign key columns without an index make deletes on the referenced table and joins scan the table",
+		check:       lintForeignKeyWithoutIndex,
+	},
+}
+
+// ValidateLintRules checks that every configured rule exists
+func ValidateLintRules(rules models.LintRules) error {
+	for name := range rules {
+		if !slices.ContainsFunc(LintRules, func(rule LintRule) bool { return rule.Name == name }) {
+			return fmt.Errorf("unknown lint rule: %s", name)
+		}
+	}
+	return nil
+}
+
+// Lint runs the enabled rules over a diff and the migration planned from it
+func Lint(diff models.SchemaDiff, plan MigrationPlan, rules models.LintRules) []models.LintFinding {
+	findings := []models.LintFinding{}
+	for _, rule := range LintRules {
+		if !rules.Enabled(rule.Name) {
+			continue
+		}
+		for _, finding := range rule.check(diff, plan) {
+			finding.Rule, finding.Level = rule.Name, rule.Level
+			findings = append(findings, finding)
+		}
+	}
+	return findings
+}
+
+func lintNotNullWithoutDefault(diff models.SchemaDiff, _ MigrationPlan) []models.LintFinding {
+	var findings []models.LintFinding
+	for _, table := range diff.TablesModified {
+		for _, col := range table.ColumnsAdded {
+			if !col.IsNullable && col.Default == "" {
+				object := tableKey(table) + "." + col.Name
+				findings = append(findings, models.LintFinding{
+					Object:  object,
+					Step:    "add_column:" + object,
+					Message: fmt.Sprintf("column %s is added NOT NULL without a default", object),
+				})
+			}
+		}
+	}
+	return findings
+}
+
+func lintIndexNotConcurrent(_ models.SchemaDiff, plan MigrationPlan) []models.LintFinding {
+	var findings []models.LintFinding
+	for _, step := range plan.Up {
+		if (step.Kind == "create_index" || step.Kind == "alter_index" || step.Kind == "expand_index") && step.Transactional {
+			findings = append(findings, models.LintFinding{
+				Object:  step.Object,
+				Step:    step.ID,
+				Message: fmt.Sprintf("index %s is built without CONCURRENTLY", step.Object),
+			})
+		}
+	}
+	return findings
+}
+
+func lintVolatileDefault(diff models.SchemaDiff, _ MigrationPlan) []models.LintFinding {
+	var findings []models.LintFinding
+	for _, table := range diff.TablesModified {
+		for _, col := range table.ColumnsAdded {
+			if volatileDefaultPattern.MatchString(col.Default) {
+				object := tableKey(table) + "." + col.Name
+				findings = append(findings, models.LintFinding{
+					Object:  object,
+					Step:    "add_column:" + object,
+					Message: fmt.Sprintf("column %s defaults to %s, evaluated for every existing row", object, col.Default),
+				})
+			}
+		}
+	}
+	return findings
+}
+
+func lintDropReferencedColumn(diff models.SchemaDiff, _ MigrationPlan) []models.LintFinding {
+	var findings []models.LintFinding
+	for _, table := range diff.TablesModified {
+		for _, col := range table.ColumnsRemoved {
+			object := tableKey(table) + "." + col.Name
+			for _, dep := range diff.Dependents {
+				if dep.Type == "function" || !referencesColumn(dep, table, col.Name) {
+					continue
+				}
+				findings = append(findings, models.LintFinding{
+					Object:  object,
+					Step:    "drop_column:" + object,
+					Message: fmt.Sprintf("column %s is used by %s %s", object, dep.Type, dependentKey(dep)),
+				})
+			}
+		}
+	}
+	return findings
+}
+
+func referencesColumn(dep models.Dependent, table models.TableDiff, column string) bool {
+	for _, ref := range dep.References {
+		if ref.SchemaName == table.SchemaName && ref.Name == table.Name && slices.Contains(ref.Columns, column) {
+			return true
+		}
+	}
+	return false
+}
+
+func lintColumnRename(diff models.SchemaDiff, _ MigrationPlan) []models.LintFinding {
+	var findings []models.LintFinding
+	for _, table := range diff.TablesModified {
+		for _, removed := range table.ColumnsRemoved {
+			var candidates []string
+			for _, added := range table.ColumnsAdded {
+				if strings.EqualFold(removed.DataType, added.DataType) && removed.IsNullable == added.IsNullable && removed.ComparedDefault() == added.ComparedDefault() {
+					candidates = append(candidates, added.Name)
+				}
+			}
+			if len(candidates) == 0 {
+				continue
+			}
+			object := tableKey(table) + "." + removed.Name
+			findings = append(findings, models.LintFinding{
+				Object:  object,
+				Step:    "drop_column:" + object,
+				Message: fmt.Sprintf("column %s is dropped while %s is added with the same definition; a rename loses the data and breaks code still using %s", removed.Name, strings.Join(candidates, ", "), removed.Name),
+			})
+		}
+	}
+	return findings
+}
+
+func lintForeignKeyWithoutIndex(diff models.SchemaDiff, _ MigrationPlan) []models.LintFinding {
+	var findings []models.LintFinding
+	check := func(table models.TableDiff, indexes []models.Index, columns []models.Column) {
+		for _, fk := range table.ForeignKeyAdded {
+			if indexed(fk.Columns, indexes, columns) {
+				continue
+			}
+			object := foreignKeyObject(table, fk)
+			findings = append(findings, models.LintFinding{
+				Object:  object,
+				Step:    "add_fk:" + object,
+				Message: fmt.Sprintf("foreign key %s columns (%s) have no index", object, strings.Join(fk.Columns, ", ")),
+			})
+		}
+	}
+
+	for _, table := range diff.TablesAdded {
+		check(table, table.IndexesAdded, table.ColumnsAdded)
+	}
+	for _, table := range diff.TablesModified {
+		indexes := append(append([]models.Index{}, table.IndexesSame...), table.IndexesAdded...)
+		for _, change := range table.IndexesModified {
+			indexes = append(indexes, change.Target)
+		}
+		check(table, indexes, append(append([]models.Column{}, table.ColumnsSame...), targetColumns(table)...))
+	}
+	return findings
+}
+
+// indexed reports whether an index (or the primary key) starts with the columns
+func indexed(columns []string, indexes []models.Index, tableColumns []models.Column) bool {
+	var primary []string
+	for _, col := range tableColumns {
+		if col.IsPrimary {
+			primary = append(primary, col.Name)
+		}
+	}
+	candidates := [][]string{primary}
+	for _, idx := range indexes {
+		candidates = append(candidates, idx.Columns)
+	}
+
+	for _, candidate := range candidates {
+		if len(candidate) >= len(columns) && slices.Equal(candidate[:len(columns)], columns) {
+			return true
+		}
+	}
+	return false
+}
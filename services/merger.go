@@ -0,0 +1,321 @@
+package services
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+)
+
+// change is a single flattened entry of a SchemaDiff
+type change struct {
+	objectType string // schema, table, column, index, foreign_key, sequence
+	action     string // added, removed, modified
+	schemaName string
+	tableName  string
+	name       string
+	value      any
+}
+
+func (c change) key() string {
+	return fmt.Sprintf("%s:%s.%s.%s", c.objectType, c.schemaName, c.tableName, c.name)
+}
+
+// Merge performs a three-way comparison: the changes base→ours and
+// base→theirs are split into non-conflicting changes of each side and
+// conflicts, and the non-conflicting ones are combined into a merged diff.
+func Merge(dialect string, base, ours, theirs []models.Schema, filters ...models.ObjectFilter) models.SchemaMerge {
+	oursChanges := flatten(CompareSchemas(dialect, base, ours, filters...))
+	theirsChanges := flatten(CompareSchemas(dialect, base, theirs, filters...))
+
+	theirsByKey := make(map[string]change, len(theirsChanges))
+	for _, c := range theirsChanges {
+		theirsByKey[c.key()] = c
+	}
+
+	var conflicts []models.MergeConflict
+	conflicting := make(map[string]bool)
+	agreed := make(map[string]bool)
+
+	// Both sides changed the same object
+	for _, o := range oursChanges {
+		t, exists := theirsByKey[o.key()]
+		if !exists {
+			continue
+		}
+		if o.action == t.action && reflect.DeepEqual(o.value, t.value) {
+			agreed[o.key()] = true
+			continue
+		}
+		conflicting[o.key()] = true
+		conflicts = append(conflicts, models.MergeConflict{
+			ObjectType:   o.objectType,
+			SchemaName:   o.schemaName,
+			TableName:    o.tableName,
+			Name:         o.name,
+			OursAction:   o.action,
+			TheirsAction: t.action,
+			Ours:         o.value,
+			Theirs:       t.value,
+			Reason:       fmt.Sprintf("%s %s differently on both sides", o.objectType, describeActions(o.action, t.action)),
+		})
+	}
+
+	// One side dropped a container the other side changed
+	conflicts = append(conflicts, containerConflicts(oursChanges, theirsChanges, conflicting, false)...)
+	conflicts = append(conflicts, containerConflicts(theirsChanges, oursChanges, conflicting, true)...)
+
+	var oursClean, theirsClean, merged []change
+	for _, o := range oursChanges {
+		if !conflicting[o.key()] {
+			oursClean = append(oursClean, o)
+			merged = append(merged, o)
+		}
+	}
+	for _, t := range theirsChanges {
+		if conflicting[t.key()] {
+			continue
+		}
+		theirsClean = append(theirsClean, t)
+		if !agreed[t.key()] {
+			merged = append(merged, t)
+		}
+	}
+
+	return models.SchemaMerge{
+		Ours:      rebuild(base, oursClean),
+		Theirs:    rebuild(base, theirsClean),
+		Merged:    rebuild(base, merged),
+		Conflicts: conflicts,
+	}
+}
+
+// containerConflicts reports changes on one side to objects living in a schema
+// or table the other side removed. Removals on both sides are compatible.
+func containerConflicts(dropping, changing []change, conflicting map[string]bool, swapped bool) []models.MergeConflict {
+	var conflicts []models.MergeConflict
+	for _, d := range dropping {
+		if d.action != "removed" || (d.objectType != "schema" && d.objectType != "table") {
+			continue
+		}
+		for _, c := range changing {
+			if c.action == "removed" || c.key() == d.key() {
+				continue
+			}
+			inSchema := d.objectType == "schema" && c.objectType != "schema" && c.schemaName == d.name
+			inTable := d.objectType == "table" && c.tableName == d.name && c.schemaName == d.schemaName
+			if !inSchema && !inTable {
+				continue
+			}
+
+			conflicting[d.key()] = true
+			conflicting[c.key()] = true
+			conflict := models.MergeConflict{
+				ObjectType:   c.objectType,
+				SchemaName:   c.schemaName,
+				TableName:    c.tableName,
+				Name:         c.name,
+				OursAction:   d.action,
+				TheirsAction: c.action,
+				Ours:         d.value,
+				Theirs:       c.value,
+			}
+			if swapped {
+				conflict.OursAction, conflict.TheirsAction = conflict.TheirsAction, conflict.OursAction
+				conflict.Ours, conflict.Theirs = conflict.Theirs, conflict.Ours
+			}
+			conflict.Reason = fmt.Sprintf("%s %q removed on one side but its %s %q was %s on the other",
+				d.objectType, d.name, c.objectType, c.name, c.action)
+			conflicts = append(conflicts, conflict)
+		}
+	}
+	return conflicts
+}
+
+func describeActions(ours, theirs string) string {
+	if ours == theirs {
+		return ours
+	}
+	return ours + "/" + theirs
+}
+
+// flatten turns a diff into a list of independent changes
+func flatten(diff models.SchemaDiff) []change {
+	var changes []change
+
+	for _, name := range diff.SchemasAdded {
+		changes = append(changes, change{objectType: "schema", action: "added", schemaName: name, name: name, value: name})
+	}
+	for _, name := range diff.SchemasRemoved {
+		changes = append(changes, change{objectType: "schema", action: "removed", schemaName: name, name: name, value: name})
+	}
+
+	for _, table := range diff.TablesAdded {
+		changes = append(changes, change{objectType: "table", action: "added", schemaName: table.SchemaName, name: table.Name, value: table})
+	}
+	for _, table := range diff.TablesRemoved {
+		changes = append(changes, change{objectType: "table", action: "removed", schemaName: table.SchemaName, name: table.Name, value: table})
+	}
+
+	for _, table := range diff.TablesModified {
+		element := func(objectType, action, name string, value any) change {
+			return change{
+				objectType: objectType,
+				action:     action,
+				schemaName: table.SchemaName,
+				tableName:  table.Name,
+				name:       name,
+				value:      value,
+			}
+		}
+		for _, col := range table.ColumnsAdded {
+			changes = append(changes, element("column", "added", col.Name, col))
+		}
+		for _, col := range table.ColumnsRemoved {
+			changes = append(changes, element("column", "removed", col.Name, col))
+		}
+		for _, col := range table.ColumnsModified {
+			changes = append(changes, element("column", "modified", col.Name, col))
+		}
+		for _, idx := range table.IndexesAdded {
+			changes = append(changes, element("index", "added", idx.Name, idx))
+		}
+		for _, idx := range table.IndexesRemoved {
+			changes = append(changes, element("index", "removed", idx.Name, idx))
+		}
+		for _, idx := range table.IndexesModified {
+			changes = append(changes, element("index", "modified", idx.Name, idx))
+		}
+		for _, fk := range table.ForeignKeyAdded {
+			changes = append(changes, element("foreign_key", "added", fk.Name, fk))
+		}
+		for _, fk := range table.ForeignKeyRemoved {
+			changes = append(changes, element("foreign_key", "removed", fk.Name, fk))
+		}
+		for _, fk := range table.ForeignKeyModified {
+			changes = append(changes, element("foreign_key", "modified", fk.Name, fk))
+		}
+	}
+
+	for _, seq := range diff.SequencesAdded {
+		changes = append(changes, change{objectType: "sequence", action: "added", schemaName: seq.SchemaName, name: seq.Name, value: seq})
+	}
+	for _, seq := range diff.SequencesRemoved {
+		changes = append(changes, change{objectType: "sequence", action: "removed", schemaName: seq.SchemaName, name: seq.Name, value: seq})
+	}
+	for _, seq := range diff.SequencesModified {
+		changes = append(changes, change{objectType: "sequence", action: "modified", schemaName: seq.SchemaName, name: seq.Name, value: seq})
+	}
+
+	return changes
+}
+
+// rebuild is the inverse of flatten. Changes are ordered by schema and name
+// like CompareSchemas orders them, whichever side they come from, and the
+// dependents of base affected by them are attached.
+func rebuild(base []models.Schema, changes []change) models.SchemaDiff {
+	var diff models.SchemaDiff
+	tables := make(map[string]int) // Position of each modified table in TablesModified
+
+	for _, c := range changes {
+		switch c.objectType {
+		case "schema":
+			if c.action == "added" {
+				diff.SchemasAdded = append(diff.SchemasAdded, c.name)
+			} else {
+				diff.SchemasRemoved = append(diff.SchemasRemoved, c.name)
+			}
+		case "table":
+			if c.action == "added" {
+				diff.TablesAdded = append(diff.TablesAdded, c.value.(models.TableDiff))
+			} else {
+				diff.TablesRemoved = append(diff.TablesRemoved, c.value.(models.TableDiff))
+			}
+		case "sequence":
+			switch c.action {
+			case "added":
+				diff.SequencesAdded = append(diff.SequencesAdded, c.value.(models.Sequence))
+			case "removed":
+				diff.SequencesRemoved = append(diff.SequencesRemoved, c.value.(models.Sequence))
+			default:
+				diff.SequencesModified = append(diff.SequencesModified, c.value.(models.SequenceChange))
+			}
+		default:
+			tableKey := c.schemaName + "." + c.tableName
+			pos, exists := tables[tableKey]
+			if !exists {
+				pos = len(diff.TablesModified)
+				tables[tableKey] = pos
+				diff.TablesModified = append(diff.TablesModified, models.TableDiff{
+					Name:       c.tableName,
+					SchemaName: c.schemaName,
+				})
+			}
+			addElement(&diff.TablesModified[pos], c)
+		}
+	}
+
+	sortDiff(&diff)
+	diff.Dependents = affectedDependents(base, diff)
+	summarize(&diff)
+	return diff
+}
+
+// sortDiff orders each category of a diff by schema and then name
+func sortDiff(diff *models.SchemaDiff) {
+	tableName := func(table models.TableDiff) (string, string) { return table.SchemaName, table.Name }
+	sequenceName := func(seq models.Sequence) (string, string) { return seq.SchemaName, seq.Name }
+
+	sort.Strings(diff.SchemasAdded)
+	sort.Strings(diff.SchemasRemoved)
+	diff.TablesAdded = sortedByQualifiedName(diff.TablesAdded, tableName)
+	diff.TablesRemoved = sortedByQualifiedName(diff.TablesRemoved, tableName)
+	diff.TablesModified = sortedByQualifiedName(diff.TablesModified, tableName)
+	for i := range diff.TablesModified {
+		table := &diff.TablesModified[i]
+		table.ColumnsAdded = sortedByName(table.ColumnsAdded, func(col models.Column) string { return col.Name })
+		table.ColumnsRemoved = sortedByName(table.ColumnsRemoved, func(col models.Column) string { return col.Name })
+		table.ColumnsModified = sortedByName(table.ColumnsModified, func(col models.ColumnChange) string { return col.Name })
+		table.IndexesAdded = sortedByName(table.IndexesAdded, indexName)
+		table.IndexesRemoved = sortedByName(table.IndexesRemoved, indexName)
+		table.IndexesModified = sortedByName(table.IndexesModified, func(idx models.IndexChange) string { return idx.Name })
+		table.ForeignKeyAdded = sortedByName(table.ForeignKeyAdded, foreignKeyName)
+		table.ForeignKeyRemoved = sortedByName(table.ForeignKeyRemoved, foreignKeyName)
+		table.ForeignKeyModified = sortedByName(table.ForeignKeyModified, func(fk models.ForeignKeyChange) string { return fk.Name })
+	}
+	diff.SequencesAdded = sortedByQualifiedName(diff.SequencesAdded, sequenceName)
+	diff.SequencesRemoved = sortedByQualifiedName(diff.SequencesRemoved, sequenceName)
+	diff.SequencesModified = sortedByQualifiedName(diff.SequencesModified, func(seq models.SequenceChange) (string, string) {
+		return seq.SchemaName, seq.Name
+	})
+}
+
+func addElement(table *models.TableDiff, c change) {
+	switch v := c.value.(type) {
+	case models.Column:
+		if c.action == "added" {
+			table.ColumnsAdded = append(table.ColumnsAdded, v)
+		} else {
+			table.ColumnsRemoved = append(table.ColumnsRemoved, v)
+		}
+	case models.ColumnChange:
+		table.ColumnsModified = append(table.ColumnsModified, v)
+	case models.Index:
+		if c.action == "added" {
+			table.IndexesAdded = append(table.IndexesAdded, v)
+		} else {
+			table.IndexesRemoved = append(table.IndexesRemoved, v)
+		}
+	case models.IndexChange:
+		table.IndexesModified = append(table.IndexesModified, v)
+	case models.ForeignKey:
+		if c.action == "added" {
+			table.ForeignKeyAdded = append(table.ForeignKeyAdded, v)
+		} else {
+			table.ForeignKeyRemoved = append(table.ForeignKeyRemoved, v)
+		}
+	case models.ForeignKeyChange:
+		table.ForeignKeyModified = append(table.ForeignKeyModified, v)
+	}
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+)
+
+// ColumnRule rewrites a column into its canonical form
+type ColumnRule func(col models.Column) models.Column
+
+// IndexRule rewrites an index into its canonical form
+type IndexRule func(idx models.Index) models.Index
+
+// SequenceRule rewrites a sequence into its canonical form
+type SequenceRule func(seq models.Sequence) models.Sequence
+
+// Normalizer canonicalizes introspected schemas so that equivalent definitions
+// compare equal (e.g. "int4" and "integer")
+type Normalizer struct {
+	ColumnRules   []ColumnRule
+	IndexRules    []IndexRule
+	SequenceRules []SequenceRule
+}
+
+var dialectNormalizersMu sync.RWMutex
+
+var dialectNormalizers = map[string]Normalizer{
+	"postgres": {
+		ColumnRules: []ColumnRule{
+			NormalizePostgresType,
+			NormalizePostgresDefault,
+		},
+		IndexRules: []IndexRule{
+			SortPrimaryIndexColumns,
+		},
+		SequenceRules: []SequenceRule{
+			UnqualifySequenceOwner,
+		},
+	},
+}
+
+// RegisterNormalizer installs (or replaces) the normalizer used for a dialect
+func RegisterNormalizer(dialect string, normalizer Normalizer) {
+	dialectNormalizersMu.Lock()
+	defer dialectNormalizersMu.Unlock()
+	dialectNormalizers[dialect] = normalizer
+}
+
+// Normalize applies the dialect's normalizer to the schemas. Dialects without
+// a registered normalizer are returned unchanged.
+func Normalize(dialect string, schemas []models.Schema) []models.Schema {
+	dialectNormalizersMu.RLock()
+	normalizer, ok := dialectNormalizers[dialect]
+	dialectNormalizersMu.RUnlock()
+	if !ok {
+		return schemas
+	}
+	return normalizer.Normalize(schemas)
+}
+
+// Normalize returns a normalized copy of the schemas, leaving the input untouched
+func (n Normalizer) Normalize(schemas []models.Schema) []models.Schema {
+	result := make([]models.Schema, 0, len(schemas))
+	for _, schema := range schemas {
+		normalized := models.Schema{Name: schema.Name, Dependents: schema.Dependents}
+
+		for _, table := range schema.Tables {
+			normalized.Tables = append(normalized.Tables, n.normalizeTable(table))
+		}
+
+		for _, seq := range schema.Sequences {
+			for _, rule := range n.SequenceRules {
+				seq = rule(seq)
+			}
+			normalized.Sequences = append(normalized.Sequences, seq)
+		}
+		result = append(result, normalized)
+	}
+	return result
+}
+
+func (n Normalizer) normalizeTable(table models.TableSchema) models.TableSchema {
+	normalized := models.TableSchema{
+		Name:        table.Name,
+		SchemaName:  table.SchemaName,
+		ForeignKeys: table.ForeignKeys,
+	}
+
+	for _, col := range table.Columns {
+		for _, rule := range n.ColumnRules {
+			col = rule(col)
+		}
+		normalized.Columns = append(normalized.Columns, col)
+	}
+
+	for _, idx := range table.Indexes {
+		idx.Columns = append([]string(nil), idx.Columns...)
+		for _, rule := range n.IndexRules {
+			idx = rule(idx)
+		}
+		normalized.Indexes = append(normalized.Indexes, idx)
+	}
+
+	return normalized
+}
+
+// postgresTypeAliases maps PostgreSQL type aliases to the names reported by information_schema
+var postgresTypeAliases = map[string]string{
+	"int":         "integer",
+	"int4":        "integer",
+	"serial":      "integer",
+	"serial4":     "integer",
+	"int2":        "smallint",
+	"smallserial": "smallint",
+	"serial2":     "smallint",
+	"int8":        "bigint",
+	"bigserial":   "bigint",
+	"serial8":     "bigint",
+	"float4":      "real",
+	"float8":      "double precision",
+	"float":       "double precision",
+	"bool":        "boolean",
+	"decimal":     "numeric",
+	"varchar":     "character varying",
+	"char":        "character",
+	"bpchar":      "character",
+	"varbit":      "bit varying",
+	"timestamp":   "timestamp without time zone",
+	"timestamptz": "timestamp with time zone",
+	"time":        "time without time zone",
+	"timetz":      "time with time zone",
+}
+
+var (
+	typeModifierPattern = regexp.MustCompile(`^([a-z0-9_ ]+?)\s*(\([^)]*\))?\s*(with(?:out)? time zone)?(\[\])?$`)
+	timeZonePattern     = regexp.MustCompile(` with(?:out)? time zone$`)
+)
+
+// NormalizePostgresType lower-cases the data type and resolves aliases such as
+// "int4" or "varchar(20)" to their canonical spelling. Time types carry their
+// precision ahead of the time zone, e.g. "timestamp(3) without time zone".
+func NormalizePostgresType(col models.Column) models.Column {
+	dataType := strings.Join(strings.Fields(strings.ToLower(col.DataType)), " ")
+	match := typeModifierPattern.FindStringSubmatch(dataType)
+	if match == nil {
+		col.DataType = dataType
+		return col
+	}
+
+	base, modifier, zone, array := match[1], match[2], match[3], match[4]
+	if zone != "" {
+		base += " " + zone
+	} else if canonical, ok := postgresTypeAliases[base]; ok {
+		base = canonical
+	}
+	modifier = strings.ReplaceAll(modifier, " ", "")
+	if loc := timeZonePattern.FindStringIndex(base); loc != nil {
+		col.DataType = base[:loc[0]] + modifier + base[loc[0]:] + array
+		return col
+	}
+	col.DataType = base + modifier + array
+	return col
+}
+
+var (
+	literalCastPattern  = regexp.MustCompile(`('(?:[^']|'')*'|\(-?\d+(?:\.\d+)?\)|-?\d+(?:\.\d+)?)::[a-zA-Z_][a-zA-Z0-9_]*(?: varying| precision| with(?:out)? time zone)?(?:\([0-9, ]+\))?(?:\[\])?`)
+	parenLiteralPattern = regexp.MustCompile(`^\((-?\d+(?:\.\d+)?)\)$`)
+	nextvalPattern      = regexp.MustCompile(`(?i)nextval\('(?:"?[A-Za-z0-9_$]+"?\.)?"?([A-Za-z0-9_$]+)"?'(?:::regclass)?\)`)
+	currentTimePattern  = regexp.MustCompile(`(?i)\b(now|transaction_timestamp)\(\)|\bcurrent_timestamp\b`)
+)
+
+// NormalizePostgresDefault canonicalizes default expressions: redundant literal
+// casts are stripped, nextval() references are unqualified and now() is
+// spelled CURRENT_TIMESTAMP. The canonical form is only compared, Default is
+// kept as introspected since it is what statements are generated from.
+func NormalizePostgresDefault(col models.Column) models.Column {
+	if col.Default == "" {
+		return col
+	}
+
+	expr := strings.TrimSpace(col.Default)
+	expr = nextvalPattern.ReplaceAllString(expr, "nextval('$1')")
+	expr = currentTimePattern.ReplaceAllString(expr, "CURRENT_TIMESTAMP")
+	expr = literalCastPattern.ReplaceAllString(expr, "$1")
+	expr = parenLiteralPattern.ReplaceAllString(expr, "$1")
+	col.NormalizedDefault = expr
+	return col
+}
+
+// SortPrimaryIndexColumns orders primary key index columns alphabetically since
+// their order does not affect the constraint
+func SortPrimaryIndexColumns(idx models.Index) models.Index {
+	if idx.IsPrimary {
+		sort.Strings(idx.Columns)
+	}
+	return idx
+}
+
+// UnqualifySequenceOwner drops the schema prefix from the owning table when it
+// matches the sequence's own schema
+func UnqualifySequenceOwner(seq models.Sequence) models.Sequence {
+	seq.OwnedByTable = strings.TrimPrefix(seq.OwnedByTable, seq.SchemaName+".")
+	return seq
+}
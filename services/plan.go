@@ -0,0 +1,393 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+)
+
+// MigrationPlan is a migration as ordered steps, one per statement
+type MigrationPlan struct {
+	Up           []MigrationStep `json:"up"`
+	Down         []MigrationStep `json:"down"`
+	Transactions bool            `json:"transactions"` // Script wraps transactional steps in transaction blocks
+	Online       bool            `json:"online"`       // Steps are split into expand, migrate and contract phases
+}
+
+// MigrationStep is a single statement of a migration plan
+type MigrationStep struct {
+	ID            string         `json:"id"`          // Stable identifier, "<kind>:<object>"
+	Kind          string         `json:"kind"`        // e.g. create_table, add_column, drop_fk
+	ObjectType    string         `json:"object_type"` // schema, sequence, table, column, index, foreign_key or dependent
+	Object        string         `json:"object"`      // Qualified name of the object
+	SQL           string         `json:"sql"`
+	Destructive   bool           `json:"destructive"`            // Drops data or objects holding data
+	Transactional bool           `json:"transactional"`          // Can run inside a transaction block
+	Phase         string         `json:"phase,omitempty"`        // expand, migrate or contract in online plans
+	Irreversible  string         `json:"irreversible,omitempty"` // Why the other direction cannot fully undo the step
+	Reverse       *MigrationStep `json:"reverse,omitempty"`
+}
+
+// Phases of online migrations
+const (
+	PhaseExpand   = "expand"
+	PhaseMigrate  = "migrate"
+	PhaseContract = "contract"
+)
+
+// Phases lists the phases of online migrations in the order they run
+var Phases = []string{PhaseExpand, PhaseMigrate, PhaseContract}
+
+// PhaseScript is the part of a migration script belonging to one phase
+type PhaseScript struct {
+	Phase string `json:"phase"`
+	Up    string `json:"up"`
+	Down  string `json:"down"`
+}
+
+// Script concatenates the SQL of the plan's steps, in transaction blocks
+// when the plan was made with transactions. Online plans also get the script
+// of each phase, a phase's transactions never spanning into the next one.
+func (p MigrationPlan) Script() MigrationScript {
+	join := joinSteps
+	if p.Transactions {
+		join = batchSteps
+	}
+	if !p.Online {
+		return MigrationScript{
+			Up:   join(p.Up),
+			Down: join(p.Down),
+		}
+	}
+
+	var script MigrationScript
+	for _, phase := range Phases {
+		phased := PhaseScript{
+			Phase: phase,
+			Up:    join(stepsInPhase(p.Up, phase)),
+			Down:  join(stepsInPhase(p.Down, phase)),
+		}
+		script.Up += phased.Up
+		script.Down += phased.Down
+		script.Phases = append(script.Phases, phased)
+	}
+	return script
+}
+
+func stepsInPhase(steps []MigrationStep, phase string) []MigrationStep {
+	var result []MigrationStep
+	for _, step := range steps {
+		if step.Phase == phase {
+			result = append(result, step)
+		}
+	}
+	return result
+}
+
+// byPhase stably reorders steps phase by phase. Steps without a phase get the
+// phase of their kind: additions expand, drops and rewrites contract.
+func byPhase(steps []MigrationStep) []MigrationStep {
+	var result []MigrationStep
+	for i := range steps {
+		if steps[i].Phase == "" {
+			steps[i].Phase = stepPhases[steps[i].Kind]
+		}
+	}
+	for _, phase := range Phases {
+		result = append(result, stepsInPhase(steps, phase)...)
+	}
+	return result
+}
+
+// Batches splits steps into runs of consecutive transactional steps, each
+// non-transactional step getting a batch of its own
+func Batches(steps []MigrationStep) [][]MigrationStep {
+	var batches [][]MigrationStep
+	for i, step := range steps {
+		if step.Transactional && i > 0 && steps[i-1].Transactional {
+			batches[len(batches)-1] = append(batches[len(batches)-1], step)
+			continue
+		}
+		batches = append(batches, []MigrationStep{step})
+	}
+	return batches
+}
+
+// batchSteps joins steps with every transactional batch wrapped in BEGIN and COMMIT
+func batchSteps(steps []MigrationStep) string {
+	var sql strings.Builder
+	for _, batch := range Batches(steps) {
+		if !batch[0].Transactional {
+			sql.WriteString(batch[0].SQL)
+			continue
+		}
+		sql.WriteString("BEGIN;\n")
+		sql.WriteString(joinSteps(batch))
+		sql.WriteString("COMMIT;\n")
+	}
+	return sql.String()
+}
+
+func joinSteps(steps []MigrationStep) string {
+	var sql strings.Builder
+	for _, step := range steps {
+		sql.WriteString(step.SQL)
+	}
+	return sql.String()
+}
+
+// stepObjectTypes maps step kinds to the type of object they change
+var stepObjectTypes = map[string]string{
+	"create_schema":    "schema",
+	"drop_schema":      "schema",
+	"create_sequence":  "sequence",
+	"alter_sequence":   "sequence",
+	"own_sequence":     "sequence",
+	"drop_sequence":    "sequence",
+	"create_table":     "table",
+	"drop_table":       "table",
+	"add_column":       "column",
+	"drop_column":      "column",
+	"alter_column":     "column",
+	"create_index":     "index",
+	"drop_index":       "index",
+	"alter_index":      "index",
+	"drop_primary_key": "primary_key",
+	"add_primary_key":  "primary_key",
+	"add_fk":           "foreign_key",
+	"drop_fk":          "foreign_key",
+	"alter_fk":         "foreign_key",
+	"create_dependent": "dependent",
+	"drop_dependent":   "dependent",
+	"expand_column":    "column",
+	"expand_index":     "index",
+	"backfill_column":  "column",
+	"contract_column":  "column",
+	"validate_fk":      "foreign_key",
+}
+
+// stepPhases maps step kinds to the phase they run in within online plans
+var stepPhases = map[string]string{
+	"create_schema":    PhaseExpand,
+	"create_sequence":  PhaseExpand,
+	"alter_sequence":   PhaseExpand,
+	"own_sequence":     PhaseExpand,
+	"create_table":     PhaseExpand,
+	"add_column":       PhaseExpand,
+	"create_index":     PhaseExpand,
+	"add_fk":           PhaseExpand,
+	"expand_column":    PhaseExpand,
+	"expand_index":     PhaseExpand,
+	"backfill_column":  PhaseMigrate,
+	"validate_fk":      PhaseMigrate,
+	"drop_dependent":   PhaseContract,
+	"drop_fk":          PhaseContract,
+	"drop_column":      PhaseContract,
+	"alter_column":     PhaseContract,
+	"contract_column":  PhaseContract,
+	"drop_index":       PhaseContract,
+	"alter_index":      PhaseContract,
+	"drop_primary_key": PhaseContract,
+	"add_primary_key":  PhaseContract,
+	"alter_fk":         PhaseContract,
+	"create_dependent": PhaseContract,
+	"drop_table":       PhaseContract,
+	"drop_sequence":    PhaseContract,
+	"drop_schema":      PhaseContract,
+}
+
+// reverseKinds maps step kinds to the kind of the step undoing them
+var reverseKinds = map[string]string{
+	"create_schema":    "drop_schema",
+	"drop_schema":      "create_schema",
+	"create_sequence":  "drop_sequence",
+	"drop_sequence":    "create_sequence",
+	"alter_sequence":   "alter_sequence",
+	"create_table":     "drop_table",
+	"drop_table":       "create_table",
+	"add_column":       "drop_column",
+	"drop_column":      "add_column",
+	"alter_column":     "alter_column",
+	"create_index":     "drop_index",
+	"drop_index":       "create_index",
+	"alter_index":      "alter_index",
+	"drop_primary_key": "add_primary_key",
+	"add_primary_key":  "drop_primary_key",
+	"add_fk":           "drop_fk",
+	"drop_fk":          "add_fk",
+	"alter_fk":         "alter_fk",
+	"create_dependent": "drop_dependent",
+	"drop_dependent":   "create_dependent",
+}
+
+// destructiveKinds lists the step kinds dropping data
+var destructiveKinds = map[string]bool{
+	"drop_schema":   true,
+	"drop_sequence": true,
+	"drop_table":    true,
+	"drop_column":   true,
+}
+
+// nonTransactionalPattern matches statements Postgres refuses to run inside a
+// transaction block, including anonymous blocks committing as they go
+var nonTransactionalPattern = regexp.MustCompile(`(?i)\bCONCURRENTLY\b|\bALTER\s+TYPE\b[^;]*\bADD\s+VALUE\b|(?s:^DO\b.*\bCOMMIT;)`)
+
+// Reasons a step cannot be undone
+const (
+	IrreversibleDataLoss   = "drops data the other direction cannot restore"
+	IrreversibleConversion = "converts values the other direction cannot convert back"
+	IrreversibleNoReverse  = "no statement of the other direction reverts it"
+)
+
+// Transactional reports whether SQL can run inside a transaction block
+func Transactional(sql string) bool {
+	return !nonTransactionalPattern.MatchString(sql)
+}
+
+// linkReverses attaches to every step of the plan the step undoing it, and
+// marks the steps that cannot be undone
+func (p *MigrationPlan) linkReverses() {
+	link := func(steps, reverses []MigrationStep) {
+		byID := make(map[string]MigrationStep)
+		for _, step := range reverses {
+			byID[step.ID] = step
+		}
+		for i, step := range steps {
+			if reverse, ok := byID[reverseKinds[step.Kind]+":"+step.Object]; ok {
+				reverse.Reverse = nil
+				steps[i].Reverse = &reverse
+			}
+		}
+	}
+
+	up := append([]MigrationStep(nil), p.Up...)
+	link(p.Up, p.Down)
+	link(p.Down, up)
+	markIrreversible(p.Up)
+	markIrreversible(p.Down)
+}
+
+func markIrreversible(steps []MigrationStep) {
+	for i, step := range steps {
+		switch {
+		case step.Destructive && destructiveKinds[step.Kind]:
+			steps[i].Irreversible = IrreversibleDataLoss
+		case step.Destructive:
+			steps[i].Irreversible = IrreversibleConversion
+		case step.Reverse == nil && reverseKinds[step.Kind] != "":
+			steps[i].Irreversible = IrreversibleNoReverse
+		}
+	}
+}
+
+// statement is a migration step being planned along with the keys of the
+// statements that must run before it
+type statement struct {
+	step       MigrationStep
+	groups     []string // Extra keys other statements can depend on, e.g. alter_table:<table>
+	deps       []string
+	foreignKey bool // Foreign key creation, deferred to break dependency cycles
+}
+
+// statementGraph orders migration statements topologically. Statements that
+// do not depend on each other keep the order they were added in.
+type statementGraph struct {
+	statements []statement
+}
+
+// add registers a step, empty statements are skipped. Dependencies on keys
+// that are not part of the graph are ignored.
+func (g *statementGraph) add(kind, object, sql string, deps ...string) {
+	g.push(statement{step: newStep(kind, object, sql), deps: deps})
+}
+
+// addForeignKey registers the creation of a foreign key
+func (g *statementGraph) addForeignKey(kind, object, sql string, deps ...string) {
+	g.push(statement{step: newStep(kind, object, sql), deps: deps, foreignKey: true})
+}
+
+func (g *statementGraph) push(stmt statement) {
+	if stmt.step.SQL != "" {
+		g.statements = append(g.statements, stmt)
+	}
+}
+
+func newStep(kind, object, sql string) MigrationStep {
+	return MigrationStep{
+		ID:            kind + ":" + object,
+		Kind:          kind,
+		ObjectType:    stepObjectTypes[kind],
+		Object:        object,
+		SQL:           sql,
+		Destructive:   destructiveKinds[kind],
+		Transactional: Transactional(sql),
+	}
+}
+
+func (s statement) keys() []string {
+	return append([]string{s.step.ID}, s.groups...)
+}
+
+// order returns the steps so that each runs after its dependencies. Cycles
+// are broken by deferring foreign key creation to the end.
+func (g *statementGraph) order() []MigrationStep {
+	pending := make(map[string]int)
+	for _, stmt := range g.statements {
+		for _, key := range stmt.keys() {
+			pending[key]++
+		}
+	}
+
+	ready := func(stmt statement) bool {
+		own := stmt.keys()
+		for _, dep := range stmt.deps {
+			if pending[dep] > 0 && !contains(own, dep) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var result, deferred []MigrationStep
+	emitted := make([]bool, len(g.statements))
+	emit := func(i int) {
+		emitted[i] = true
+		for _, key := range g.statements[i].keys() {
+			pending[key]--
+		}
+	}
+
+	for remaining := len(g.statements); remaining > 0; remaining-- {
+		next := -1
+		for i, stmt := range g.statements {
+			if !emitted[i] && ready(stmt) {
+				next = i
+				break
+			}
+		}
+
+		if next >= 0 {
+			emit(next)
+			result = append(result, g.statements[next].step)
+			continue
+		}
+
+		// Every remaining statement waits on another one: defer the first
+		// foreign key, or give up on the first statement's dependencies
+		for i, stmt := range g.statements {
+			if !emitted[i] && (next < 0 || stmt.foreignKey) {
+				next = i
+				if stmt.foreignKey {
+					break
+				}
+			}
+		}
+		emit(next)
+		if g.statements[next].foreignKey {
+			deferred = append(deferred, g.statements[next].step)
+		} else {
+			result = append(result, g.statements[next].step)
+		}
+	}
+
+	return append(result, deferred...)
+}
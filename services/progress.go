@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/Tsarbomba69-com/mammoth.server/utils"
+)
+
+// Phases reported while serving long operations
+const (
+	PhaseConnecting = "connecting"
+	PhaseIntrospect = "introspecting" // Followed by the kind of object, e.g. introspecting:tables
+	PhaseComparing  = "comparing"
+	PhaseGenerating = "generating"
+	PhaseExecuting  = "executing"
+)
+
+// States of progress events
+const (
+	ProgressStarted  = "started"
+	ProgressFinished = "finished"
+	ProgressStep     = "step" // A statement of the executing phase
+)
+
+// ProgressEvent reports a phase starting or finishing, or a step of the
+// executing phase
+type ProgressEvent struct {
+	Phase     string    `json:"phase"`
+	State     string    `json:"state"`                // started, finished or step
+	Step      int       `json:"step,omitempty"`       // Statement being executed, from 1
+	Total     int       `json:"total,omitempty"`      // Statements to execute
+	Detail    string    `json:"detail,omitempty"`     // Step ID of the statement
+	ElapsedMs float64   `json:"elapsed_ms,omitempty"` // Duration of a finished phase
+	Time      time.Time `json:"time"`
+}
+
+// PhaseTiming is the time spent in a phase, as collected by the stopwatch
+type PhaseTiming struct {
+	Phase      string  `json:"phase"`
+	DurationMs float64 `json:"duration_ms"`
+	Percent    float64 `json:"percent"` // Share of the operation's wall-clock time, overlapping phases share it
+}
+
+// Progress times the phases of an operation and hands its events to a
+// listener
+type Progress struct {
+	stopwatch *utils.Stopwatch
+	emit      func(ProgressEvent)
+}
+
+type progressKey struct{}
+
+// NewProgress creates a progress reporter calling emit for every event.
+// Emit may be called from several goroutines at once.
+func NewProgress(emit func(ProgressEvent)) *Progress {
+	return &Progress{stopwatch: utils.NewStopwatch(), emit: emit}
+}
+
+// WithProgress returns a context carrying the reporter. Operations run
+// under it report their phases, others report nothing.
+func WithProgress(ctx context.Context, progress *Progress) context.Context {
+	return context.WithValue(ctx, progressKey{}, progress)
+}
+
+func progressFrom(ctx context.Context) *Progress {
+	if ctx == nil {
+		return nil
+	}
+	progress, _ := ctx.Value(progressKey{}).(*Progress)
+	return progress
+}
+
+// StartPhase reports the start of a phase and returns the function that
+// reports its end
+func StartPhase(ctx context.Context, phase string) func() {
+	progress := progressFrom(ctx)
+	if progress == nil {
+		return func() {}
+	}
+	progress.stopwatch.Start(phase)
+	progress.emit(ProgressEvent{Phase: phase, State: ProgressStarted, Time: time.Now()})
+	return func() {
+		elapsed := progress.stopwatch.Stop(phase)
+		progress.emit(ProgressEvent{Phase: phase, State: ProgressFinished, ElapsedMs: milliseconds(elapsed), Time: time.Now()})
+	}
+}
+
+// ReportStep reports that the step-th of total statements is being executed
+func ReportStep(ctx context.Context, step, total int, detail string) {
+	if progress := progressFrom(ctx); progress != nil {
+		progress.emit(ProgressEvent{Phase: PhaseExecuting, State: ProgressStep, Step: step, Total: total, Detail: detail, Time: time.Now()})
+	}
+}
+
+// Timings returns the time spent in each finished phase
+func (p *Progress) Timings() []PhaseTiming {
+	timings := p.stopwatch.Timings()
+	phases := make([]PhaseTiming, 0, len(timings))
+	for _, timing := range timings {
+		phases = append(phases, PhaseTiming{Phase: timing.Label, DurationMs: milliseconds(timing.Elapsed), Percent: timing.Percent})
+	}
+	return phases
+}
@@ -0,0 +1,289 @@
+package services
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+)
+
+// volatileDefaultPattern matches default expressions PostgreSQL must evaluate
+// per row, forcing a table rewrite when the column is added
+var volatileDefaultPattern = regexp.MustCompile(`(?i)\b(nextval|random|gen_random_uuid|uuid_generate_v[14]|clock_timestamp|timeofday)\(`)
+
+// integerRanks orders the integer types by width
+var integerRanks = map[string]int{"smallint": 1, "integer": 2, "bigint": 3}
+
+// floatRanks orders the floating point types by width
+var floatRanks = map[string]int{"real": 1, "double precision": 2}
+
+var stringTypes = map[string]bool{"character varying": true, "character": true, "text": true}
+
+// classifyRisks annotates every change of the diff with its severity and
+// rolls the severities up into the diff and its summary
+func classifyRisks(diff *models.SchemaDiff) {
+	diff.Risks = nil
+	diff.Severity = models.SeveritySafe
+
+	for _, name := range diff.SchemasAdded {
+		diff.Risks = append(diff.Risks, newRisk("schema", name, "added"))
+	}
+	for _, name := range diff.SchemasRemoved {
+		diff.Risks = append(diff.Risks, newRisk("schema", name, "removed", models.ReasonDataLoss))
+	}
+
+	for i := range diff.TablesAdded {
+		table := &diff.TablesAdded[i]
+		table.Risks = []models.ChangeRisk{newRisk("table", table.SchemaName+"."+table.Name, "added")}
+		table.Severity = models.SeveritySafe
+	}
+	for i := range diff.TablesRemoved {
+		table := &diff.TablesRemoved[i]
+		table.Risks = []models.ChangeRisk{newRisk("table", table.SchemaName+"."+table.Name, "removed", models.ReasonDataLoss, models.ReasonAccessExclusiveLock)}
+		table.Severity = models.SeverityDestructive
+	}
+	for i := range diff.TablesModified {
+		classifyTableRisks(&diff.TablesModified[i])
+	}
+
+	for _, seq := range diff.SequencesAdded {
+		diff.Risks = append(diff.Risks, newRisk("sequence", seq.SchemaName+"."+seq.Name, "added"))
+	}
+	for _, seq := range diff.SequencesRemoved {
+		diff.Risks = append(diff.Risks, newRisk("sequence", seq.SchemaName+"."+seq.Name, "removed", models.ReasonDataLoss))
+	}
+	for _, change := range diff.SequencesModified {
+		var reasons []string
+		if change.Target.MinValue > change.Source.MinValue || change.Target.MaxValue < change.Source.MaxValue {
+			reasons = append(reasons, models.ReasonRangeNarrowing)
+		}
+		diff.Risks = append(diff.Risks, newRisk("sequence", change.SchemaName+"."+change.Name, "modified", reasons...))
+	}
+
+	counts := map[string]int{}
+	tally := func(risks []models.ChangeRisk) {
+		for _, risk := range risks {
+			counts[risk.Severity]++
+			diff.Severity = models.MaxSeverity(diff.Severity, risk.Severity)
+		}
+	}
+	tally(diff.Risks)
+	for _, tables := range [][]models.TableDiff{diff.TablesAdded, diff.TablesRemoved, diff.TablesModified} {
+		for _, table := range tables {
+			tally(table.Risks)
+		}
+	}
+
+	for _, severity := range []string{models.SeveritySafe, models.SeverityCaution, models.SeverityDestructive} {
+		diff.Summary["risk_"+severity] = counts[severity]
+	}
+}
+
+// classifyTableRisks annotates the element changes of a modified table
+func classifyTableRisks(table *models.TableDiff) {
+	table.Risks = nil
+	tableName := table.SchemaName + "." + table.Name
+	add := func(objectType, name, action string, reasons ...string) {
+		risk := newRisk(objectType, name, action, reasons...)
+		risk.TableName = tableName
+		table.Risks = append(table.Risks, risk)
+	}
+
+	for _, col := range table.ColumnsAdded {
+		var reasons []string
+		if !col.IsNullable && col.Default == "" {
+			reasons = append(reasons, models.ReasonNotNullWithoutDefault)
+		}
+		if volatileDefaultPattern.MatchString(col.Default) {
+			reasons = append(reasons, models.ReasonTableRewrite, models.ReasonAccessExclusiveLock)
+		}
+		if col.IsPrimary {
+			reasons = append(reasons, models.ReasonAccessExclusiveLock)
+		}
+		add("column", col.Name, "added", reasons...)
+	}
+	for _, col := range table.ColumnsRemoved {
+		add("column", col.Name, "removed", models.ReasonDataLoss)
+	}
+	for _, change := range table.ColumnsModified {
+		var reasons []string
+		for _, attr := range change.ChangedAttr {
+			switch attr {
+			case "data_type":
+				reasons = append(reasons, typeChangeReasons(change.Source.DataType, change.Target.DataType)...)
+			case "is_nullable":
+				if change.Source.IsNullable && !change.Target.IsNullable {
+					reasons = append(reasons, models.ReasonNotNullOnExistingColumn, models.ReasonAccessExclusiveLock)
+				}
+			case "is_primary":
+				reasons = append(reasons, models.ReasonAccessExclusiveLock)
+			}
+		}
+		add("column", change.Name, "modified", reasons...)
+	}
+
+	for _, idx := range table.IndexesAdded {
+		add("index", idx.Name, "added", models.ReasonBlocksWrites)
+	}
+	for _, idx := range table.IndexesRemoved {
+		add("index", idx.Name, "removed", models.ReasonAccessExclusiveLock)
+	}
+	for _, change := range table.IndexesModified {
+		add("index", change.Name, "modified", models.ReasonAccessExclusiveLock, models.ReasonBlocksWrites)
+	}
+
+	for _, fk := range table.ForeignKeyAdded {
+		add("foreign_key", fk.Name, "added", models.ReasonBlocksWrites)
+	}
+	for _, fk := range table.ForeignKeyRemoved {
+		add("foreign_key", fk.Name, "removed", models.ReasonAccessExclusiveLock)
+	}
+	for _, change := range table.ForeignKeyModified {
+		add("foreign_key", change.Name, "modified", models.ReasonAccessExclusiveLock, models.ReasonBlocksWrites)
+	}
+
+	table.Severity = models.SeveritySafe
+	for _, risk := range table.Risks {
+		table.Severity = models.MaxSeverity(table.Severity, risk.Severity)
+	}
+}
+
+// newRisk builds a change risk whose severity follows from its reasons: data
+// loss and narrowing are destructive, any other reason calls for caution
+func newRisk(objectType, name, action string, reasons ...string) models.ChangeRisk {
+	risk := models.ChangeRisk{
+		ObjectType: objectType,
+		Name:       name,
+		Action:     action,
+		Severity:   models.SeveritySafe,
+		Reasons:    dedupe(reasons),
+	}
+	for _, reason := range risk.Reasons {
+		switch reason {
+		case models.ReasonDataLoss, models.ReasonTypeNarrowing:
+			risk.Severity = models.SeverityDestructive
+		default:
+			risk.Severity = models.MaxSeverity(risk.Severity, models.SeverityCaution)
+		}
+	}
+	return risk
+}
+
+func dedupe(values []string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// parsedType is a PostgreSQL data type split into its base name and modifiers
+type parsedType struct {
+	base      string
+	modifiers []int // nil when unconstrained, e.g. varchar without length
+	array     bool
+}
+
+func parseType(dataType string) parsedType {
+	normalized := NormalizePostgresType(models.Column{DataType: dataType}).DataType
+	match := typeModifierPattern.FindStringSubmatch(normalized)
+	if match == nil {
+		return parsedType{base: normalized}
+	}
+
+	parsed := parsedType{base: match[1], array: match[3] != ""}
+	for _, value := range strings.Split(strings.Trim(match[2], "()"), ",") {
+		if n, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+			parsed.modifiers = append(parsed.modifiers, n)
+		}
+	}
+	return parsed
+}
+
+// typeChangeReasons explains the risk of converting a column from one data
+// type to another: narrowing conversions may lose data or fail, widening ones
+// that PostgreSQL cannot do in place rewrite the table
+func typeChangeReasons(from, to string) []string {
+	source, target := parseType(from), parseType(to)
+	rewrite := []string{models.ReasonTableRewrite, models.ReasonAccessExclusiveLock}
+	narrowing := []string{models.ReasonTypeNarrowing, models.ReasonDataLoss, models.ReasonAccessExclusiveLock}
+
+	if source.array != target.array {
+		return narrowing
+	}
+
+	switch {
+	case source.base == target.base:
+		if modifiersNarrowed(source.modifiers, target.modifiers) {
+			return narrowing
+		}
+		// Lengthening varchar or numeric precision is done in place
+		if source.base == "character varying" || source.base == "numeric" {
+			return nil
+		}
+		return rewrite
+	case source.base == "character varying" && target.base == "text":
+		return nil
+	case stringTypes[source.base]:
+		if target.base == "text" || (stringTypes[target.base] && !modifiersNarrowed(source.modifiers, target.modifiers)) {
+			return rewrite
+		}
+		return narrowing
+	case integerRanks[source.base] > 0 && integerRanks[target.base] > 0:
+		if integerRanks[target.base] < integerRanks[source.base] {
+			return narrowing
+		}
+		return rewrite
+	case floatRanks[source.base] > 0 && floatRanks[target.base] > 0:
+		if floatRanks[target.base] < floatRanks[source.base] {
+			return narrowing
+		}
+		return rewrite
+	case integerRanks[source.base] > 0 && (target.base == "numeric" || stringTypes[target.base]):
+		return rewrite
+	default:
+		return narrowing
+	}
+}
+
+// modifiersNarrowed reports whether the target length/precision constraints
+// admit fewer values than the source ones
+func modifiersNarrowed(source, target []int) bool {
+	if len(target) == 0 {
+		return false
+	}
+	if len(source) == 0 {
+		return true
+	}
+	for i := range target {
+		if i < len(source) && target[i] < source[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// RiskViolations lists the changes of the diff riskier than the allowed level
+func RiskViolations(diff models.SchemaDiff, maxRisk string) []models.ChangeRisk {
+	var violations []models.ChangeRisk
+	collect := func(risks []models.ChangeRisk) {
+		for _, risk := range risks {
+			if models.SeverityExceeds(risk.Severity, maxRisk) {
+				violations = append(violations, risk)
+			}
+		}
+	}
+
+	collect(diff.Risks)
+	for _, tables := range [][]models.TableDiff{diff.TablesAdded, diff.TablesRemoved, diff.TablesModified} {
+		for _, table := range tables {
+			collect(table.Risks)
+		}
+	}
+	return violations
+}
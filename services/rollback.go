@@ -0,0 +1,66 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"gorm.io/gorm"
+)
+
+// MigrationRollback is the outcome of running a migration's down script
+type MigrationRollback struct {
+	MigrationID uint               `json:"migration_id"`
+	Execution   MigrationExecution `json:"execution"`
+	Verified    bool               `json:"verified"`    // Target matches the schema it had before the migration
+	Differences models.SchemaDiff  `json:"differences"` // From the rolled back schema to the pre-migration one
+}
+
+// RollbackMigration runs the down script of an applied migration against the
+// target and checks the target against the snapshot taken before the
+// migration, both filtered by the filters given. The outcome is saved on the
+// migration: rolled back once the script ran, with an error when it failed or
+// left differences. Errors are returned when the metadata cannot be read or
+// saved or the target cannot be dumped.
+func RollbackMigration(metadata, target *gorm.DB, migration *models.Migration, filters ...models.ObjectFilter) (MigrationRollback, error) {
+	result := MigrationRollback{MigrationID: migration.ID}
+
+	var before []models.Schema
+	if migration.SnapshotID != nil {
+		var snapshot models.Snapshot
+		if err := metadata.First(&snapshot, *migration.SnapshotID).Error; err != nil {
+			return result, fmt.Errorf("failed to load pre-migration snapshot: %v", err)
+		}
+		before = snapshot.Schemas
+	}
+
+	result.Execution = ApplyMigration(target, ScriptSteps(migration.Down))
+	if !result.Execution.Success {
+		migration.Error = fmt.Sprintf("rollback failed at %s: %s", result.Execution.Failed.Step, result.Execution.Failed.Error)
+		return result, metadata.Save(migration).Error
+	}
+
+	rolledBackAt := time.Now()
+	migration.Status = models.MigrationRolledBack
+	migration.RolledBackAt = &rolledBackAt
+	migration.Error = ""
+
+	if migration.SnapshotID == nil {
+		migration.Error = "rollback not verified, no pre-migration snapshot"
+		return result, metadata.Save(migration).Error
+	}
+
+	after, err := DumpSchema(target, filters...)
+	if err != nil {
+		return result, fmt.Errorf("failed to dump target: %v", err)
+	}
+	for _, filter := range filters {
+		before = FilterSchemas(before, filter)
+	}
+	result.Differences = CompareSchemas(dialectName(target), after, before)
+	result.Verified = !result.Differences.HasChanges()
+	if !result.Verified {
+		migration.Error = "rollback left differences with the pre-migration schema"
+	}
+	return result, metadata.Save(migration).Error
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"gorm.io/gorm"
+)
+
+// MigrationVerification is the outcome of applying a migration and reverting
+// it on a scratch database
+type MigrationVerification struct {
+	Passed      bool              `json:"passed"`
+	FailedStep  string            `json:"failed_step,omitempty"` // ID of the step that failed, prefixed by its direction
+	Error       string            `json:"error,omitempty"`
+	Differences models.SchemaDiff `json:"differences"` // From the original schema to the one left by up then down
+}
+
+// VerifyMigration checks that the down migration undoes the up one. The
+// scratch database is first brought to the source schema, then the plan's up
+// and down steps are applied one by one and the resulting schema is compared
+// with the original. Errors are returned for scratch databases that cannot be
+// prepared or dumped, failing steps are reported in the verification.
+func VerifyMigration(scratch *gorm.DB, dialect string, source []models.Schema, plan MigrationPlan) (MigrationVerification, error) {
+	var result MigrationVerification
+
+	current, err := DumpSchema(scratch)
+	if err != nil {
+		return result, fmt.Errorf("failed to dump scratch database: %v", err)
+	}
+	for _, step := range PlanMigration(dialect, CompareSchemas(dialect, current, source)).Up {
+		if err := scratch.Exec(step.SQL).Error; err != nil {
+			return result, fmt.Errorf("failed to prepare scratch database at %s: %v", step.ID, err)
+		}
+	}
+
+	original, err := DumpSchema(scratch)
+	if err != nil {
+		return result, fmt.Errorf("failed to dump scratch database: %v", err)
+	}
+
+	for _, direction := range []struct {
+		name  string
+		steps []MigrationStep
+	}{{"up", plan.Up}, {"down", plan.Down}} {
+		for _, step := range direction.steps {
+			if err := scratch.Exec(step.SQL).Error; err != nil {
+				result.FailedStep = direction.name + ":" + step.ID
+				result.Error = err.Error()
+				return result, nil
+			}
+		}
+	}
+
+	reverted, err := DumpSchema(scratch)
+	if err != nil {
+		return result, fmt.Errorf("failed to dump scratch database: %v", err)
+	}
+	result.Differences = CompareSchemas(dialect, original, reverted)
+	result.Passed = !result.Differences.HasChanges()
+	return result, nil
+}
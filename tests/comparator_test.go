@@ -1,9 +1,13 @@
 package tests
 
 import (
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gorm.io/gorm"
 
 	"github.com/Tsarbomba69-com/mammoth.server/models"
@@ -20,7 +24,7 @@ func TestCompareSchemas(t *testing.T) {
 		source := SetupSchemaDump(t, "source", schemaFunc)
 		target := SetupSchemaDump(t, "target", schemaFunc)
 
-		diff := services.CompareSchemas(source, target)
+		diff := services.CompareSchemas("sqlite", source, target)
 
 		assert.Equal(t, 1, diff.Summary["tables_same"])
 		assert.Equal(t, 0, diff.Summary["tables_added"])
@@ -39,7 +43,7 @@ func TestCompareSchemas(t *testing.T) {
 			db.Exec("CREATE TABLE posts (id INTEGER PRIMARY KEY, title TEXT, user_id INTEGER)")
 		})
 
-		diff := services.CompareSchemas(source, target)
+		diff := services.CompareSchemas("sqlite", source, target)
 
 		assert.Equal(t, 1, diff.Summary["tables_same"])
 		assert.Equal(t, 1, diff.Summary["tables_added"])
@@ -58,7 +62,7 @@ func TestCompareSchemas(t *testing.T) {
 			db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)")
 		})
 
-		diff := services.CompareSchemas(source, target)
+		diff := services.CompareSchemas("sqlite", source, target)
 
 		assert.Equal(t, 1, diff.Summary["tables_same"])
 		assert.Equal(t, 0, diff.Summary["tables_added"])
@@ -76,7 +80,7 @@ func TestCompareSchemas(t *testing.T) {
 			db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, name VARCHAR(255))")
 		})
 
-		diff := services.CompareSchemas(source, target)
+		diff := services.CompareSchemas("sqlite", source, target)
 
 		assert.Equal(t, 0, diff.Summary["tables_same"])
 		assert.Equal(t, 0, diff.Summary["tables_added"])
@@ -98,7 +102,7 @@ func TestCompareSchemas(t *testing.T) {
 			db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, email TEXT)")
 		})
 
-		diff := services.CompareSchemas(source, target)
+		diff := services.CompareSchemas("sqlite", source, target)
 
 		assert.Equal(t, 0, diff.Summary["tables_same"])
 		assert.Equal(t, 0, diff.Summary["tables_added"])
@@ -119,7 +123,7 @@ func TestCompareSchemas(t *testing.T) {
 			db.Exec("CREATE INDEX idx_users_name ON users(name)")
 		})
 
-		diff := services.CompareSchemas(source, target)
+		diff := services.CompareSchemas("sqlite", source, target)
 
 		assert.Equal(t, 0, diff.Summary["tables_same"])
 		assert.Equal(t, 0, diff.Summary["tables_added"])
@@ -141,7 +145,7 @@ func TestCompareSchemas(t *testing.T) {
 			db.Exec("CREATE TABLE posts (id INTEGER PRIMARY KEY, title TEXT, user_id INTEGER, FOREIGN KEY(user_id) REFERENCES users(id))")
 		})
 
-		diff := services.CompareSchemas(source, target)
+		diff := services.CompareSchemas("sqlite", source, target)
 
 		assert.Equal(t, 1, diff.Summary["tables_same"]) // users table
 		assert.Equal(t, 0, diff.Summary["tables_added"])
@@ -156,7 +160,7 @@ func TestCompareSchemas(t *testing.T) {
 		source := mocks.IdenticalSourceSchema
 		target := mocks.IdenticalTargetSchema
 		// Act
-		diff := services.CompareSchemas(source, target)
+		diff := services.CompareSchemas("postgres", source, target)
 		// Assert
 		// 1. Verify no sequences were added, removed, or modified
 		assert.Empty(t, diff.SequencesAdded, "Expected no added sequences")
@@ -197,7 +201,7 @@ func TestCompareSchemas(t *testing.T) {
 		}}
 
 		// Act
-		diff := services.CompareSchemas(source, target)
+		diff := services.CompareSchemas("postgres", source, target)
 
 		// Assert
 		assert.Empty(t, diff.SequencesRemoved)
@@ -243,7 +247,7 @@ func TestCompareSchemas(t *testing.T) {
 		}}
 
 		// Act
-		diff := services.CompareSchemas(source, target)
+		diff := services.CompareSchemas("postgres", source, target)
 
 		// Assert
 		assert.Empty(t, diff.SequencesAdded)
@@ -266,4 +270,178 @@ func TestCompareSchemas(t *testing.T) {
 		assert.Equal(t, 1, diff.Summary["sequences_modified"])
 		assert.Equal(t, 0, diff.Summary["sequences_same"])
 	})
+
+	t.Run("same names in different schemas", func(t *testing.T) {
+		// Arrange
+		users := func(schemaName string, columns ...string) models.TableSchema {
+			table := models.TableSchema{Name: "users", SchemaName: schemaName}
+			for _, name := range columns {
+				table.Columns = append(table.Columns, models.Column{Name: name, DataType: "integer"})
+			}
+			return table
+		}
+		seq := func(schemaName string, increment int64) models.Sequence {
+			return models.Sequence{Name: "users_id_seq", SchemaName: schemaName, StartValue: 1, Increment: increment}
+		}
+		source := []models.Schema{
+			{Name: "public", Tables: []models.TableSchema{users("public", "id")}, Sequences: []models.Sequence{seq("public", 1)}},
+			{Name: "audit", Tables: []models.TableSchema{users("audit", "id")}, Sequences: []models.Sequence{seq("audit", 1)}},
+		}
+		target := []models.Schema{
+			{Name: "public", Tables: []models.TableSchema{users("public", "id", "age")}, Sequences: []models.Sequence{seq("public", 1)}},
+			{Name: "audit", Tables: []models.TableSchema{users("audit", "id", "actor")}, Sequences: []models.Sequence{seq("audit", 5)}},
+		}
+
+		// Act
+		diff := services.CompareSchemas("postgres", source, target)
+
+		// Assert
+		require.Len(t, diff.TablesModified, 2)
+		assert.Equal(t, "audit", diff.TablesModified[0].SchemaName)
+		assert.Equal(t, "actor", diff.TablesModified[0].ColumnsAdded[0].Name)
+		assert.Equal(t, "public", diff.TablesModified[1].SchemaName)
+		assert.Equal(t, "age", diff.TablesModified[1].ColumnsAdded[0].Name)
+
+		require.Len(t, diff.SequencesModified, 1)
+		assert.Equal(t, "audit", diff.SequencesModified[0].SchemaName)
+		assert.Equal(t, []string{"users_id_seq"}, diff.SequencesSame)
+	})
+
+	t.Run("filtered objects", func(t *testing.T) {
+		// Arrange
+		source := SetupSchemaDump(t, "source_filtered", func(db *gorm.DB) {
+			db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)")
+		})
+		target := SetupSchemaDump(t, "target_filtered", func(db *gorm.DB) {
+			db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, tmp_flag INTEGER REFERENCES users (id))")
+			db.Exec("CREATE INDEX idx_users_tmp_flag ON users (tmp_flag)")
+			db.Exec("CREATE TABLE flyway_schema_history (id INTEGER PRIMARY KEY)")
+			db.Exec("CREATE TABLE databasechangelog (id INTEGER PRIMARY KEY)")
+		})
+		filter := models.ObjectFilter{
+			ExcludeTables:  []string{"flyway_*", "re:^databasechange(log|loglock)$"},
+			ExcludeColumns: []string{"users.tmp_*"},
+		}
+
+		// Act
+		diff := services.CompareSchemas("sqlite", source, target, filter)
+
+		// Assert
+		assert.Empty(t, diff.TablesAdded)
+		assert.Empty(t, diff.TablesModified)
+		assert.Equal(t, []string{"users"}, diff.TablesSame)
+	})
+
+	t.Run("include filter and object toggles", func(t *testing.T) {
+		// Arrange
+		source := SetupSchemaDump(t, "source_include", func(db *gorm.DB) {
+			db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)")
+			db.Exec("CREATE TABLE posts (id INTEGER PRIMARY KEY)")
+		})
+		target := SetupSchemaDump(t, "target_include", func(db *gorm.DB) {
+			db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)")
+			db.Exec("CREATE INDEX idx_users_name ON users(name)")
+		})
+		skip := true
+		filter := models.ObjectFilter{
+			IncludeTables: []string{"main.users"},
+			SkipIndexes:   &skip,
+		}
+
+		// Act
+		diff := services.CompareSchemas("sqlite", source, target, filter)
+
+		// Assert
+		assert.Empty(t, diff.TablesRemoved)
+		assert.Empty(t, diff.TablesModified)
+		assert.Equal(t, []string{"users"}, diff.TablesSame)
+	})
+
+	t.Run("overrides turn toggles off", func(t *testing.T) {
+		skip, keep := true, false
+		project := models.ObjectFilter{SkipIndexes: &skip, SkipSequences: &skip}
+
+		merged := project.Merge(models.ObjectFilter{SkipIndexes: &keep})
+
+		assert.False(t, merged.SkipsIndexes(), "an explicit false must override the project")
+		assert.True(t, merged.SkipsSequences(), "unset toggles keep the project's setting")
+		assert.False(t, merged.SkipsForeignKeys())
+	})
+
+	t.Run("invalid filter pattern", func(t *testing.T) {
+		filter := models.ObjectFilter{ExcludeTables: []string{"re:("}}
+		assert.Error(t, filter.Validate())
+	})
+}
+
+func TestDumpSchema_SequenceOwnership(t *testing.T) {
+	original, ok := services.QuerySetFor("sqlite")
+	if !ok {
+		t.Fatal("no sqlite query set")
+	}
+	withSequences := original
+	withSequences.Sequence = `
+		SELECT 'users_id_seq' AS name, 'main' AS schema_name, 1 AS start_value, 1 AS minimum_value,
+		       9223372036854775807 AS maximum_value, 1 AS increment, 'NO' AS is_cyclic
+		UNION ALL
+		SELECT 'audit_id_seq', 'main', 1, 1, 9223372036854775807, 1, 'NO'
+		UNION ALL
+		SELECT 'events_id_seq', 'audit', 1, 1, 9223372036854775807, 1, 'NO'`
+	withSequences.SequenceOwnership = `
+		SELECT 'main' AS sequence_schema, 'users_id_seq' AS sequence_name,
+		       'main' AS table_schema, 'users' AS table_name, 'id' AS column_name
+		UNION ALL
+		SELECT 'main', 'audit_id_seq', 'audit', 'events', 'id'`
+	services.RegisterQuerySet("sqlite", withSequences)
+	t.Cleanup(func() { services.RegisterQuerySet("sqlite", original) })
+
+	target := SetupSchemaDump(t, "target_sequence_owner", func(db *gorm.DB) {
+		db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY)")
+	})
+
+	require.Len(t, target, 1, "each schema is dumped once")
+	assert.Len(t, target[0].Sequences, 2, "schemas only hold their own sequences")
+
+	sequences := map[string]models.Sequence{}
+	for _, schema := range target {
+		for _, seq := range schema.Sequences {
+			sequences[seq.Name] = seq
+		}
+	}
+	assert.Len(t, sequences, 2)
+	assert.Equal(t, "users", sequences["users_id_seq"].OwnedByTable)
+	assert.Equal(t, "id", sequences["users_id_seq"].OwnedByColumn)
+	assert.Equal(t, "audit.events", sequences["audit_id_seq"].OwnedByTable, "owners in other schemas stay qualified")
+
+	t.Run("ownership is set after the owning table is created", func(t *testing.T) {
+		migration := services.Generate("postgres", services.CompareSchemas("sqlite", []models.Schema{{Name: "main"}}, target))
+
+		owned := strings.Index(migration.Up, `ALTER SEQUENCE "main"."users_id_seq" OWNED BY "main"."users"."id";`)
+		created := strings.Index(migration.Up, `CREATE TABLE "main"."users"`)
+		assert.Greater(t, owned, created, migration.Up)
+	})
+}
+
+func TestDumpSchema_ErrorsDoNotLeakGoroutines(t *testing.T) {
+	db := SetupDB(t, "dump_error", func(db *gorm.DB) {
+		db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY)")
+	})
+	_, err := services.DumpSchema(db) // Opens the connections of the pool
+	require.NoError(t, err)
+	before := runtime.NumGoroutine()
+
+	original, _ := services.QuerySetFor("sqlite")
+	broken := original
+	broken.Index = "SELECT * FROM missing_table"
+	services.RegisterQuerySet("sqlite", broken)
+	t.Cleanup(func() { services.RegisterQuerySet("sqlite", original) })
+
+	_, err = services.DumpSchema(db)
+
+	assert.Error(t, err)
+	// Polled by hand, assert.Eventually runs its condition in a goroutine
+	for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > before && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before, "goroutines of the failed dump are still running")
 }
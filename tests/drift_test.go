@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+)
+
+func TestDriftScheduler(t *testing.T) {
+	db := SetupMetadataDB(t, "metadata_drift")
+
+	var payloads []services.DriftWebhookPayload
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload services.DriftWebhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err == nil {
+			payloads = append(payloads, payload)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhook.Close()
+
+	project := models.Project{Name: "Drift", DriftSchedule: "*/5 * * * *", DriftWebhookURL: webhook.URL}
+	require.NoError(t, db.Create(&project).Error)
+
+	drifted := services.CompareSchemas("postgres", nil, []models.Schema{{Name: "public", Tables: []models.TableSchema{{
+		Name: "audit", SchemaName: "public",
+		Columns: []models.Column{{Name: "id", DataType: "integer"}},
+	}}}})
+	diffs := []models.SchemaDiff{drifted, drifted, services.CompareSchemas("postgres", nil, nil)}
+	var detectErr error
+	run := 0
+	scheduler := services.NewDriftScheduler(db, func(models.Project) (models.SchemaDiff, error) {
+		diff := diffs[run%len(diffs)]
+		run++
+		return diff, detectErr
+	})
+	require.NoError(t, scheduler.Schedule(project))
+
+	t.Run("new drift fires the webhook", func(t *testing.T) {
+		event, err := scheduler.Run(project.ID)
+
+		require.NoError(t, err)
+		assert.True(t, event.HasDrift)
+		assert.True(t, event.Changed)
+		assert.Equal(t, http.StatusNoContent, event.WebhookStatus)
+		require.Len(t, payloads, 1)
+		assert.Equal(t, 1, payloads[0].Summary["tables_added"])
+	})
+
+	t.Run("unchanged drift still fires the webhook", func(t *testing.T) {
+		event, err := scheduler.Run(project.ID)
+
+		require.NoError(t, err)
+		assert.True(t, event.HasDrift)
+		assert.False(t, event.Changed)
+		assert.Len(t, payloads, 2)
+	})
+
+	t.Run("resolved drift fires the webhook once", func(t *testing.T) {
+		event, err := scheduler.Run(project.ID)
+		require.NoError(t, err)
+		assert.False(t, event.HasDrift)
+		assert.True(t, event.Changed)
+		assert.Len(t, payloads, 3)
+
+		run = 2 // Keep returning the empty diff
+		event, err = scheduler.Run(project.ID)
+		require.NoError(t, err)
+		assert.False(t, event.Changed)
+		assert.Len(t, payloads, 3)
+	})
+
+	t.Run("detection errors are recorded", func(t *testing.T) {
+		detectErr = errors.New("connection refused")
+		defer func() { detectErr = nil }()
+
+		event, err := scheduler.Run(project.ID)
+
+		require.NoError(t, err)
+		assert.Equal(t, "connection refused", event.Error)
+		assert.Len(t, payloads, 3)
+		var count int64
+		db.Model(&models.DriftEvent{}).Where("project_id = ?", project.ID).Count(&count)
+		assert.Equal(t, int64(5), count)
+	})
+
+	t.Run("invalid schedule", func(t *testing.T) {
+		assert.Error(t, services.ValidateCron("every minute"))
+		assert.NoError(t, services.ValidateCron("0 3 * * 1-5"))
+	})
+}
+
+func TestDriftScheduler_SkipsOverlappingRuns(t *testing.T) {
+	db := SetupMetadataDB(t, "metadata_drift_overlap")
+	require.NoError(t, db.Create(&models.Project{Name: "Slow", DriftSchedule: "@every 1s"}).Error)
+
+	var runs atomic.Int32
+	release := make(chan struct{})
+	scheduler := services.NewDriftScheduler(db, func(models.Project) (models.SchemaDiff, error) {
+		runs.Add(1)
+		<-release
+		return services.CompareSchemas("postgres", nil, nil), nil
+	})
+	require.NoError(t, scheduler.Start())
+
+	require.Eventually(t, func() bool { return runs.Load() == 1 }, 3*time.Second, 10*time.Millisecond)
+	time.Sleep(1500 * time.Millisecond) // At least one more tick while the first run blocks
+
+	assert.Equal(t, int32(1), runs.Load())
+	close(release)
+	scheduler.Stop()
+}
@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+)
+
+func TestScriptSteps(t *testing.T) {
+	script := `BEGIN;
+-- add a column; keep it nullable
+ALTER TABLE "users" ADD COLUMN "note" TEXT DEFAULT 'a;b';
+CREATE FUNCTION touch() RETURNS trigger LANGUAGE plpgsql AS $body$
+BEGIN
+  NEW.note := 'x;y';
+  RETURN NEW;
+END
+$body$;
+COMMIT;
+/* concurrent; build */
+CREATE INDEX CONCURRENTLY "idx_users_note" ON "users" ("note");
+DO $$ BEGIN PERFORM 1; END $$;
+`
+
+	steps := services.ScriptSteps(script)
+
+	require.Len(t, steps, 4)
+	assert.Equal(t, "statement:1", steps[0].ID)
+	assert.Equal(t, "-- add a column; keep it nullable\nALTER TABLE \"users\" ADD COLUMN \"note\" TEXT DEFAULT 'a;b';\n", steps[0].SQL)
+	assert.Contains(t, steps[1].SQL, "NEW.note := 'x;y';")
+	assert.True(t, steps[1].Transactional)
+	assert.Contains(t, steps[2].SQL, "CREATE INDEX CONCURRENTLY")
+	assert.False(t, steps[2].Transactional)
+	assert.Equal(t, "DO $$ BEGIN PERFORM 1; END $$;\n", steps[3].SQL)
+}
+
+func TestApplyMigration(t *testing.T) {
+	statuses := func(execution services.MigrationExecution) []string {
+		var statuses []string
+		for _, statement := range execution.Statements {
+			statuses = append(statuses, statement.Status)
+		}
+		return statuses
+	}
+	tableExists := func(db *gorm.DB, name string) bool {
+		var count int64
+		db.Raw(`SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, name).Scan(&count)
+		return count > 0
+	}
+
+	t.Run("statements are applied", func(t *testing.T) {
+		db := SetupDB(t, "apply_success", func(db *gorm.DB) {})
+
+		execution := services.ApplyMigration(db, services.ScriptSteps(`CREATE TABLE teams (id INTEGER PRIMARY KEY);
+			CREATE TABLE users (id INTEGER PRIMARY KEY, team_id INTEGER REFERENCES teams (id));`))
+
+		assert.True(t, execution.Success)
+		assert.Nil(t, execution.Failed)
+		assert.Equal(t, []string{services.StatementApplied, services.StatementApplied}, statuses(execution))
+		assert.True(t, tableExists(db, "users"))
+	})
+
+	t.Run("failures roll back their transaction and stop", func(t *testing.T) {
+		db := SetupDB(t, "apply_failure", func(db *gorm.DB) {})
+		steps := services.ScriptSteps(`CREATE TABLE teams (id INTEGER PRIMARY KEY);
+			CREATE TABLE users (id INTEGER PRIMARY KEY);
+			ALTER TABLE missing ADD COLUMN name TEXT;
+			CREATE TABLE posts (id INTEGER PRIMARY KEY);`)
+		steps[0].Transactional = false // Committed on its own, like a concurrent index build
+
+		execution := services.ApplyMigration(db, steps)
+
+		assert.False(t, execution.Success)
+		assert.Equal(t, []string{services.StatementApplied, services.StatementRolledBack, services.StatementFailed, services.StatementSkipped}, statuses(execution))
+		if assert.NotNil(t, execution.Failed) {
+			assert.Equal(t, "statement:3", execution.Failed.Step)
+			assert.Contains(t, execution.Failed.Error, "missing")
+		}
+		assert.True(t, tableExists(db, "teams"))
+		assert.False(t, tableExists(db, "users"))
+		assert.False(t, tableExists(db, "posts"))
+	})
+}
+
+func TestDryRunMigration(t *testing.T) {
+	intended := SetupSchemaDump(t, "intended_dry_run", func(db *gorm.DB) {
+		db.Exec(`CREATE TABLE teams (id INTEGER PRIMARY KEY)`)
+		db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, team_id INTEGER)`)
+	})
+	tableExists := func(db *gorm.DB, name string) bool {
+		var count int64
+		db.Raw(`SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, name).Scan(&count)
+		return count > 0
+	}
+
+	t.Run("matching migration is rolled back", func(t *testing.T) {
+		db := SetupDB(t, "dry_run_match", func(db *gorm.DB) {
+			db.Exec(`CREATE TABLE teams (id INTEGER PRIMARY KEY)`)
+		})
+		current, err := services.DumpSchema(db)
+		require.NoError(t, err)
+		steps := services.PlanMigration("postgres", services.CompareSchemas("sqlite", current, intended)).Up
+
+		result, err := services.DryRunMigration(db, steps, time.Second, intended)
+
+		require.NoError(t, err)
+		assert.True(t, result.Success)
+		assert.Empty(t, result.Errors)
+		assert.True(t, result.Matches, "%+v", result.Differences)
+		for _, statement := range result.Statements {
+			assert.Equal(t, services.StatementRolledBack, statement.Status)
+		}
+		assert.False(t, tableExists(db, "users"))
+	})
+
+	t.Run("every failure is collected", func(t *testing.T) {
+		db := SetupDB(t, "dry_run_errors", func(db *gorm.DB) {})
+		steps := services.ScriptSteps(`CREATE TABLE teams (id INTEGER PRIMARY KEY);
+			ALTER TABLE missing ADD COLUMN name TEXT;
+			CREATE TABLE users (id INTEGER PRIMARY KEY, team_id INTEGER);
+			DROP TABLE nowhere;`)
+
+		result, err := services.DryRunMigration(db, steps, time.Second, intended)
+
+		require.NoError(t, err)
+		assert.False(t, result.Success)
+		require.Len(t, result.Errors, 2)
+		assert.Equal(t, "statement:2", result.Failed.Step)
+		assert.Equal(t, "statement:4", result.Errors[1].Step)
+		assert.Equal(t, services.StatementRolledBack, result.Statements[2].Status)
+		assert.True(t, result.Matches, "statements after a failure still run")
+		assert.False(t, tableExists(db, "teams"))
+	})
+
+	t.Run("differences with the intended schema", func(t *testing.T) {
+		db := SetupDB(t, "dry_run_mismatch", func(db *gorm.DB) {})
+
+		result, err := services.DryRunMigration(db, services.ScriptSteps(`CREATE TABLE teams (id INTEGER PRIMARY KEY);`), time.Second, intended)
+
+		require.NoError(t, err)
+		assert.True(t, result.Success)
+		assert.False(t, result.Matches)
+		if assert.Len(t, result.Differences.TablesAdded, 1) {
+			assert.Equal(t, "users", result.Differences.TablesAdded[0].Name)
+		}
+	})
+}
@@ -0,0 +1,269 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/Tsarbomba69-com/mammoth.server/controllers"
+	"github.com/Tsarbomba69-com/mammoth.server/exporters"
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+)
+
+func exportFiles(t *testing.T, format string, script services.MigrationScript) map[string]string {
+	return exportPlan(t, format, services.ScriptPlan(script))
+}
+
+func exportPlan(t *testing.T, format string, plan services.MigrationPlan) map[string]string {
+	exporter, err := exporters.NewExporter(format)
+	require.NoError(t, err)
+	files, err := exporter.Export("20260101120000", "Add users.email", plan)
+	require.NoError(t, err)
+
+	contents := make(map[string]string)
+	for _, file := range files {
+		contents[file.Name] = string(file.Content)
+	}
+	return contents
+}
+
+func unzip(t *testing.T, data []byte) map[string]string {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	contents := make(map[string]string)
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		contents[file.Name] = string(content)
+	}
+	return contents
+}
+
+func TestExporters(t *testing.T) {
+	script := services.MigrationScript{
+		Up:   "ALTER TABLE \"public\".\"users\" ADD COLUMN \"email\" text;\n",
+		Down: "ALTER TABLE \"public\".\"users\" DROP COLUMN \"email\";\n",
+	}
+	concurrent := services.MigrationScript{
+		Up:   "CREATE INDEX CONCURRENTLY \"idx_users_email\" ON \"public\".\"users\" (\"email\");\n",
+		Down: "DROP INDEX CONCURRENTLY \"public\".\"idx_users_email\";\n",
+	}
+
+	t.Run("golang-migrate", func(t *testing.T) {
+		files := exportFiles(t, "golang-migrate", script)
+
+		assert.Equal(t, map[string]string{
+			"20260101120000_add_users_email.up.sql":   script.Up,
+			"20260101120000_add_users_email.down.sql": script.Down,
+		}, files)
+	})
+
+	t.Run("flyway", func(t *testing.T) {
+		files := exportFiles(t, "flyway", script)
+
+		assert.Equal(t, map[string]string{
+			"V20260101120000__add_users_email.sql": script.Up,
+			"U20260101120000__add_users_email.sql": script.Down,
+		}, files)
+
+		files = exportFiles(t, "flyway", concurrent)
+		assert.Equal(t, "executeInTransaction=false\n", files["V20260101120000__add_users_email.sql.conf"])
+	})
+
+	t.Run("goose", func(t *testing.T) {
+		files := exportFiles(t, "goose", script)
+
+		assert.Equal(t, "-- +goose Up\n-- +goose StatementBegin\n"+script.Up+"-- +goose StatementEnd\n"+
+			"-- +goose Down\n-- +goose StatementBegin\n"+script.Down+"-- +goose StatementEnd\n",
+			files["20260101120000_add_users_email.sql"])
+
+		files = exportFiles(t, "goose", concurrent)
+		assert.Contains(t, files["20260101120000_add_users_email.sql"], "-- +goose NO TRANSACTION\n")
+
+		function := "CREATE FUNCTION \"public\".\"touch\"() RETURNS trigger LANGUAGE plpgsql AS $$\nBEGIN\n  NEW.updated_at := now();\n  RETURN NEW;\nEND\n$$;"
+		files = exportFiles(t, "goose", services.MigrationScript{Up: script.Up + function + "\n" + script.Down})
+		assert.Equal(t, "-- +goose Up\n"+
+			"-- +goose StatementBegin\n"+script.Up+"-- +goose StatementEnd\n"+
+			"-- +goose StatementBegin\n"+function+"\n-- +goose StatementEnd\n"+
+			"-- +goose StatementBegin\n"+script.Down+"-- +goose StatementEnd\n"+
+			"-- +goose Down\n",
+			files["20260101120000_add_users_email.sql"], "each statement runs in a block of its own")
+	})
+
+	t.Run("liquibase yaml", func(t *testing.T) {
+		files := exportFiles(t, "liquibase-yaml", script)
+
+		var changelog struct {
+			DatabaseChangeLog []struct {
+				ChangeSet struct {
+					ID               string `yaml:"id"`
+					RunInTransaction bool   `yaml:"runInTransaction"`
+					Changes          []struct {
+						SQL struct{ SQL string } `yaml:"sql"`
+					} `yaml:"changes"`
+					Rollback []struct {
+						SQL struct{ SQL string } `yaml:"sql"`
+					} `yaml:"rollback"`
+				} `yaml:"changeSet"`
+			} `yaml:"databaseChangeLog"`
+		}
+		require.NoError(t, yaml.Unmarshal([]byte(files["db.changelog-20260101120000_add_users_email.yaml"]), &changelog))
+		require.Len(t, changelog.DatabaseChangeLog, 1)
+		changeSet := changelog.DatabaseChangeLog[0].ChangeSet
+		assert.Equal(t, "20260101120000_add_users_email", changeSet.ID)
+		assert.True(t, changeSet.RunInTransaction)
+		assert.Equal(t, script.Up, changeSet.Changes[0].SQL.SQL)
+		assert.Equal(t, script.Down, changeSet.Rollback[0].SQL.SQL)
+	})
+
+	t.Run("liquibase xml", func(t *testing.T) {
+		files := exportFiles(t, "liquibase-xml", concurrent)
+
+		var changelog struct {
+			ChangeSets []struct {
+				ID               string `xml:"id,attr"`
+				RunInTransaction bool   `xml:"runInTransaction,attr"`
+				SQL              string `xml:"sql"`
+				Rollback         string `xml:"rollback>sql"`
+			} `xml:"changeSet"`
+		}
+		require.NoError(t, xml.Unmarshal([]byte(files["db.changelog-20260101120000_add_users_email.xml"]), &changelog))
+		require.Len(t, changelog.ChangeSets, 1)
+		assert.False(t, changelog.ChangeSets[0].RunInTransaction)
+		assert.Equal(t, concurrent.Up, changelog.ChangeSets[0].SQL)
+		assert.Equal(t, concurrent.Down, changelog.ChangeSets[0].Rollback)
+	})
+
+	t.Run("transactions follow the steps", func(t *testing.T) {
+		backfill := "DO $$\nBEGIN\n  UPDATE \"public\".\"users\" SET \"email\" = lower(\"email\");\n  COMMIT;\nEND\n$$;\n"
+		plan := services.MigrationPlan{
+			Up: []services.MigrationStep{
+				{SQL: script.Up, Transactional: true},
+				{SQL: backfill, Transactional: false},
+			},
+			Down:         []services.MigrationStep{{SQL: script.Down, Transactional: true}},
+			Transactions: true,
+		}
+
+		flyway := exportPlan(t, "flyway", plan)
+		assert.Equal(t, script.Up+backfill, flyway["V20260101120000__add_users_email.sql"], "runners open the transactions themselves")
+		assert.Equal(t, "executeInTransaction=false\n", flyway["V20260101120000__add_users_email.sql.conf"])
+		assert.NotContains(t, flyway, "U20260101120000__add_users_email.sql.conf")
+
+		goose := exportPlan(t, "goose", plan)["20260101120000_add_users_email.sql"]
+		assert.True(t, strings.HasPrefix(goose, "-- +goose NO TRANSACTION\n"), goose)
+		assert.NotContains(t, goose, "BEGIN;")
+
+		migrate := exportPlan(t, "golang-migrate", plan)
+		assert.Equal(t, "BEGIN;\n"+script.Up+"COMMIT;\n"+backfill, migrate["20260101120000_add_users_email.up.sql"])
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		_, err := exporters.NewExporter("rails")
+
+		assert.Error(t, err)
+	})
+}
+
+func TestExportMigration(t *testing.T) {
+	db := SetupMetadataDB(t, "metadata_export")
+	project := models.Project{Name: "Export Me"}
+	require.NoError(t, db.Create(&project).Error)
+	users := func(columns ...models.Column) []models.Schema {
+		return []models.Schema{{Name: "public", Tables: []models.TableSchema{{
+			Name: "users", SchemaName: "public",
+			Columns: append([]models.Column{{Name: "id", DataType: "integer", IsPrimary: true}}, columns...),
+		}}}}
+	}
+	require.NoError(t, db.Create(&models.Snapshot{ProjectID: project.ID, Side: "target", Label: "before", Dialect: "postgres", Schemas: users()}).Error)
+	require.NoError(t, db.Create(&models.Snapshot{ProjectID: project.ID, Side: "target", Label: "after", Dialect: "postgres",
+		Schemas: users(models.Column{Name: "email", DataType: "text", IsNullable: true})}).Error)
+	projectID := ginParam("id", "1")
+
+	t.Run("zip of versioned files", func(t *testing.T) {
+		c, w := newTestContext("GET", "/projects/1/export?format=flyway&name=add+email&version=2&source_snapshot=1&target_snapshot=2", gin.Params{projectID})
+
+		controllers.ExportMigration(c)
+
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+		assert.Equal(t, `attachment; filename="export_me-2-flyway.zip"`, w.Header().Get("Content-Disposition"))
+
+		assert.Equal(t, map[string]string{
+			"V2__add_email.sql": "ALTER TABLE \"public\".\"users\" ADD COLUMN \"email\" text;\n",
+			"U2__add_email.sql": "ALTER TABLE \"public\".\"users\" DROP COLUMN \"email\";\n",
+		}, unzip(t, w.Body.Bytes()))
+	})
+
+	t.Run("tracked migration", func(t *testing.T) {
+		appliedAt := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+		migration := models.Migration{
+			ProjectID: project.ID,
+			Up:        "BEGIN;\nALTER TABLE \"public\".\"users\" ADD COLUMN \"email\" text;\nCOMMIT;\nCREATE INDEX CONCURRENTLY \"idx_users_email\" ON \"public\".\"users\" (\"email\");\n",
+			Down:      "ALTER TABLE \"public\".\"users\" DROP COLUMN \"email\";\n",
+			Status:    models.MigrationApplied,
+			AppliedAt: &appliedAt,
+		}
+		require.NoError(t, db.Create(&migration).Error)
+		pending := models.Migration{ProjectID: project.ID, Up: migration.Down, Down: migration.Up, Status: models.MigrationPending}
+		require.NoError(t, db.Create(&pending).Error)
+
+		c, w := newTestContext("GET", "/projects/1/migrations/1/export?format=flyway", gin.Params{projectID, ginParam("mid", "1")})
+
+		controllers.ExportStoredMigration(c)
+
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, `attachment; filename="export_me-20260304050607-flyway.zip"`, w.Header().Get("Content-Disposition"))
+		contents := unzip(t, w.Body.Bytes())
+		assert.Equal(t, "ALTER TABLE \"public\".\"users\" ADD COLUMN \"email\" text;\nCREATE INDEX CONCURRENTLY \"idx_users_email\" ON \"public\".\"users\" (\"email\");\n",
+			contents["V20260304050607__migration.sql"], "transaction blocks are left to the runner")
+		assert.Equal(t, "executeInTransaction=false\n", contents["V20260304050607__migration.sql.conf"])
+
+		c, w = newTestContext("GET", "/projects/1/migrations/2/export?format=golang-migrate", gin.Params{projectID, ginParam("mid", "2")})
+
+		controllers.ExportStoredMigration(c)
+
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Contains(t, unzip(t, w.Body.Bytes()), "2_migration.up.sql", "migrations not applied are versioned by ID")
+
+		c, w = newTestContext("GET", "/projects/1/migrations/99/export?format=flyway", gin.Params{projectID, ginParam("mid", "99")})
+
+		controllers.ExportStoredMigration(c)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		for _, url := range []string{
+			"/projects/1/export?format=rails&source_snapshot=1&target_snapshot=2",
+			"/projects/1/export?format=goose&version=v1&source_snapshot=1&target_snapshot=2",
+		} {
+			c, w := newTestContext("GET", url, gin.Params{projectID})
+
+			controllers.ExportMigration(c)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code, url)
+		}
+	})
+
+	t.Run("unknown snapshot", func(t *testing.T) {
+		c, w := newTestContext("GET", "/projects/1/export?format=goose&source_snapshot=1&target_snapshot=99", gin.Params{projectID})
+
+		controllers.ExportMigration(c)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
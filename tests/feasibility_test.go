@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+)
+
+func columnChange(t *testing.T, diff models.SchemaDiff, name string) models.ColumnChange {
+	require.Len(t, diff.TablesModified, 1)
+	for _, change := range diff.TablesModified[0].ColumnsModified {
+		if change.Name == name {
+			return change
+		}
+	}
+	t.Fatalf("column %s not modified", name)
+	return models.ColumnChange{}
+}
+
+func TestCheckFeasibility(t *testing.T) {
+	db := SetupDB(t, "source_feasibility", func(db *gorm.DB) {
+		db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, email TEXT, score BIGINT, age BIGINT)`)
+		db.Exec(`INSERT INTO users VALUES (1, 'Ann', 'ann@example.com', 10, 30)`)
+		db.Exec(`INSERT INTO users VALUES (2, 'Bartholomew Montgomery', NULL, 5000000000, 41)`)
+		db.Exec(`INSERT INTO users VALUES (3, 'Christopher Columbus', NULL, -5000000000, 52)`)
+	})
+	source, err := services.DumpSchema(db)
+	require.NoError(t, err)
+
+	target := SetupSchemaDump(t, "target_feasibility", func(db *gorm.DB) {
+		db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, name VARCHAR(10), email TEXT NOT NULL, score INTEGER, age INTEGER)`)
+	})
+
+	diff := services.CompareSchemas("sqlite", source, target)
+	require.NoError(t, services.CheckFeasibility(db, &diff, 5))
+
+	name := columnChange(t, diff, "name")
+	require.Len(t, name.Violations, 1)
+	assert.Equal(t, "max_length", name.Violations[0].Check)
+	assert.Equal(t, int64(2), name.Violations[0].Count)
+	assert.Equal(t, []string{"2", "3"}, name.Violations[0].SampleKeys)
+
+	email := columnChange(t, diff, "email")
+	require.Len(t, email.Violations, 1)
+	assert.Equal(t, "null_values", email.Violations[0].Check)
+	assert.Equal(t, int64(2), email.Violations[0].Count)
+
+	score := columnChange(t, diff, "score")
+	require.Len(t, score.Violations, 1)
+	assert.Equal(t, "out_of_range", score.Violations[0].Check)
+	assert.Equal(t, []string{"2", "3"}, score.Violations[0].SampleKeys)
+
+	assert.Empty(t, columnChange(t, diff, "age").Violations)
+	assert.Equal(t, 3, diff.Summary["blocking_violations"])
+
+	t.Run("sample size", func(t *testing.T) {
+		require.NoError(t, services.CheckFeasibility(db, &diff, 1))
+
+		assert.Equal(t, []string{"2"}, columnChange(t, diff, "name").Violations[0].SampleKeys)
+		assert.Equal(t, int64(2), columnChange(t, diff, "name").Violations[0].Count)
+	})
+}
@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/Tsarbomba69-com/mammoth.server/models"
@@ -20,7 +21,7 @@ func TestCodeGeneration(t *testing.T) {
 			db.Exec(`CREATE TABLE posts (id INTEGER PRIMARY KEY, title TEXT, user_id INTEGER)`)
 		})
 
-		diff := services.CompareSchemas(source, target)
+		diff := services.CompareSchemas("sqlite", source, target)
 		migrationScript := services.Generate("postgres", diff)
 		expectedUp := "CREATE TABLE \"main\".\"posts\" (\n  \"id\" INTEGER,\n  \"title\" TEXT,\n  \"user_id\" INTEGER,\n  PRIMARY KEY (\"id\")\n);\n"
 
@@ -38,7 +39,7 @@ func TestCodeGeneration(t *testing.T) {
 			db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)`)
 		})
 
-		diff := services.CompareSchemas(source, target)
+		diff := services.CompareSchemas("sqlite", source, target)
 		migrationScript := services.Generate("postgres", diff)
 
 		expectedUp := "ALTER TABLE \"main\".\"users\" ADD COLUMN \"name\" TEXT;\n"
@@ -57,7 +58,7 @@ func TestCodeGeneration(t *testing.T) {
 			db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY)`)
 		})
 
-		diff := services.CompareSchemas(source, target)
+		diff := services.CompareSchemas("sqlite", source, target)
 		migrationScript := services.Generate("postgres", diff)
 
 		expectedUp := "ALTER TABLE \"main\".\"users\" DROP COLUMN \"name\";\n"
@@ -77,7 +78,7 @@ func TestCodeGeneration(t *testing.T) {
 			db.Exec(`CREATE UNIQUE INDEX idx_users_email ON users (email)`)
 		})
 
-		diff := services.CompareSchemas(source, target)
+		diff := services.CompareSchemas("sqlite", source, target)
 		migrationScript := services.Generate("postgres", diff)
 
 		expectedUp := "CREATE UNIQUE INDEX \"idx_users_email\" ON \"main\".\"users\" (\"email\");\n"
@@ -97,7 +98,7 @@ func TestCodeGeneration(t *testing.T) {
 			db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY)`)
 		})
 
-		diff := services.CompareSchemas(source, target)
+		diff := services.CompareSchemas("sqlite", source, target)
 		migrationScript := services.Generate("postgres", diff)
 
 		expectedUp := "DROP TABLE \"main\".\"sessions\";\n"
@@ -159,7 +160,7 @@ func TestGenerate_AddedSequence(t *testing.T) {
 			},
 			expected: services.MigrationScript{
 				Up: `CREATE SEQUENCE "public"."seq_order_id" INCREMENT BY 2 START WITH 100 NO CYCLE;
- ALTER SEQUENCE "public"."seq_order_id" OWNED BY "orders"."id";
+ ALTER SEQUENCE "public"."seq_order_id" OWNED BY "public"."orders"."id";
 `,
 				Down: `DROP SEQUENCE IF EXISTS "public"."seq_order_id";
 `,
@@ -214,7 +215,7 @@ func TestGenerate_AddedSequence(t *testing.T) {
 			expected: services.MigrationScript{
 				Up: `CREATE SEQUENCE "public"."seq_one" INCREMENT BY 1 START WITH 1 NO CYCLE;
 CREATE SEQUENCE "app"."seq_two" INCREMENT BY 10 START WITH 100 NO CYCLE;
- ALTER SEQUENCE "app"."seq_two" OWNED BY "app.users"."user_id";
+ ALTER SEQUENCE "app"."seq_two" OWNED BY "app"."users"."user_id";
 `,
 				Down: `DROP SEQUENCE IF EXISTS "public"."seq_one";
 DROP SEQUENCE IF EXISTS "app"."seq_two";
@@ -384,8 +385,8 @@ func TestCompareSchemas_AlteredSequences(t *testing.T) {
 				downSQL       string
 			}{
 				modifiedCount: 2,
-				upSQL:         "ALTER SEQUENCE \"public\".\"seq_one\" INCREMENT BY 2;\nALTER SEQUENCE \"app\".\"seq_two\" MAXVALUE 2000;\n",
-				downSQL:       "ALTER SEQUENCE \"public\".\"seq_one\" INCREMENT BY 1;\nALTER SEQUENCE \"app\".\"seq_two\" MAXVALUE 1000;\n",
+				upSQL:         "ALTER SEQUENCE \"app\".\"seq_two\" MAXVALUE 2000;\nALTER SEQUENCE \"public\".\"seq_one\" INCREMENT BY 2;\n",
+				downSQL:       "ALTER SEQUENCE \"app\".\"seq_two\" MAXVALUE 1000;\nALTER SEQUENCE \"public\".\"seq_one\" INCREMENT BY 1;\n",
 			},
 		},
 		{
@@ -421,7 +422,7 @@ func TestCompareSchemas_AlteredSequences(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Act
-			diff := services.CompareSchemas(tt.source, tt.target)
+			diff := services.CompareSchemas("postgres", tt.source, tt.target)
 			migration := services.Generate("postgres", diff)
 
 			// Assert
@@ -438,3 +439,582 @@ func TestCompareSchemas_AlteredSequences(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerate_DeterministicOrder(t *testing.T) {
+	source := SetupSchemaDump(t, "source_order", func(db *gorm.DB) {
+		db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)`)
+		db.Exec(`CREATE TABLE legacy_a (id INTEGER PRIMARY KEY)`)
+		db.Exec(`CREATE TABLE legacy_b (id INTEGER PRIMARY KEY)`)
+	})
+
+	target := SetupSchemaDump(t, "target_order", func(db *gorm.DB) {
+		db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, zeta TEXT, alpha TEXT, mid TEXT)`)
+		db.Exec(`CREATE INDEX idx_users_zeta ON users (zeta)`)
+		db.Exec(`CREATE INDEX idx_users_alpha ON users (alpha)`)
+		db.Exec(`CREATE TABLE zebras (id INTEGER PRIMARY KEY, z TEXT, a TEXT)`)
+		db.Exec(`CREATE TABLE apples (id INTEGER PRIMARY KEY)`)
+		db.Exec(`CREATE TABLE mangos (id INTEGER PRIMARY KEY)`)
+	})
+
+	diff := services.CompareSchemas("sqlite", source, target)
+	expected := services.Generate("postgres", diff)
+
+	// Tables are sorted by name, columns keep their ordinal position
+	assert.Equal(t, []string{"apples", "mangos", "zebras"}, []string{
+		diff.TablesAdded[0].Name, diff.TablesAdded[1].Name, diff.TablesAdded[2].Name,
+	})
+	assert.Equal(t, "legacy_a", diff.TablesRemoved[0].Name)
+	assert.Equal(t, "legacy_b", diff.TablesRemoved[1].Name)
+	added := diff.TablesModified[0].ColumnsAdded
+	assert.Equal(t, []string{"zeta", "alpha", "mid"}, []string{added[0].Name, added[1].Name, added[2].Name})
+	assert.Equal(t, "idx_users_alpha", diff.TablesModified[0].IndexesAdded[0].Name)
+	assert.Contains(t, expected.Up, "CREATE TABLE \"main\".\"zebras\" (\n  \"id\" INTEGER,\n  \"z\" TEXT,\n  \"a\" TEXT,")
+
+	for i := 0; i < 20; i++ {
+		script := services.Generate("postgres", services.CompareSchemas("sqlite", source, target))
+		assert.Equal(t, expected.Up, script.Up, "Up migration must be stable")
+		assert.Equal(t, expected.Down, script.Down, "Down migration must be stable")
+	}
+}
+
+func TestGenerate_DependencyOrder(t *testing.T) {
+	users := func(columns ...models.Column) models.TableSchema {
+		return models.TableSchema{Name: "users", SchemaName: "public", Columns: append([]models.Column{
+			{Name: "id", DataType: "integer", IsPrimary: true},
+		}, columns...)}
+	}
+
+	t.Run("sequence owned by a new table", func(t *testing.T) {
+		source := []models.Schema{{Name: "public"}}
+		target := []models.Schema{{
+			Name: "public",
+			Tables: []models.TableSchema{{Name: "orders", SchemaName: "public", Columns: []models.Column{
+				{Name: "id", DataType: "integer", Default: "nextval('orders_id_seq')", IsPrimary: true},
+			}}},
+			Sequences: []models.Sequence{{Name: "orders_id_seq", SchemaName: "public", Increment: 1, OwnedByTable: "orders", OwnedByColumn: "id"}},
+		}}
+
+		script := services.Generate("postgres", services.CompareSchemas("postgres", source, target))
+
+		assert.Equal(t, `CREATE SEQUENCE "public"."orders_id_seq" INCREMENT BY 1 NO CYCLE;
+CREATE TABLE "public"."orders" (
+  "id" integer NOT NULL DEFAULT nextval('orders_id_seq'),
+  PRIMARY KEY ("id")
+);
+ALTER SEQUENCE "public"."orders_id_seq" OWNED BY "public"."orders"."id";
+`, script.Up)
+		before(t, script.Down, `DROP TABLE "public"."orders"`, `DROP SEQUENCE IF EXISTS "public"."orders_id_seq"`)
+	})
+
+	t.Run("foreign key to a new table", func(t *testing.T) {
+		fk := models.ForeignKey{Name: "fk_users_team", Columns: []string{"team_id"}, ReferencedTable: "teams", ReferencedColumns: []string{"id"}, OnDelete: "CASCADE", OnUpdate: "NO ACTION"}
+		source := []models.Schema{{Name: "public", Tables: []models.TableSchema{users()}}}
+		withTeam := users(models.Column{Name: "team_id", DataType: "integer", IsNullable: true})
+		withTeam.ForeignKeys = []models.ForeignKey{fk}
+		target := []models.Schema{{Name: "public", Tables: []models.TableSchema{
+			{Name: "teams", SchemaName: "public", Columns: []models.Column{{Name: "id", DataType: "integer", IsPrimary: true}}},
+			withTeam,
+		}}}
+
+		script := services.Generate("postgres", services.CompareSchemas("postgres", source, target))
+
+		before(t, script.Up, `CREATE TABLE "public"."teams"`, `ADD CONSTRAINT "fk_users_team"`)
+		before(t, script.Up, `ADD COLUMN "team_id"`, `ADD CONSTRAINT "fk_users_team"`)
+		before(t, script.Down, `DROP CONSTRAINT "fk_users_team"`, `DROP TABLE "public"."teams"`)
+		before(t, script.Down, `DROP CONSTRAINT "fk_users_team"`, `DROP COLUMN "team_id"`)
+	})
+
+	t.Run("dropped foreign key to a removed table", func(t *testing.T) {
+		fk := models.ForeignKey{Name: "fk_users_team", Columns: []string{"team_id"}, ReferencedTable: "teams", ReferencedColumns: []string{"id"}, OnDelete: "CASCADE", OnUpdate: "NO ACTION"}
+		diff := models.SchemaDiff{
+			TablesModified: []models.TableDiff{{Name: "users", SchemaName: "public", ForeignKeyRemoved: []models.ForeignKey{fk}}},
+			TablesRemoved: []models.TableDiff{{Name: "teams", SchemaName: "public", ColumnsAdded: []models.Column{
+				{Name: "id", DataType: "integer", IsPrimary: true},
+			}}},
+		}
+
+		script := services.Generate("postgres", diff)
+
+		before(t, script.Up, `ALTER TABLE "public"."users" DROP CONSTRAINT "fk_users_team"`, `DROP TABLE "public"."teams"`)
+		before(t, script.Down, `CREATE TABLE "public"."teams"`, `ADD CONSTRAINT "fk_users_team"`)
+	})
+
+	t.Run("views using altered columns", func(t *testing.T) {
+		activeUsers := models.Dependent{Type: "view", SchemaName: "public", Name: "active_users", Definition: " SELECT users.id, users.name FROM users;",
+			References: []models.DependentReference{{SchemaName: "public", Name: "users", Columns: []string{"id", "name"}}}}
+		userNames := models.Dependent{Type: "view", SchemaName: "public", Name: "user_names", Definition: " SELECT active_users.name FROM active_users;",
+			References: []models.DependentReference{{SchemaName: "public", Name: "active_users", Columns: []string{"name"}}}}
+		unrelated := models.Dependent{Type: "view", SchemaName: "public", Name: "user_ids", Definition: " SELECT users.id FROM users;",
+			References: []models.DependentReference{{SchemaName: "public", Name: "users", Columns: []string{"id"}}}}
+		source := []models.Schema{{Name: "public", Tables: []models.TableSchema{users(models.Column{Name: "name", DataType: "text", IsNullable: true})},
+			Dependents: []models.Dependent{activeUsers, userNames, unrelated}}}
+		target := []models.Schema{{Name: "public", Tables: []models.TableSchema{users(models.Column{Name: "name", DataType: "character varying(100)", IsNullable: true})}}}
+
+		diff := services.CompareSchemas("postgres", source, target)
+		script := services.Generate("postgres", diff)
+
+		assert.Equal(t, []models.Dependent{activeUsers, userNames}, diff.Dependents)
+		before(t, script.Up, `DROP VIEW IF EXISTS "public"."user_names"`, `DROP VIEW IF EXISTS "public"."active_users"`)
+		before(t, script.Up, `DROP VIEW IF EXISTS "public"."active_users"`, `ALTER TABLE "public"."users"`)
+		before(t, script.Up, `ALTER TABLE "public"."users"`, "CREATE VIEW \"public\".\"active_users\" AS\nSELECT users.id, users.name FROM users;\n")
+		before(t, script.Up, `CREATE VIEW "public"."active_users"`, `CREATE VIEW "public"."user_names"`)
+		assert.NotContains(t, script.Up, "user_ids")
+	})
+
+	t.Run("views using removed columns", func(t *testing.T) {
+		view := models.Dependent{Type: "view", SchemaName: "public", Name: "user_emails", Definition: "SELECT users.email FROM users",
+			References: []models.DependentReference{{SchemaName: "public", Name: "users", Columns: []string{"email"}}}}
+		source := []models.Schema{{Name: "public", Tables: []models.TableSchema{users(models.Column{Name: "email", DataType: "text", IsNullable: true})},
+			Dependents: []models.Dependent{view}}}
+		target := []models.Schema{{Name: "public", Tables: []models.TableSchema{users()}}}
+
+		script := services.Generate("postgres", services.CompareSchemas("postgres", source, target))
+
+		before(t, script.Up, `DROP VIEW IF EXISTS "public"."user_emails"`, `DROP COLUMN "email"`)
+		assert.NotContains(t, script.Up, "CREATE VIEW")
+		assert.NotContains(t, script.Down, "DROP VIEW")
+		before(t, script.Down, `ADD COLUMN "email"`, `CREATE VIEW "public"."user_emails"`)
+	})
+}
+
+func TestPlanMigration(t *testing.T) {
+	source := SetupSchemaDump(t, "source_plan", func(db *gorm.DB) {
+		db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, legacy TEXT)`)
+		db.Exec(`CREATE TABLE sessions (id INTEGER PRIMARY KEY)`)
+	})
+	target := SetupSchemaDump(t, "target_plan", func(db *gorm.DB) {
+		db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, name VARCHAR(20), email TEXT)`)
+		db.Exec(`CREATE INDEX idx_users_email ON users (email)`)
+		db.Exec(`CREATE TABLE posts (id INTEGER PRIMARY KEY)`)
+	})
+
+	diff := services.CompareSchemas("sqlite", source, target)
+	plan := services.PlanMigration("postgres", diff)
+
+	var ids []string
+	for _, step := range plan.Up {
+		ids = append(ids, step.ID)
+	}
+	assert.Equal(t, []string{
+		"create_table:main.posts",
+		"add_column:main.users.email",
+		"drop_column:main.users.legacy",
+		"alter_column:main.users.name",
+		"create_index:main.users.idx_users_email",
+		"drop_table:main.sessions",
+	}, ids)
+
+	steps := make(map[string]services.MigrationStep)
+	for _, step := range plan.Up {
+		steps[step.ID] = step
+	}
+
+	addEmail := steps["add_column:main.users.email"]
+	assert.Equal(t, "add_column", addEmail.Kind)
+	assert.Equal(t, "column", addEmail.ObjectType)
+	assert.Equal(t, "main.users.email", addEmail.Object)
+	assert.Equal(t, "ALTER TABLE \"main\".\"users\" ADD COLUMN \"email\" TEXT;\n", addEmail.SQL)
+	assert.False(t, addEmail.Destructive)
+	assert.True(t, addEmail.Transactional)
+	if assert.NotNil(t, addEmail.Reverse) {
+		assert.Equal(t, "drop_column:main.users.email", addEmail.Reverse.ID)
+		assert.Equal(t, "ALTER TABLE \"main\".\"users\" DROP COLUMN \"email\";\n", addEmail.Reverse.SQL)
+		assert.True(t, addEmail.Reverse.Destructive)
+	}
+
+	assert.True(t, steps["drop_column:main.users.legacy"].Destructive)
+	assert.True(t, steps["alter_column:main.users.name"].Destructive, "text to varchar(20) narrows the column")
+	assert.False(t, steps["alter_column:main.users.name"].Reverse.Destructive)
+	assert.True(t, steps["drop_table:main.sessions"].Destructive)
+	assert.Equal(t, "create_table:main.sessions", steps["drop_table:main.sessions"].Reverse.ID)
+
+	t.Run("script concatenates the steps", func(t *testing.T) {
+		script := plan.Script()
+
+		assert.Equal(t, services.Generate("postgres", diff), script)
+		assert.True(t, strings.HasPrefix(script.Up, plan.Up[0].SQL))
+		assert.True(t, strings.HasSuffix(script.Down, plan.Down[len(plan.Down)-1].SQL))
+	})
+
+	t.Run("ids are stable", func(t *testing.T) {
+		again := services.PlanMigration("postgres", services.CompareSchemas("sqlite", source, target))
+
+		assert.Equal(t, plan, again)
+	})
+}
+
+func TestGenerate_Transactions(t *testing.T) {
+	source := SetupSchemaDump(t, "source_tx", func(db *gorm.DB) {
+		db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)`)
+		db.Exec(`CREATE INDEX idx_users_name ON users (name)`)
+	})
+	target := SetupSchemaDump(t, "target_tx", func(db *gorm.DB) {
+		db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, email TEXT)`)
+		db.Exec(`CREATE UNIQUE INDEX idx_users_email ON users (email)`)
+		db.Exec(`CREATE TABLE posts (id INTEGER PRIMARY KEY, title TEXT)`)
+		db.Exec(`CREATE INDEX idx_posts_title ON posts (title)`)
+	})
+	diff := services.CompareSchemas("sqlite", source, target)
+
+	t.Run("indexes of existing tables are built concurrently", func(t *testing.T) {
+		plan := services.PlanMigration("postgres", diff, services.GenerateOptions{Concurrently: true})
+		script := plan.Script()
+
+		assert.Contains(t, script.Up, "CREATE UNIQUE INDEX CONCURRENTLY \"idx_users_email\" ON \"main\".\"users\" (\"email\");\n")
+		assert.Contains(t, script.Up, "DROP INDEX CONCURRENTLY \"main\".\"idx_users_name\";\n")
+		assert.Contains(t, script.Up, "CREATE INDEX \"idx_posts_title\" ON \"main\".\"posts\" (\"title\");\n", "new tables have no writes to keep going")
+		assert.NotContains(t, script.Up, "BEGIN;")
+
+		for _, step := range plan.Up {
+			assert.Equal(t, step.ObjectType != "index", step.Transactional, step.ID)
+		}
+	})
+
+	t.Run("transactional statements are wrapped in batches", func(t *testing.T) {
+		plan := services.PlanMigration("postgres", diff, services.GenerateOptions{Transactions: true, Concurrently: true})
+		batches := services.Batches(plan.Up)
+		script := plan.Script()
+
+		assert.Greater(t, len(batches), 1)
+		for _, batch := range batches {
+			if !batch[0].Transactional {
+				assert.Len(t, batch, 1, "non-transactional steps run alone")
+			}
+		}
+		assert.True(t, strings.HasPrefix(script.Up, "BEGIN;\n"))
+		assert.Equal(t, strings.Count(script.Up, "BEGIN;\n"), strings.Count(script.Up, "COMMIT;\n"))
+		assert.NotContains(t, script.Up, "BEGIN;\nCREATE UNIQUE INDEX CONCURRENTLY")
+		assert.Contains(t, script.Up, "COMMIT;\nCREATE UNIQUE INDEX CONCURRENTLY")
+	})
+
+	t.Run("plain batches without concurrent indexes", func(t *testing.T) {
+		script := services.Generate("postgres", diff, services.GenerateOptions{Transactions: true})
+
+		assert.Equal(t, 1, strings.Count(script.Up, "BEGIN;\n"))
+		assert.True(t, strings.HasSuffix(script.Up, "COMMIT;\n"))
+		assert.Equal(t, 1, strings.Count(script.Down, "BEGIN;\n"))
+	})
+}
+
+func TestGenerate_Online(t *testing.T) {
+	source := SetupSchemaDump(t, "source_online", func(db *gorm.DB) {
+		db.Exec(`CREATE TABLE teams (id INTEGER PRIMARY KEY)`)
+		db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, age TEXT, name TEXT, team_id INTEGER, legacy TEXT)`)
+	})
+	target := SetupSchemaDump(t, "target_online", func(db *gorm.DB) {
+		db.Exec(`CREATE TABLE teams (id INTEGER PRIMARY KEY)`)
+		db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, age BIGINT, name TEXT NOT NULL, team_id INTEGER REFERENCES teams (id), email TEXT)`)
+		db.Exec(`CREATE INDEX idx_users_age ON users (age)`)
+	})
+	diff := services.CompareSchemas("sqlite", source, target)
+	plan := services.PlanMigration("postgres", diff, services.GenerateOptions{Online: true})
+	script := plan.Script()
+
+	phases := make(map[string]services.PhaseScript)
+	for _, phase := range script.Phases {
+		phases[phase.Phase] = phase
+	}
+	expand, migrate, contract := phases[services.PhaseExpand].Up, phases[services.PhaseMigrate].Up, phases[services.PhaseContract].Up
+
+	t.Run("phases run in order", func(t *testing.T) {
+		if assert.Len(t, script.Phases, 3) {
+			assert.Equal(t, expand+migrate+contract, script.Up)
+		}
+		last := 0
+		for _, step := range plan.Up {
+			rank := map[string]int{services.PhaseExpand: 0, services.PhaseMigrate: 1, services.PhaseContract: 2}[step.Phase]
+			assert.GreaterOrEqual(t, rank, last, step.ID)
+			last = rank
+		}
+	})
+
+	t.Run("foreign keys are validated separately", func(t *testing.T) {
+		assert.Contains(t, expand, `FOREIGN KEY ("team_id") REFERENCES "main"."teams" ("id") ON DELETE NO ACTION ON UPDATE NO ACTION NOT VALID;`)
+		assert.Contains(t, migrate, `ALTER TABLE "main"."users" VALIDATE CONSTRAINT`)
+	})
+
+	t.Run("not null goes through a check constraint", func(t *testing.T) {
+		assert.Contains(t, expand, `ALTER TABLE "main"."users" ADD CONSTRAINT "users_name_not_null" CHECK ("name" IS NOT NULL) NOT VALID;`)
+		assert.Contains(t, migrate, `ALTER TABLE "main"."users" VALIDATE CONSTRAINT "users_name_not_null";`)
+		assert.Contains(t, contract, `ALTER TABLE "main"."users" ALTER COLUMN "name" SET NOT NULL;`)
+		assert.Contains(t, contract, `ALTER TABLE "main"."users" DROP CONSTRAINT "users_name_not_null";`)
+		assert.NotContains(t, script.Up, "MODIFY COLUMN")
+	})
+
+	t.Run("type changes swap in a shadow column", func(t *testing.T) {
+		assert.Contains(t, expand, `ALTER TABLE "main"."users" ADD COLUMN "age__new" BIGINT;`)
+		assert.Contains(t, expand, `CREATE TRIGGER "users_age_sync" BEFORE INSERT OR UPDATE ON "main"."users"`)
+		assert.Contains(t, migrate, `SELECT "id" INTO batch_end FROM "main"."users" WHERE ("id") >= (batch_start."id") ORDER BY "id" OFFSET 10000 LIMIT 1;`)
+		before(t, migrate, `UPDATE "main"."users" SET "age__new" = "age"::BIGINT WHERE "age__new" IS NULL AND "age" IS NOT NULL AND ("id") >= (batch_start."id") AND (last_batch OR ("id") < (batch_end."id"));`, "    COMMIT;\n")
+		before(t, contract, `DROP TRIGGER "users_age_sync"`, `ALTER TABLE "main"."users" DROP COLUMN "age";`)
+		before(t, contract, `DROP COLUMN "age";`, `RENAME COLUMN "age__new" TO "age";`)
+		before(t, contract, `RENAME COLUMN "age__new" TO "age";`, `CREATE INDEX "idx_users_age"`)
+	})
+
+	t.Run("additions expand and drops contract", func(t *testing.T) {
+		assert.Contains(t, expand, `ADD COLUMN "email" TEXT;`)
+		assert.Contains(t, contract, `DROP COLUMN "legacy";`)
+	})
+
+	t.Run("down script is phased too", func(t *testing.T) {
+		down := phases[services.PhaseContract].Down
+		assert.Contains(t, phases[services.PhaseExpand].Down, `ADD COLUMN "age__new" TEXT;`)
+		assert.Contains(t, phases[services.PhaseExpand].Down, `ALTER COLUMN "name" DROP NOT NULL;`)
+		assert.Contains(t, phases[services.PhaseExpand].Down, `DROP INDEX "main"."idx_users_age";`)
+		before(t, down, `DROP COLUMN "age";`, `RENAME COLUMN "age__new" TO "age";`)
+	})
+
+	t.Run("offline plans have no phases", func(t *testing.T) {
+		assert.Empty(t, services.Generate("postgres", diff).Phases)
+	})
+}
+
+func TestGenerate_OnlineKeepsDependents(t *testing.T) {
+	setup := func(userID string) func(db *gorm.DB) {
+		return func(db *gorm.DB) {
+			db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY)`)
+			db.Exec(`CREATE TABLE orders (id INTEGER PRIMARY KEY, user_id ` + userID + ` REFERENCES users (id), code TEXT)`)
+			db.Exec(`CREATE INDEX idx_orders_user ON orders (user_id)`)
+			db.Exec(`CREATE UNIQUE INDEX uq_orders_user_code ON orders (user_id, code)`)
+		}
+	}
+	diff := services.CompareSchemas("sqlite", SetupSchemaDump(t, "source_dependents", setup("TEXT")), SetupSchemaDump(t, "target_dependents", setup("BIGINT")))
+	plan := services.PlanMigration("postgres", diff, services.GenerateOptions{Online: true, Concurrently: true})
+	script := plan.Script()
+
+	phases := make(map[string]services.PhaseScript)
+	for _, phase := range script.Phases {
+		phases[phase.Phase] = phase
+	}
+	expand, migrate, contract := phases[services.PhaseExpand].Up, phases[services.PhaseMigrate].Up, phases[services.PhaseContract].Up
+
+	t.Run("indexes are rebuilt on the shadow column", func(t *testing.T) {
+		assert.Contains(t, expand, `CREATE INDEX CONCURRENTLY "idx_orders_user__new" ON "main"."orders" ("user_id__new");`)
+		assert.Contains(t, expand, `CREATE UNIQUE INDEX CONCURRENTLY "uq_orders_user_code__new" ON "main"."orders" ("user_id__new", "code");`)
+		for _, step := range plan.Up {
+			if step.Kind == "expand_index" {
+				assert.False(t, step.Transactional, step.ID)
+				assert.Equal(t, services.PhaseExpand, step.Phase, step.ID)
+			}
+		}
+		before(t, contract, `RENAME COLUMN "user_id__new" TO "user_id";`, `ALTER INDEX "main"."idx_orders_user__new" RENAME TO "idx_orders_user";`)
+		before(t, contract, `RENAME COLUMN "user_id__new" TO "user_id";`, `ALTER INDEX "main"."uq_orders_user_code__new" RENAME TO "uq_orders_user_code";`)
+		assert.NotContains(t, contract, "CREATE INDEX")
+	})
+
+	t.Run("foreign keys are rebuilt on the shadow column", func(t *testing.T) {
+		assert.Regexp(t, `ADD CONSTRAINT "[^"]+__new" FOREIGN KEY \("user_id__new"\) REFERENCES "main"."users" \("id"\)[^;]* NOT VALID;`, expand)
+		before(t, migrate, `UPDATE "main"."orders" SET "user_id__new"`, `VALIDATE CONSTRAINT`)
+		assert.Regexp(t, `RENAME CONSTRAINT "[^"]+__new" TO "[^"]+";`, contract)
+	})
+
+	t.Run("check and unique constraints are restored after the swap", func(t *testing.T) {
+		before(t, contract, `FROM pg_constraint`, `DROP COLUMN "user_id";`)
+		before(t, contract, `RENAME COLUMN "user_id__new" TO "user_id";`, "EXECUTE restore;")
+		assert.Contains(t, contract, `contype IN ('c', 'u')`)
+	})
+
+	t.Run("backfill commits each key range", func(t *testing.T) {
+		var backfill services.MigrationStep
+		for _, step := range plan.Up {
+			if step.Kind == "backfill_column" {
+				backfill = step
+			}
+		}
+		assert.False(t, backfill.Transactional)
+		before(t, backfill.SQL, `ORDER BY "id" OFFSET 10000 LIMIT 1;`, "    COMMIT;\n")
+		assert.True(t, strings.HasPrefix(backfill.SQL, "DO $$\n"))
+		assert.Equal(t, 1, strings.Count(backfill.SQL, "$$;"), "the batches must run as a single statement")
+	})
+}
+
+// before asserts that both statements are in the script, first ahead of second
+func before(t *testing.T, sql string, first, second string) {
+	t.Helper()
+	assert.Contains(t, sql, first)
+	assert.Contains(t, sql, second)
+	assert.Less(t, strings.Index(sql, first), strings.Index(sql, second), "%q must run before %q", first, second)
+}
+
+func TestGenerate_AlterColumn(t *testing.T) {
+	alter := func(changes ...models.ColumnChange) services.MigrationScript {
+		return services.Generate("postgres", models.SchemaDiff{TablesModified: []models.TableDiff{{
+			Name: "users", SchemaName: "public", ColumnsModified: changes,
+		}}})
+	}
+
+	t.Run("incompatible types are cast", func(t *testing.T) {
+		script := alter(models.ColumnChange{
+			Name:        "age",
+			Source:      models.Column{Name: "age", DataType: "text"},
+			Target:      models.Column{Name: "age", DataType: "integer"},
+			ChangedAttr: []string{"data_type"},
+		})
+
+		assert.Equal(t, "ALTER TABLE \"public\".\"users\" ALTER COLUMN \"age\" TYPE integer USING \"age\"::integer;\n", script.Up)
+		assert.Equal(t, "ALTER TABLE \"public\".\"users\" ALTER COLUMN \"age\" TYPE text;\n", script.Down)
+	})
+
+	t.Run("compatible types are converted without cast", func(t *testing.T) {
+		script := alter(models.ColumnChange{
+			Name:        "id",
+			Source:      models.Column{Name: "id", DataType: "integer"},
+			Target:      models.Column{Name: "id", DataType: "bigint"},
+			ChangedAttr: []string{"data_type"},
+		})
+
+		assert.Equal(t, "ALTER TABLE \"public\".\"users\" ALTER COLUMN \"id\" TYPE bigint;\n", script.Up)
+		assert.Equal(t, "ALTER TABLE \"public\".\"users\" ALTER COLUMN \"id\" TYPE integer;\n", script.Down)
+	})
+
+	t.Run("only changed attributes are altered", func(t *testing.T) {
+		script := alter(models.ColumnChange{
+			Name:        "name",
+			Source:      models.Column{Name: "name", DataType: "text", IsNullable: true},
+			Target:      models.Column{Name: "name", DataType: "text", Default: "'anonymous'"},
+			ChangedAttr: []string{"is_nullable", "default"},
+		})
+
+		assert.Equal(t, "ALTER TABLE \"public\".\"users\" ALTER COLUMN \"name\" SET DEFAULT 'anonymous', ALTER COLUMN \"name\" SET NOT NULL;\n", script.Up)
+		assert.Equal(t, "ALTER TABLE \"public\".\"users\" ALTER COLUMN \"name\" DROP DEFAULT, ALTER COLUMN \"name\" DROP NOT NULL;\n", script.Down)
+		assert.NotContains(t, script.Up, "TYPE")
+	})
+
+	t.Run("defaults are dropped around type changes", func(t *testing.T) {
+		script := alter(models.ColumnChange{
+			Name:        "active",
+			Source:      models.Column{Name: "active", DataType: "integer", Default: "1"},
+			Target:      models.Column{Name: "active", DataType: "boolean", Default: "true"},
+			ChangedAttr: []string{"data_type", "default"},
+		})
+
+		assert.Equal(t, "ALTER TABLE \"public\".\"users\" ALTER COLUMN \"active\" DROP DEFAULT, ALTER COLUMN \"active\" TYPE boolean USING \"active\"::boolean, ALTER COLUMN \"active\" SET DEFAULT true;\n", script.Up)
+		assert.Equal(t, "ALTER TABLE \"public\".\"users\" ALTER COLUMN \"active\" DROP DEFAULT, ALTER COLUMN \"active\" TYPE integer USING \"active\"::integer, ALTER COLUMN \"active\" SET DEFAULT 1;\n", script.Down)
+	})
+
+	t.Run("primary key changes", func(t *testing.T) {
+		script := alter(models.ColumnChange{
+			Name:        "email",
+			Source:      models.Column{Name: "email", DataType: "text"},
+			Target:      models.Column{Name: "email", DataType: "text", IsPrimary: true},
+			ChangedAttr: []string{"is_primary"},
+		})
+
+		assert.Equal(t, "ALTER TABLE \"public\".\"users\" ADD PRIMARY KEY (\"email\");\n", script.Up)
+		assert.Equal(t, "ALTER TABLE \"public\".\"users\" DROP CONSTRAINT \"users_pkey\";\n", script.Down)
+	})
+}
+
+func TestGenerate_CompositePrimaryKey(t *testing.T) {
+	tenant := models.Column{Name: "tenant_id", DataType: "integer", IsPrimary: true}
+	id := models.Column{Name: "id", DataType: "integer"}
+	primaryID := id
+	primaryID.IsPrimary = true
+	generate := func(table models.TableDiff) services.MigrationScript {
+		table.Name, table.SchemaName = "users", "public"
+		return services.Generate("postgres", models.SchemaDiff{TablesModified: []models.TableDiff{table}})
+	}
+
+	t.Run("column added to the key", func(t *testing.T) {
+		script := generate(models.TableDiff{
+			ColumnsSame:     []models.Column{tenant},
+			ColumnsModified: []models.ColumnChange{{Name: "id", Source: id, Target: primaryID, ChangedAttr: []string{"is_primary"}}},
+			IndexesModified: []models.IndexChange{{
+				Name:        "users_pkey",
+				Source:      models.Index{Name: "users_pkey", Columns: []string{"tenant_id"}, IsPrimary: true, IsUnique: true},
+				Target:      models.Index{Name: "users_pkey", Columns: []string{"tenant_id", "id"}, IsPrimary: true, IsUnique: true},
+				ChangedAttr: []string{"columns"},
+			}},
+		})
+
+		assert.Equal(t, `ALTER TABLE "public"."users" DROP CONSTRAINT "users_pkey";
+ALTER TABLE "public"."users" ADD PRIMARY KEY ("tenant_id", "id");
+`, script.Up)
+		assert.Equal(t, `ALTER TABLE "public"."users" DROP CONSTRAINT "users_pkey";
+ALTER TABLE "public"."users" ADD PRIMARY KEY ("tenant_id");
+`, script.Down)
+	})
+
+	t.Run("column removed from the key", func(t *testing.T) {
+		script := generate(models.TableDiff{
+			ColumnsSame:     []models.Column{tenant},
+			ColumnsModified: []models.ColumnChange{{Name: "id", Source: primaryID, Target: id, ChangedAttr: []string{"is_primary"}}},
+			IndexesModified: []models.IndexChange{{
+				Name:        "users_tenant_pk",
+				Source:      models.Index{Name: "users_tenant_pk", Columns: []string{"tenant_id", "id"}, IsPrimary: true, IsUnique: true},
+				Target:      models.Index{Name: "users_tenant_pk", Columns: []string{"tenant_id"}, IsPrimary: true, IsUnique: true},
+				ChangedAttr: []string{"columns"},
+			}},
+		})
+
+		assert.Equal(t, `ALTER TABLE "public"."users" DROP CONSTRAINT "users_tenant_pk";
+ALTER TABLE "public"."users" ADD CONSTRAINT "users_tenant_pk" PRIMARY KEY ("tenant_id");
+`, script.Up, "the introspected constraint name is kept")
+		assert.Equal(t, `ALTER TABLE "public"."users" DROP CONSTRAINT "users_tenant_pk";
+ALTER TABLE "public"."users" ADD CONSTRAINT "users_tenant_pk" PRIMARY KEY ("tenant_id", "id");
+`, script.Down)
+	})
+
+	t.Run("key column dropped", func(t *testing.T) {
+		script := generate(models.TableDiff{
+			ColumnsSame:    []models.Column{tenant},
+			ColumnsRemoved: []models.Column{primaryID},
+		})
+
+		before(t, script.Up, `DROP CONSTRAINT "users_pkey"`, `DROP COLUMN "id"`)
+		before(t, script.Up, `DROP COLUMN "id"`, `ADD PRIMARY KEY ("tenant_id")`)
+		before(t, script.Down, `ADD COLUMN "id"`, `ADD PRIMARY KEY ("tenant_id", "id")`)
+		before(t, script.Down, `DROP CONSTRAINT "users_pkey"`, `ADD COLUMN "id"`)
+	})
+}
+
+func TestGenerate_Idempotent(t *testing.T) {
+	source := SetupSchemaDump(t, "source_idempotent", func(db *gorm.DB) {
+		db.Exec(`CREATE TABLE teams (id INTEGER PRIMARY KEY)`)
+		db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, age TEXT, legacy TEXT)`)
+		db.Exec(`CREATE TABLE archive (id INTEGER PRIMARY KEY)`)
+	})
+	target := SetupSchemaDump(t, "target_idempotent", func(db *gorm.DB) {
+		db.Exec(`CREATE TABLE teams (id INTEGER PRIMARY KEY)`)
+		db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, age BIGINT NOT NULL, team_id INTEGER REFERENCES teams (id))`)
+		db.Exec(`CREATE INDEX idx_users_age ON users (age)`)
+		db.Exec(`CREATE TABLE posts (id INTEGER PRIMARY KEY)`)
+	})
+	diff := services.CompareSchemas("sqlite", source, target)
+
+	t.Run("objects are created and dropped only once", func(t *testing.T) {
+		script := services.Generate("postgres", diff, services.GenerateOptions{Idempotent: true})
+
+		assert.Contains(t, script.Up, `CREATE TABLE IF NOT EXISTS "main"."posts"`)
+		assert.Contains(t, script.Up, `ADD COLUMN IF NOT EXISTS "team_id" INTEGER;`)
+		assert.Contains(t, script.Up, `CREATE INDEX IF NOT EXISTS "idx_users_age" ON "main"."users" ("age");`)
+		assert.Contains(t, script.Up, `DROP COLUMN IF EXISTS "legacy";`)
+		assert.Contains(t, script.Up, `DROP TABLE IF EXISTS "main"."archive";`)
+		assert.Contains(t, script.Down, `DROP INDEX IF EXISTS "main"."idx_users_age";`)
+	})
+
+	t.Run("constraints are guarded by the catalog", func(t *testing.T) {
+		script := services.Generate("postgres", diff, services.GenerateOptions{Idempotent: true})
+
+		assert.Regexp(t, `DO \$\$\nBEGIN\n  IF NOT EXISTS \(SELECT 1 FROM pg_constraint WHERE conname = '[^']+' AND conrelid = '"main"."users"'::regclass\) THEN\n    ALTER TABLE "main"."users" ADD CONSTRAINT "[^"]+" FOREIGN KEY \("team_id"\)[^\n]*;\n  END IF;\nEND\n\$\$;\n`, script.Up)
+		assert.Contains(t, script.Down, `ALTER TABLE "main"."users" DROP CONSTRAINT IF EXISTS`)
+	})
+
+	t.Run("online swaps happen once", func(t *testing.T) {
+		script := services.Generate("postgres", diff, services.GenerateOptions{Idempotent: true, Online: true})
+
+		assert.Contains(t, script.Up, `ADD COLUMN IF NOT EXISTS "age__new" BIGINT;`)
+		before(t, script.Up, `DROP TRIGGER IF EXISTS "users_age_sync" ON "main"."users";`, `CREATE TRIGGER "users_age_sync"`)
+		before(t, script.Up, "IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = 'main' AND table_name = 'users' AND column_name = 'age__new') THEN\n",
+			`    ALTER TABLE "main"."users" DROP COLUMN "age";`+"\n"+
+				`    ALTER TABLE "main"."users" RENAME COLUMN "age__new" TO "age";`)
+		assert.Contains(t, script.Up, `conname = 'users_age_not_null'`)
+	})
+
+	t.Run("default generation is unchanged", func(t *testing.T) {
+		script := services.Generate("postgres", diff)
+
+		assert.NotContains(t, script.Up, "IF NOT EXISTS")
+		assert.NotContains(t, script.Up, "DO $$")
+	})
+}
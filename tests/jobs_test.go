@@ -0,0 +1,350 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/Tsarbomba69-com/mammoth.server/controllers"
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"github.com/Tsarbomba69-com/mammoth.server/schemas"
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+)
+
+// waitForJob polls a job until it reaches a final status
+func waitForJob(t *testing.T, db *gorm.DB, id uint) models.Job {
+	var job models.Job
+	require.Eventually(t, func() bool {
+		return db.First(&job, id).Error == nil && job.Finished()
+	}, 5*time.Second, 10*time.Millisecond)
+	return job
+}
+
+func TestJobQueue(t *testing.T) {
+	db := SetupMetadataDB(t, "metadata_job_queue")
+	project := models.Project{Name: "Jobs"}
+	require.NoError(t, db.Create(&project).Error)
+	stale := models.Job{ProjectID: project.ID, Kind: "dump", Status: models.JobRunning}
+	require.NoError(t, db.Create(&stale).Error)
+
+	queue := services.NewJobQueue(db, 1, 1)
+	require.NoError(t, queue.Start())
+	t.Cleanup(queue.Stop)
+
+	t.Run("interrupted jobs fail on start", func(t *testing.T) {
+		var job models.Job
+		require.NoError(t, db.First(&job, stale.ID).Error)
+		assert.Equal(t, models.JobFailed, job.Status)
+	})
+
+	t.Run("results are stored", func(t *testing.T) {
+		job, err := queue.Submit(project.ID, "compare", func(ctx context.Context, job *models.Job) error {
+			job.ResultStatus = http.StatusOK
+			job.Result = []byte(`{"ok":true}`)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, models.JobQueued, job.Status)
+
+		job = waitForJob(t, db, job.ID)
+
+		assert.Equal(t, models.JobSucceeded, job.Status)
+		assert.NotNil(t, job.StartedAt)
+		assert.JSONEq(t, `{"ok":true}`, string(job.Result))
+	})
+
+	t.Run("errors fail the job", func(t *testing.T) {
+		job, err := queue.Submit(project.ID, "compare", func(ctx context.Context, job *models.Job) error {
+			return errors.New("boom")
+		})
+		require.NoError(t, err)
+
+		job = waitForJob(t, db, job.ID)
+
+		assert.Equal(t, models.JobFailed, job.Status)
+		assert.Equal(t, "boom", job.Error)
+	})
+
+	t.Run("queue is bounded and jobs are canceled", func(t *testing.T) {
+		started := make(chan struct{})
+		blocking := func(ctx context.Context, job *models.Job) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		running, err := queue.Submit(project.ID, "dump", blocking)
+		require.NoError(t, err)
+		<-started
+		queued, err := queue.Submit(project.ID, "dump", func(ctx context.Context, job *models.Job) error { return nil })
+		require.NoError(t, err)
+
+		_, err = queue.Submit(project.ID, "dump", func(ctx context.Context, job *models.Job) error { return nil })
+		assert.ErrorIs(t, err, services.ErrQueueFull)
+
+		assert.True(t, queue.Cancel(queued.ID))
+		assert.True(t, queue.Cancel(running.ID))
+		assert.Equal(t, models.JobCanceled, waitForJob(t, db, running.ID).Status)
+		assert.Equal(t, models.JobCanceled, waitForJob(t, db, queued.ID).Status)
+		assert.False(t, queue.Cancel(running.ID))
+	})
+}
+
+func TestJobQueue_Stop(t *testing.T) {
+	db := SetupMetadataDB(t, "metadata_job_stop")
+	project := models.Project{Name: "Stop"}
+	require.NoError(t, db.Create(&project).Error)
+	queue := services.NewJobQueue(db, 2, 2)
+	require.NoError(t, queue.Start())
+
+	var submitters sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		submitters.Add(1)
+		go func() {
+			defer submitters.Done()
+			for j := 0; j < 20; j++ {
+				queue.Submit(project.ID, "dump", func(ctx context.Context, job *models.Job) error { return nil })
+			}
+		}()
+	}
+	queue.Stop() // Submitting while stopping must not send on the closed queue
+	submitters.Wait()
+	queue.Stop()
+
+	_, err := queue.Submit(project.ID, "dump", func(ctx context.Context, job *models.Job) error { return nil })
+	assert.ErrorIs(t, err, services.ErrQueueStopped)
+}
+
+func TestAsyncCompare(t *testing.T) {
+	db := SetupMetadataDB(t, "metadata_async")
+	project := models.Project{Name: "Async"}
+	require.NoError(t, db.Create(&project).Error)
+	users := func(columns ...models.Column) []models.Schema {
+		return []models.Schema{{Name: "public", Tables: []models.TableSchema{{
+			Name: "users", SchemaName: "public",
+			Columns: append([]models.Column{{Name: "id", DataType: "integer", IsPrimary: true}}, columns...),
+		}}}}
+	}
+	require.NoError(t, db.Create(&models.Snapshot{ProjectID: project.ID, Side: "target", Label: "before", Dialect: "postgres", Schemas: users()}).Error)
+	require.NoError(t, db.Create(&models.Snapshot{ProjectID: project.ID, Side: "target", Label: "after", Dialect: "postgres",
+		Schemas: users(models.Column{Name: "email", DataType: "text", IsNullable: true})}).Error)
+
+	originalJobs := services.Jobs
+	services.Jobs = services.NewJobQueue(db, 2, 10)
+	require.NoError(t, services.Jobs.Start())
+	t.Cleanup(func() {
+		services.Jobs.Stop()
+		services.Jobs = originalJobs
+	})
+
+	router := gin.New()
+	router.GET("/api/v1/projects/:id/compare", controllers.Async("compare", controllers.Compare))
+	router.GET("/api/v1/projects/:id/jobs/:jid", controllers.GetJob)
+	router.GET("/api/v1/projects/:id/jobs/:jid/result", controllers.GetJobResult)
+	router.POST("/api/v1/projects/:id/jobs/:jid/cancel", controllers.CancelJob)
+	serve := func(method, url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, url, nil))
+		return w
+	}
+	compare := "/api/v1/projects/1/compare?source_snapshot=1&target_snapshot=2"
+
+	t.Run("async compare answers with a job", func(t *testing.T) {
+		w := serve("GET", compare+"&async=true")
+
+		require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+		var job schemas.JobResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+		assert.Equal(t, "compare", job.Kind)
+		assert.Equal(t, "/api/v1/projects/1/jobs/1", w.Header().Get("Location"))
+
+		finished := waitForJob(t, db, job.ID)
+		assert.Equal(t, models.JobSucceeded, finished.Status, finished.Error)
+
+		result := serve("GET", "/api/v1/projects/1/jobs/1/result")
+		require.Equal(t, http.StatusOK, result.Code)
+		assert.JSONEq(t, serve("GET", compare).Body.String(), result.Body.String())
+
+		assert.Equal(t, http.StatusConflict, serve("POST", "/api/v1/projects/1/jobs/1/cancel").Code)
+	})
+
+	t.Run("failing requests fail their job", func(t *testing.T) {
+		w := serve("GET", "/api/v1/projects/1/compare?source_snapshot=99&target_snapshot=2&async=true")
+		require.Equal(t, http.StatusAccepted, w.Code)
+		var job schemas.JobResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+
+		finished := waitForJob(t, db, job.ID)
+
+		assert.Equal(t, models.JobFailed, finished.Status)
+		assert.NotEmpty(t, finished.Error)
+		assert.Equal(t, http.StatusNotFound, serve("GET", "/api/v1/projects/1/jobs/2/result").Code)
+	})
+
+	t.Run("unknown jobs", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, serve("GET", "/api/v1/projects/1/jobs/99").Code)
+	})
+}
+
+type streamedEvent struct {
+	id, name, data string
+}
+
+// readEvent reads the next Server-Sent Event of a stream
+func readEvent(t *testing.T, scanner *bufio.Scanner) (streamedEvent, bool) {
+	var event streamedEvent
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			return event, true
+		}
+		field, value, _ := strings.Cut(line, ":")
+		switch field {
+		case "id":
+			event.id = value
+		case "event":
+			event.name = value
+		case "data":
+			event.data = value
+		}
+	}
+	require.NoError(t, scanner.Err())
+	return event, event.name != ""
+}
+
+func TestStreamJobEvents(t *testing.T) {
+	db := SetupMetadataDB(t, "metadata_job_events")
+	project := models.Project{Name: "Events"}
+	require.NoError(t, db.Create(&project).Error)
+	target := SetupDB(t, "job_events_target", func(db *gorm.DB) {})
+
+	originalJobs := services.Jobs
+	services.Jobs = services.NewJobQueue(db, 1, 10)
+	require.NoError(t, services.Jobs.Start())
+	t.Cleanup(func() {
+		services.Jobs.Stop()
+		services.Jobs = originalJobs
+	})
+
+	router := gin.New()
+	router.GET("/api/v1/projects/:id/jobs/:jid/events", controllers.StreamJobEvents)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	stream := func(id uint) *bufio.Scanner {
+		response, err := http.Get(fmt.Sprintf("%s/api/v1/projects/%d/jobs/%d/events", server.URL, project.ID, id))
+		require.NoError(t, err)
+		t.Cleanup(func() { response.Body.Close() })
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Contains(t, response.Header.Get("Content-Type"), "text/event-stream")
+		return bufio.NewScanner(response.Body)
+	}
+
+	release := make(chan struct{})
+	job, err := services.Jobs.Submit(project.ID, "apply", func(ctx context.Context, job *models.Job) error {
+		services.StartPhase(ctx, services.PhaseConnecting)()
+		services.ApplyMigration(target.WithContext(ctx), services.ScriptSteps(`CREATE TABLE teams (id INTEGER PRIMARY KEY);
+			CREATE TABLE users (id INTEGER PRIMARY KEY);`))
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	t.Run("phases are streamed until the job finishes", func(t *testing.T) {
+		scanner := stream(job.ID)
+		var names, phases []string
+		var steps []services.ProgressEvent
+		var final services.JobStatusEvent
+		for {
+			event, ok := readEvent(t, scanner)
+			if !ok {
+				break
+			}
+			names = append(names, event.name)
+			assert.Equal(t, fmt.Sprint(len(names)), event.id)
+
+			switch event.name {
+			case services.JobEventPhase:
+				var progress services.ProgressEvent
+				require.NoError(t, json.Unmarshal([]byte(event.data), &progress))
+				phases = append(phases, progress.Phase+" "+progress.State)
+				if progress.State == services.ProgressStep {
+					steps = append(steps, progress)
+				}
+				if progress.Phase == services.PhaseExecuting && progress.State == services.ProgressFinished {
+					close(release)
+				}
+			case services.JobEventStatus:
+				require.NoError(t, json.Unmarshal([]byte(event.data), &final))
+			}
+		}
+
+		assert.Equal(t, []string{"status", "status", "phase", "phase", "phase", "phase", "phase", "phase", "status"}, names)
+		assert.Equal(t, []string{
+			"connecting started", "connecting finished",
+			"executing started", "executing step", "executing step", "executing finished",
+		}, phases)
+		require.Len(t, steps, 2)
+		assert.Equal(t, 2, steps[1].Step)
+		assert.Equal(t, 2, steps[1].Total)
+		assert.Equal(t, "statement:2", steps[1].Detail)
+		assert.Equal(t, models.JobSucceeded, final.Status)
+		require.Len(t, final.Timings, 2)
+		assert.Equal(t, services.PhaseConnecting, final.Timings[0].Phase)
+		assert.Equal(t, services.PhaseExecuting, final.Timings[1].Phase)
+	})
+
+	t.Run("finished jobs stream their final status", func(t *testing.T) {
+		waitForJob(t, db, job.ID)
+
+		scanner := stream(job.ID)
+		event, ok := readEvent(t, scanner)
+
+		require.True(t, ok)
+		assert.Equal(t, services.JobEventStatus, event.name)
+		assert.JSONEq(t, `{"status":"succeeded"}`, event.data)
+		_, ok = readEvent(t, scanner)
+		assert.False(t, ok)
+	})
+}
+
+func TestProgress_OverlappingPhases(t *testing.T) {
+	progress := services.NewProgress(func(services.ProgressEvent) {})
+	ctx := services.WithProgress(context.Background(), progress)
+
+	compared := services.StartPhase(ctx, services.PhaseComparing)
+	var wg sync.WaitGroup
+	for _, kind := range []string{"tables", "columns", "indexes"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			done := services.StartPhase(ctx, services.PhaseIntrospect+":"+kind)
+			time.Sleep(5 * time.Millisecond)
+			done()
+		}()
+	}
+	wg.Wait()
+	compared()
+
+	timings := progress.Timings()
+	require.Len(t, timings, 4)
+	for _, timing := range timings {
+		assert.LessOrEqual(t, timing.Percent, 100.0, timing.Phase)
+	}
+	assert.Equal(t, services.PhaseComparing, timings[3].Phase)
+	assert.Equal(t, 100.0, timings[3].Percent, "the phase spanning the operation takes all of its wall-clock time")
+}
@@ -0,0 +1,171 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/Tsarbomba69-com/mammoth.server/controllers"
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"github.com/Tsarbomba69-com/mammoth.server/schemas"
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+)
+
+func findingsByRule(findings []models.LintFinding) map[string][]models.LintFinding {
+	byRule := make(map[string][]models.LintFinding)
+	for _, finding := range findings {
+		byRule[finding.Rule] = append(byRule[finding.Rule], finding)
+	}
+	return byRule
+}
+
+func TestLint(t *testing.T) {
+	source := SetupSchemaDump(t, "source_lint", func(db *gorm.DB) {
+		db.Exec(`CREATE TABLE teams (id INTEGER PRIMARY KEY)`)
+		db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, nickname TEXT, team_id INTEGER)`)
+	})
+	target := SetupSchemaDump(t, "target_lint", func(db *gorm.DB) {
+		db.Exec(`CREATE TABLE teams (id INTEGER PRIMARY KEY)`)
+		db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, display_name TEXT, team_id INTEGER REFERENCES teams (id),
+			code TEXT NOT NULL, token TEXT DEFAULT (random()))`)
+		db.Exec(`CREATE INDEX idx_users_code ON users (code)`)
+		db.Exec(`CREATE TABLE posts (id INTEGER PRIMARY KEY, user_id INTEGER REFERENCES users (id))`)
+		db.Exec(`CREATE INDEX idx_posts_user ON posts (user_id)`)
+	})
+	diff := services.CompareSchemas("sqlite", source, target)
+	plan := services.PlanMigration("postgres", diff)
+
+	t.Run("rules report their findings", func(t *testing.T) {
+		byRule := findingsByRule(services.Lint(diff, plan, nil))
+
+		if assert.Len(t, byRule["not-null-without-default"], 1) {
+			finding := byRule["not-null-without-default"][0]
+			assert.Equal(t, models.LintError, finding.Level)
+			assert.Equal(t, "main.users.code", finding.Object)
+			assert.Equal(t, "add_column:main.users.code", finding.Step)
+		}
+		if assert.Len(t, byRule["index-not-concurrent"], 1) {
+			assert.Equal(t, "main.users.idx_users_code", byRule["index-not-concurrent"][0].Object)
+		}
+		if assert.Len(t, byRule["volatile-default"], 1) {
+			assert.Equal(t, "main.users.token", byRule["volatile-default"][0].Object)
+		}
+		if assert.Len(t, byRule["column-rename"], 1) {
+			assert.Equal(t, "main.users.nickname", byRule["column-rename"][0].Object)
+			assert.Contains(t, byRule["column-rename"][0].Message, "display_name")
+		}
+		if assert.Len(t, byRule["foreign-key-without-index"], 1, "the posts foreign key is indexed") {
+			assert.Contains(t, byRule["foreign-key-without-index"][0].Object, "main.users.")
+		}
+	})
+
+	t.Run("concurrent indexes pass", func(t *testing.T) {
+		concurrent := services.PlanMigration("postgres", diff, services.GenerateOptions{Concurrently: true})
+
+		assert.Empty(t, findingsByRule(services.Lint(diff, concurrent, nil))["index-not-concurrent"])
+	})
+
+	t.Run("disabled rules do not run", func(t *testing.T) {
+		byRule := findingsByRule(services.Lint(diff, plan, models.LintRules{"column-rename": false, "volatile-default": true}))
+
+		assert.Empty(t, byRule["column-rename"])
+		assert.NotEmpty(t, byRule["volatile-default"])
+	})
+
+	t.Run("dropped columns used by views", func(t *testing.T) {
+		diff := models.SchemaDiff{
+			TablesModified: []models.TableDiff{{Name: "users", SchemaName: "public", ColumnsRemoved: []models.Column{{Name: "email", DataType: "text"}}}},
+			Dependents: []models.Dependent{{Type: "view", SchemaName: "public", Name: "user_emails",
+				References: []models.DependentReference{{SchemaName: "public", Name: "users", Columns: []string{"id", "email"}}}}},
+		}
+
+		findings := findingsByRule(services.Lint(diff, services.PlanMigration("postgres", diff), nil))["drop-referenced-column"]
+
+		if assert.Len(t, findings, 1) {
+			assert.Equal(t, "drop_column:public.users.email", findings[0].Step)
+			assert.Contains(t, findings[0].Message, "public.user_emails")
+		}
+	})
+
+	t.Run("unknown rules are rejected", func(t *testing.T) {
+		assert.NoError(t, services.ValidateLintRules(models.LintRules{"column-rename": false}))
+		assert.Error(t, services.ValidateLintRules(models.LintRules{"no-such-rule": true}))
+	})
+}
+
+func TestLintEndpoints(t *testing.T) {
+	db := SetupMetadataDB(t, "metadata_lint")
+	project := models.Project{Name: "Lint"}
+	require.NoError(t, db.Create(&project).Error)
+	users := func(columns ...models.Column) []models.Schema {
+		return []models.Schema{{Name: "public", Tables: []models.TableSchema{{
+			Name: "users", SchemaName: "public",
+			Columns: append([]models.Column{{Name: "id", DataType: "integer", IsPrimary: true}}, columns...),
+		}}}}
+	}
+	require.NoError(t, db.Create(&models.Snapshot{ProjectID: project.ID, Side: "target", Label: "before", Dialect: "postgres", Schemas: users()}).Error)
+	require.NoError(t, db.Create(&models.Snapshot{ProjectID: project.ID, Side: "target", Label: "after", Dialect: "postgres",
+		Schemas: users(models.Column{Name: "code", DataType: "text"})}).Error)
+	projectID := ginParam("id", "1")
+
+	lint := func(t *testing.T) schemas.LintResponse {
+		c, w := newTestContext("GET", "/projects/1/lint?source_snapshot=1&target_snapshot=2", gin.Params{projectID})
+		controllers.Lint(c)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var response schemas.LintResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+
+	t.Run("lint with every rule", func(t *testing.T) {
+		response := lint(t)
+
+		assert.Len(t, response.Rules, len(services.LintRules))
+		if assert.Len(t, response.Findings, 1) {
+			assert.Equal(t, "not-null-without-default", response.Findings[0].Rule)
+		}
+	})
+
+	t.Run("disable a rule", func(t *testing.T) {
+		c, w := newTestContext("PUT", "/projects/1/lint/rules", gin.Params{projectID})
+		c.Request = httptest.NewRequest("PUT", "/projects/1/lint/rules", bytes.NewBufferString(`{"not-null-without-default": false}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+
+		controllers.UpdateLintRules(c)
+
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		response := lint(t)
+		assert.Empty(t, response.Findings)
+		for _, rule := range response.Rules {
+			assert.Equal(t, rule.Name != "not-null-without-default", rule.Enabled, rule.Name)
+		}
+	})
+
+	t.Run("unknown rule", func(t *testing.T) {
+		c, w := newTestContext("PUT", "/projects/1/lint/rules", gin.Params{projectID})
+		c.Request = httptest.NewRequest("PUT", "/projects/1/lint/rules", bytes.NewBufferString(`{"no-such-rule": false}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+
+		controllers.UpdateLintRules(c)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("compare returns findings", func(t *testing.T) {
+		c, w := newTestContext("GET", "/projects/1/compare?source_snapshot=1&target_snapshot=2", gin.Params{projectID})
+
+		controllers.Compare(c)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		var response schemas.SchemaComparisonResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.NotNil(t, response.LintFindings)
+	})
+}
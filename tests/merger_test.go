@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+)
+
+func mergeSchema(tables ...models.TableSchema) []models.Schema {
+	return []models.Schema{{Name: "public", Tables: tables}}
+}
+
+func usersTable(columns ...models.Column) models.TableSchema {
+	return models.TableSchema{
+		Name:       "users",
+		SchemaName: "public",
+		Columns: append([]models.Column{
+			{Name: "id", DataType: "integer", IsPrimary: true},
+		}, columns...),
+	}
+}
+
+func TestMerge(t *testing.T) {
+	t.Run("non-conflicting changes on both sides", func(t *testing.T) {
+		// Arrange
+		base := mergeSchema(usersTable())
+		ours := mergeSchema(usersTable(models.Column{Name: "email", DataType: "text", IsNullable: true}))
+		theirs := mergeSchema(
+			usersTable(),
+			models.TableSchema{Name: "posts", SchemaName: "public", Columns: []models.Column{{Name: "id", DataType: "integer"}}},
+		)
+
+		// Act
+		merge := services.Merge("postgres", base, ours, theirs)
+
+		// Assert
+		assert.Empty(t, merge.Conflicts)
+		require.Len(t, merge.Ours.TablesModified, 1)
+		assert.Equal(t, "email", merge.Ours.TablesModified[0].ColumnsAdded[0].Name)
+		require.Len(t, merge.Theirs.TablesAdded, 1)
+		assert.Equal(t, "posts", merge.Theirs.TablesAdded[0].Name)
+		assert.Equal(t, 1, merge.Merged.Summary["tables_added"])
+		assert.Equal(t, 1, merge.Merged.Summary["tables_modified"])
+
+		script := services.Generate("postgres", merge.Merged)
+		assert.Contains(t, script.Up, `CREATE TABLE "public"."posts"`)
+		assert.Contains(t, script.Up, `ADD COLUMN "email" text`)
+	})
+
+	t.Run("identical changes are merged once", func(t *testing.T) {
+		// Arrange
+		base := mergeSchema(usersTable())
+		both := mergeSchema(usersTable(models.Column{Name: "email", DataType: "text"}))
+
+		// Act
+		merge := services.Merge("postgres", base, both, both)
+
+		// Assert
+		assert.Empty(t, merge.Conflicts)
+		require.Len(t, merge.Merged.TablesModified, 1)
+		assert.Len(t, merge.Merged.TablesModified[0].ColumnsAdded, 1)
+	})
+
+	t.Run("same column altered differently", func(t *testing.T) {
+		// Arrange
+		base := mergeSchema(usersTable(models.Column{Name: "name", DataType: "text"}))
+		ours := mergeSchema(usersTable(models.Column{Name: "name", DataType: "character varying(100)"}))
+		theirs := mergeSchema(usersTable(models.Column{Name: "name", DataType: "character varying(255)"}))
+
+		// Act
+		merge := services.Merge("postgres", base, ours, theirs)
+
+		// Assert
+		require.Len(t, merge.Conflicts, 1)
+		conflict := merge.Conflicts[0]
+		assert.Equal(t, "column", conflict.ObjectType)
+		assert.Equal(t, "users", conflict.TableName)
+		assert.Equal(t, "name", conflict.Name)
+		assert.Equal(t, "modified", conflict.OursAction)
+		assert.Empty(t, merge.Ours.TablesModified)
+		assert.Empty(t, merge.Theirs.TablesModified)
+		assert.Empty(t, merge.Merged.TablesModified)
+	})
+
+	t.Run("table dropped on one side and altered on the other", func(t *testing.T) {
+		// Arrange
+		base := mergeSchema(usersTable())
+		ours := mergeSchema()
+		theirs := mergeSchema(usersTable(models.Column{Name: "email", DataType: "text"}))
+
+		// Act
+		merge := services.Merge("postgres", base, ours, theirs)
+
+		// Assert
+		require.Len(t, merge.Conflicts, 1)
+		assert.Equal(t, "removed", merge.Conflicts[0].OursAction)
+		assert.Equal(t, "added", merge.Conflicts[0].TheirsAction)
+		assert.Empty(t, merge.Merged.TablesRemoved)
+		assert.Empty(t, merge.Merged.TablesModified)
+	})
+
+	t.Run("merged changes are ordered whichever side they come from", func(t *testing.T) {
+		// Arrange
+		table := func(schemaName, name string) models.TableSchema {
+			return models.TableSchema{Name: name, SchemaName: schemaName, Columns: []models.Column{{Name: "id", DataType: "integer"}}}
+		}
+		base := []models.Schema{{Name: "app"}, {Name: "public"}}
+		ours := []models.Schema{{Name: "app"}, {Name: "public", Tables: []models.TableSchema{table("public", "accounts")}}}
+		theirs := []models.Schema{{Name: "app", Tables: []models.TableSchema{table("app", "zones")}}, {Name: "public"}}
+
+		// Act
+		merge := services.Merge("postgres", base, ours, theirs)
+		swapped := services.Merge("postgres", base, theirs, ours)
+
+		// Assert
+		require.Len(t, merge.Merged.TablesAdded, 2)
+		assert.Equal(t, "zones", merge.Merged.TablesAdded[0].Name, "app sorts before public")
+		assert.Equal(t, "accounts", merge.Merged.TablesAdded[1].Name)
+		assert.Equal(t, services.Generate("postgres", merge.Merged), services.Generate("postgres", swapped.Merged))
+	})
+
+	t.Run("dependents affected by either side are carried", func(t *testing.T) {
+		// Arrange
+		view := models.Dependent{
+			Type: "view", SchemaName: "public", Name: "user_names", Definition: "SELECT name FROM public.users",
+			References: []models.DependentReference{{SchemaName: "public", Name: "users", Columns: []string{"name"}}},
+		}
+		base := mergeSchema(usersTable(models.Column{Name: "name", DataType: "text"}))
+		base[0].Dependents = []models.Dependent{view}
+		ours := mergeSchema(usersTable(models.Column{Name: "name", DataType: "character varying(100)"}))
+		theirs := mergeSchema(usersTable(models.Column{Name: "name", DataType: "text"}, models.Column{Name: "email", DataType: "text"}))
+
+		// Act
+		merge := services.Merge("postgres", base, ours, theirs)
+
+		// Assert
+		assert.Equal(t, []models.Dependent{view}, merge.Merged.Dependents)
+		assert.Equal(t, []models.Dependent{view}, merge.Ours.Dependents)
+		assert.Empty(t, merge.Theirs.Dependents)
+		script := services.Generate("postgres", merge.Merged)
+		assert.Contains(t, script.Up, `DROP VIEW`)
+	})
+}
@@ -0,0 +1,176 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/Tsarbomba69-com/mammoth.server/controllers"
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"github.com/Tsarbomba69-com/mammoth.server/schemas"
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+)
+
+func TestMigrations(t *testing.T) {
+	db := SetupMetadataDB(t, "metadata_migrations")
+	project := models.Project{Name: "Migrations"}
+	other := models.Project{Name: "Other"}
+	require.NoError(t, db.Create(&project).Error)
+	require.NoError(t, db.Create(&other).Error)
+	for _, migration := range []models.Migration{
+		{ProjectID: project.ID, Direction: "left", Up: "CREATE TABLE a (id int);", Status: models.MigrationApplied, AppliedBy: "ana"},
+		{ProjectID: project.ID, Direction: "left", Up: "CREATE TABLE b (id int);", Status: models.MigrationFailed, AppliedBy: "ana", Error: "statement:1: boom"},
+		{ProjectID: project.ID, Direction: "right", Up: "CREATE TABLE c (id int);", Status: models.MigrationApplied, AppliedBy: "bo"},
+		{ProjectID: other.ID, Direction: "left", Up: "CREATE TABLE d (id int);", Status: models.MigrationApplied},
+	} {
+		migration.Checksum = services.ScriptChecksum(migration.Up)
+		require.NoError(t, db.Create(&migration).Error)
+	}
+
+	list := func(t *testing.T, query string) schemas.PageResponse[schemas.MigrationResponse] {
+		c, w := newTestContext("GET", "/projects/1/migrations?"+query, gin.Params{ginParam("id", "1")})
+		controllers.GetMigrations(c)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var page schemas.PageResponse[schemas.MigrationResponse]
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		return page
+	}
+
+	t.Run("list newest first", func(t *testing.T) {
+		page := list(t, "")
+
+		assert.Equal(t, uint(3), page.Total)
+		if assert.Len(t, page.Entries, 3) {
+			assert.Equal(t, uint(3), page.Entries[0].ID)
+			assert.Equal(t, "CREATE TABLE c (id int);", page.Entries[0].Up)
+		}
+	})
+
+	t.Run("filter and paginate", func(t *testing.T) {
+		page := list(t, "applied_by=ana&limit=1&page=2")
+
+		assert.Equal(t, uint(2), page.Total)
+		if assert.Len(t, page.Entries, 1) {
+			assert.Equal(t, models.MigrationApplied, page.Entries[0].Status)
+			assert.Equal(t, "ana", page.Entries[0].AppliedBy)
+		}
+
+		assert.Equal(t, uint(1), list(t, "status=failed").Total)
+		assert.Equal(t, uint(1), list(t, "direction=right").Total)
+	})
+
+	t.Run("get", func(t *testing.T) {
+		c, w := newTestContext("GET", "/projects/1/migrations/2", gin.Params{ginParam("id", "1"), ginParam("mid", "2")})
+
+		controllers.GetMigration(c)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		var migration schemas.MigrationResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &migration))
+		assert.Equal(t, "statement:1: boom", migration.Error)
+		assert.Equal(t, services.ScriptChecksum("CREATE TABLE b (id int);"), migration.Checksum)
+	})
+
+	t.Run("migrations of other projects are not found", func(t *testing.T) {
+		c, w := newTestContext("GET", "/projects/1/migrations/4", gin.Params{ginParam("id", "1"), ginParam("mid", "4")})
+
+		controllers.GetMigration(c)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("checksums ignore surrounding whitespace", func(t *testing.T) {
+		assert.Equal(t, services.ScriptChecksum("CREATE TABLE a (id int);"), services.ScriptChecksum("\n  CREATE TABLE a (id int);\n\n"))
+		assert.NotEqual(t, services.ScriptChecksum("CREATE TABLE a (id int);"), services.ScriptChecksum("CREATE TABLE b (id int);"))
+	})
+}
+
+func TestRollbackMigration(t *testing.T) {
+	metadata := SetupMetadataDB(t, "metadata_rollback")
+	project := models.Project{Name: "Rollback"}
+	require.NoError(t, metadata.Create(&project).Error)
+
+	apply := func(t *testing.T, target *gorm.DB, up, down string) models.Migration {
+		before, err := services.DumpSchema(target)
+		require.NoError(t, err)
+		snapshot := models.Snapshot{ProjectID: project.ID, Side: "target", Label: "pre-migration", Dialect: "sqlite", Schemas: before}
+		require.NoError(t, metadata.Create(&snapshot).Error)
+		require.True(t, services.ApplyMigration(target, services.ScriptSteps(up)).Success)
+		migration := models.Migration{ProjectID: project.ID, Up: up, Down: down, Status: models.MigrationApplied, SnapshotID: &snapshot.ID}
+		require.NoError(t, metadata.Create(&migration).Error)
+		return migration
+	}
+
+	t.Run("down restores the pre-migration schema", func(t *testing.T) {
+		target := SetupDB(t, "target_rollback", func(db *gorm.DB) {
+			db.Exec(`CREATE TABLE teams (id INTEGER PRIMARY KEY)`)
+		})
+		migration := apply(t, target, `CREATE TABLE users (id INTEGER PRIMARY KEY);`, `DROP TABLE users;`)
+
+		rollback, err := services.RollbackMigration(metadata, target, &migration)
+
+		require.NoError(t, err)
+		assert.True(t, rollback.Execution.Success)
+		assert.True(t, rollback.Verified, "%+v", rollback.Differences)
+		var stored models.Migration
+		require.NoError(t, metadata.First(&stored, migration.ID).Error)
+		assert.Equal(t, models.MigrationRolledBack, stored.Status)
+		assert.NotNil(t, stored.RolledBackAt)
+		assert.Empty(t, stored.Error)
+	})
+
+	t.Run("incomplete down is reported", func(t *testing.T) {
+		target := SetupDB(t, "target_rollback_incomplete", func(db *gorm.DB) {})
+		migration := apply(t, target, `CREATE TABLE users (id INTEGER PRIMARY KEY); CREATE TABLE posts (id INTEGER PRIMARY KEY);`, `DROP TABLE users;`)
+
+		rollback, err := services.RollbackMigration(metadata, target, &migration)
+
+		require.NoError(t, err)
+		assert.False(t, rollback.Verified)
+		assert.Len(t, rollback.Differences.TablesRemoved, 1)
+		assert.Contains(t, migration.Error, "differences")
+	})
+
+	t.Run("failing down keeps the migration applied", func(t *testing.T) {
+		target := SetupDB(t, "target_rollback_failure", func(db *gorm.DB) {})
+		migration := apply(t, target, `CREATE TABLE users (id INTEGER PRIMARY KEY);`, `DROP TABLE missing;`)
+
+		rollback, err := services.RollbackMigration(metadata, target, &migration)
+
+		require.NoError(t, err)
+		assert.False(t, rollback.Execution.Success)
+		var stored models.Migration
+		require.NoError(t, metadata.First(&stored, migration.ID).Error)
+		assert.Equal(t, models.MigrationApplied, stored.Status)
+		assert.Contains(t, stored.Error, "rollback failed at statement:1")
+	})
+
+	t.Run("later applied migrations block the rollback", func(t *testing.T) {
+		first := models.Migration{ProjectID: project.ID, Down: "DROP TABLE a;", Status: models.MigrationApplied}
+		second := models.Migration{ProjectID: project.ID, Down: "DROP TABLE b;", Status: models.MigrationApplied}
+		require.NoError(t, metadata.Create(&first).Error)
+		require.NoError(t, metadata.Create(&second).Error)
+		c, w := newTestContext("POST", "/rollback", gin.Params{ginParam("id", "1"), ginParam("mid", strconv.Itoa(int(first.ID)))})
+
+		controllers.RollbackMigration(c)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), strconv.Itoa(int(second.ID)))
+	})
+
+	t.Run("only applied migrations are rolled back", func(t *testing.T) {
+		failed := models.Migration{ProjectID: project.ID, Down: "DROP TABLE a;", Status: models.MigrationFailed}
+		require.NoError(t, metadata.Create(&failed).Error)
+		c, w := newTestContext("POST", "/rollback", gin.Params{ginParam("id", "1"), ginParam("mid", strconv.Itoa(int(failed.ID)))})
+
+		controllers.RollbackMigration(c)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+}
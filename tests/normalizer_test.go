@@ -0,0 +1,205 @@
+package tests
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+)
+
+func TestNormalizePostgresType(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"int4", "integer"},
+		{"INTEGER", "integer"},
+		{"int8", "bigint"},
+		{"bool", "boolean"},
+		{"float8", "double precision"},
+		{"varchar(20)", "character varying(20)"},
+		{"VARCHAR (255)", "character varying(255)"},
+		{"numeric(10, 2)", "numeric(10,2)"},
+		{"timestamptz", "timestamp with time zone"},
+		{"timestamp(3)", "timestamp(3) without time zone"},
+		{"timestamptz(6)", "timestamp(6) with time zone"},
+		{"timestamp(3) with time zone", "timestamp(3) with time zone"},
+		{"TIMESTAMP (3) WITHOUT TIME ZONE", "timestamp(3) without time zone"},
+		{"timestamp with time zone", "timestamp with time zone"},
+		{"time(0)", "time(0) without time zone"},
+		{"timetz(2)[]", "time(2) with time zone[]"},
+		{"int4[]", "integer[]"},
+		{"character  varying", "character varying"},
+		{"text", "text"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			col := services.NormalizePostgresType(models.Column{DataType: tt.input})
+			assert.Equal(t, tt.expected, col.DataType)
+		})
+	}
+}
+
+func TestNormalizePostgresDefault(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"text literal cast", "'foo'::text", "'foo'"},
+		{"varchar literal cast", "'foo'::character varying", "'foo'"},
+		{"escaped quote", "'it''s'::text", "'it''s'"},
+		{"numeric literal cast", "(0)::numeric", "0"},
+		{"negative literal cast", "'-1'::integer", "'-1'"},
+		{"qualified nextval", "nextval('public.users_id_seq'::regclass)", "nextval('users_id_seq')"},
+		{"quoted nextval", `nextval('"public"."users_id_seq"'::regclass)`, "nextval('users_id_seq')"},
+		{"unqualified nextval", "nextval('users_id_seq'::regclass)", "nextval('users_id_seq')"},
+		{"now", "now()", "CURRENT_TIMESTAMP"},
+		{"current_timestamp", "current_timestamp", "CURRENT_TIMESTAMP"},
+		{"concatenation", "'a'::text || 'b'::text", "'a' || 'b'"},
+		{"plain literal", "42", "42"},
+		{"empty", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			col := services.NormalizePostgresDefault(models.Column{Default: tt.input})
+			assert.Equal(t, tt.expected, col.ComparedDefault())
+			assert.Equal(t, tt.input, col.Default, "the introspected default is kept for generation")
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	t.Run("equivalent schemas compare equal", func(t *testing.T) {
+		// Arrange
+		source := []models.Schema{{
+			Name: "public",
+			Tables: []models.TableSchema{{
+				Name:       "users",
+				SchemaName: "public",
+				Columns: []models.Column{
+					{Name: "id", DataType: "int4", IsPrimary: true, Default: "nextval('public.users_id_seq'::regclass)"},
+					{Name: "created_at", DataType: "timestamptz", Default: "now()"},
+				},
+				Indexes: []models.Index{
+					{Name: "users_pkey", Columns: []string{"tenant_id", "id"}, IsPrimary: true, IsUnique: true},
+				},
+			}},
+		}}
+		target := []models.Schema{{
+			Name: "public",
+			Tables: []models.TableSchema{{
+				Name:       "users",
+				SchemaName: "public",
+				Columns: []models.Column{
+					{Name: "id", DataType: "integer", IsPrimary: true, Default: "nextval('users_id_seq'::regclass)"},
+					{Name: "created_at", DataType: "timestamp with time zone", Default: "CURRENT_TIMESTAMP"},
+				},
+				Indexes: []models.Index{
+					{Name: "users_pkey", Columns: []string{"id", "tenant_id"}, IsPrimary: true, IsUnique: true},
+				},
+			}},
+		}}
+
+		// Act
+		diff := services.CompareSchemas("postgres", source, target)
+
+		// Assert
+		assert.Empty(t, diff.TablesModified)
+		assert.Equal(t, []string{"users"}, diff.TablesSame)
+		assert.Equal(t, "int4", source[0].Tables[0].Columns[0].DataType, "input must not be mutated")
+		assert.Equal(t, "tenant_id", source[0].Tables[0].Indexes[0].Columns[0], "input must not be mutated")
+	})
+
+	t.Run("generated defaults keep their qualifier", func(t *testing.T) {
+		source := []models.Schema{{Name: "app", Tables: []models.TableSchema{{
+			Name:       "users",
+			SchemaName: "app",
+			Columns:    []models.Column{{Name: "id", DataType: "integer", IsPrimary: true}},
+		}}}}
+		target := []models.Schema{{Name: "app", Tables: []models.TableSchema{{
+			Name:       "users",
+			SchemaName: "app",
+			Columns: []models.Column{
+				{Name: "id", DataType: "integer", IsPrimary: true},
+				{Name: "code", DataType: "integer", IsNullable: true, Default: "nextval('shared.codes_seq'::regclass)"},
+			},
+		}}}}
+
+		diff := services.CompareSchemas("postgres", source, target)
+		script := services.Generate("postgres", diff)
+
+		assert.Contains(t, script.Up, `ADD COLUMN "code" integer DEFAULT nextval('shared.codes_seq'::regclass);`)
+	})
+
+	t.Run("unknown dialect is left untouched", func(t *testing.T) {
+		schemas := []models.Schema{{Name: "main", Tables: []models.TableSchema{{
+			Name:    "users",
+			Columns: []models.Column{{Name: "id", DataType: "INTEGER"}},
+		}}}}
+
+		assert.Equal(t, schemas, services.Normalize("sqlite", schemas))
+	})
+
+	t.Run("custom normalizer", func(t *testing.T) {
+		services.RegisterNormalizer("custom", services.Normalizer{
+			ColumnRules: []services.ColumnRule{services.NormalizePostgresType},
+		})
+		schemas := []models.Schema{{Name: "main", Tables: []models.TableSchema{{
+			Name:    "users",
+			Columns: []models.Column{{Name: "id", DataType: "INT4"}},
+		}}}}
+
+		normalized := services.Normalize("custom", schemas)
+
+		assert.Equal(t, "integer", normalized[0].Tables[0].Columns[0].DataType)
+	})
+
+	t.Run("dumps keep introspected types and comparisons normalize them", func(t *testing.T) {
+		services.RegisterNormalizer("sqlite", services.Normalizer{
+			ColumnRules: []services.ColumnRule{services.NormalizePostgresType},
+		})
+		t.Cleanup(func() { services.RegisterNormalizer("sqlite", services.Normalizer{}) })
+		source := SetupSchemaDump(t, "source_normalized", func(db *gorm.DB) {
+			db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, age INT4)")
+		})
+		target := SetupSchemaDump(t, "target_normalized", func(db *gorm.DB) {
+			db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, age INTEGER)")
+		})
+
+		diff := services.CompareSchemas("sqlite", source, target)
+
+		assert.Equal(t, "INT4", source[0].Tables[0].Columns[1].DataType)
+		assert.Empty(t, diff.TablesModified)
+		assert.Equal(t, []string{"users"}, diff.TablesSame)
+	})
+
+	t.Run("registration runs alongside normalization", func(t *testing.T) {
+		schemas := []models.Schema{{Name: "main", Tables: []models.TableSchema{{
+			Name:    "users",
+			Columns: []models.Column{{Name: "id", DataType: "INT4"}},
+		}}}}
+
+		var wg sync.WaitGroup
+		for range 8 {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				services.RegisterNormalizer("concurrent", services.Normalizer{ColumnRules: []services.ColumnRule{services.NormalizePostgresType}})
+			}()
+			go func() {
+				defer wg.Done()
+				services.Normalize("concurrent", schemas)
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, "integer", services.Normalize("concurrent", schemas)[0].Tables[0].Columns[0].DataType)
+	})
+}
@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/Tsarbomba69-com/mammoth.server/controllers"
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"github.com/Tsarbomba69-com/mammoth.server/reports"
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+)
+
+func reportFixture(t *testing.T) (models.SchemaDiff, services.MigrationScript) {
+	source := SetupSchemaDump(t, "source_report", func(db *gorm.DB) {
+		db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)`)
+		db.Exec(`CREATE TABLE sessions (id INTEGER PRIMARY KEY)`)
+	})
+	target := SetupSchemaDump(t, "target_report", func(db *gorm.DB) {
+		db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, name VARCHAR(255), email TEXT)`)
+		db.Exec(`CREATE TABLE sessions (id INTEGER PRIMARY KEY)`)
+		db.Exec(`CREATE TABLE posts (id INTEGER PRIMARY KEY, title TEXT)`)
+	})
+	diff := services.CompareSchemas("sqlite", source, target)
+	return diff, services.Generate("postgres", diff)
+}
+
+func TestReports(t *testing.T) {
+	diff, script := reportFixture(t)
+
+	t.Run("markdown", func(t *testing.T) {
+		var out bytes.Buffer
+
+		require.NoError(t, reports.MarkdownRenderer{}.Render(&out, diff, script))
+
+		assert.Contains(t, out.String(), "| tables added | 1 |")
+		assert.Contains(t, out.String(), "- **added** `main.posts` (table)")
+		assert.Contains(t, out.String(), "- **modified** `name` (column on `main.users`)")
+		assert.Contains(t, out.String(), "  - data_type: TEXT → VARCHAR(255)")
+		assert.Contains(t, out.String(), "```sql\nCREATE TABLE")
+	})
+
+	t.Run("html", func(t *testing.T) {
+		var out bytes.Buffer
+
+		require.NoError(t, reports.HTMLRenderer{}.Render(&out, diff, script))
+
+		assert.Contains(t, out.String(), "<!DOCTYPE html>")
+		assert.Contains(t, out.String(), "<summary class=\"modified\">main.users (modified)</summary>")
+		assert.Contains(t, out.String(), `<span class="kw">CREATE</span> <span class="kw">TABLE</span> &#34;main&#34;.&#34;posts&#34;`)
+	})
+
+	t.Run("junit", func(t *testing.T) {
+		var out bytes.Buffer
+
+		require.NoError(t, reports.JUnitRenderer{}.Render(&out, diff, script))
+
+		var suites struct {
+			Tests    int `xml:"tests,attr"`
+			Failures int `xml:"failures,attr"`
+			Suites   []struct {
+				TestCases []struct {
+					Name    string `xml:"name,attr"`
+					Failure *struct {
+						Type string `xml:"type,attr"`
+					} `xml:"failure"`
+				} `xml:"testcase"`
+			} `xml:"testsuite"`
+		}
+		require.NoError(t, xml.Unmarshal(out.Bytes(), &suites))
+		assert.Equal(t, 4, suites.Tests) // posts, users.email, users.name and sessions
+		assert.Equal(t, 3, suites.Failures)
+		assert.Equal(t, "table main.posts", suites.Suites[0].TestCases[0].Name)
+		assert.Equal(t, "added", suites.Suites[0].TestCases[0].Failure.Type)
+		assert.Nil(t, suites.Suites[0].TestCases[3].Failure)
+	})
+
+	t.Run("format selection", func(t *testing.T) {
+		assert.Equal(t, "markdown", reports.FormatFromAccept("text/markdown"))
+		assert.Equal(t, "html", reports.FormatFromAccept("text/html,application/xhtml+xml;q=0.9"))
+		assert.Equal(t, "junit", reports.FormatFromAccept("application/junit+xml"))
+		assert.Equal(t, "", reports.FormatFromAccept("*/*"))
+
+		_, err := reports.NewRenderer("pdf")
+		assert.Error(t, err)
+	})
+
+	t.Run("compare endpoint honours the format", func(t *testing.T) {
+		db := SetupMetadataDB(t, "metadata_reports")
+		project := models.Project{Name: "Reports"}
+		require.NoError(t, db.Create(&project).Error)
+		for _, schemas := range [][]models.Schema{{{Name: "public"}}, {{Name: "public", Tables: []models.TableSchema{{Name: "posts", SchemaName: "public"}}}}} {
+			require.NoError(t, db.Create(&models.Snapshot{ProjectID: project.ID, Dialect: "postgres", Schemas: schemas}).Error)
+		}
+
+		c, w := newTestContext("GET", "/projects/1/compare?source_snapshot=1&target_snapshot=2&format=markdown", nil)
+		c.Params = append(c.Params, ginParam("id", "1"))
+
+		controllers.Compare(c)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/markdown; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Body.String(), "`public.posts` (table)")
+	})
+}
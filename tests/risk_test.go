@@ -0,0 +1,160 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/Tsarbomba69-com/mammoth.server/controllers"
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"github.com/Tsarbomba69-com/mammoth.server/schemas"
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+)
+
+func riskOf(t *testing.T, risks []models.ChangeRisk, objectType, name string) models.ChangeRisk {
+	for _, risk := range risks {
+		if risk.ObjectType == objectType && risk.Name == name {
+			return risk
+		}
+	}
+	t.Fatalf("no %s risk for %s in %+v", objectType, name, risks)
+	return models.ChangeRisk{}
+}
+
+func TestClassifyRisks(t *testing.T) {
+	t.Run("table changes", func(t *testing.T) {
+		source := SetupSchemaDump(t, "source_risk", func(db *gorm.DB) {
+			db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, name VARCHAR(255), age BIGINT, bio TEXT, nickname TEXT)`)
+			db.Exec(`CREATE TABLE audit (id INTEGER PRIMARY KEY)`)
+		})
+		target := SetupSchemaDump(t, "target_risk", func(db *gorm.DB) {
+			db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, name VARCHAR(50), age INTEGER, bio TEXT NOT NULL, email TEXT)`)
+		})
+
+		diff := services.CompareSchemas("sqlite", source, target)
+
+		require.Len(t, diff.TablesRemoved, 1)
+		audit := diff.TablesRemoved[0]
+		assert.Equal(t, models.SeverityDestructive, audit.Severity)
+		assert.Equal(t, []string{models.ReasonDataLoss, models.ReasonAccessExclusiveLock}, audit.Risks[0].Reasons)
+
+		require.Len(t, diff.TablesModified, 1)
+		users := diff.TablesModified[0]
+		assert.Equal(t, models.SeverityDestructive, users.Severity)
+
+		name := riskOf(t, users.Risks, "column", "name")
+		assert.Equal(t, models.SeverityDestructive, name.Severity)
+		assert.Contains(t, name.Reasons, models.ReasonTypeNarrowing)
+		assert.Equal(t, "main.users", name.TableName)
+
+		age := riskOf(t, users.Risks, "column", "age")
+		assert.Equal(t, models.SeverityDestructive, age.Severity)
+
+		bio := riskOf(t, users.Risks, "column", "bio")
+		assert.Equal(t, models.SeverityCaution, bio.Severity)
+		assert.Equal(t, []string{models.ReasonNotNullOnExistingColumn, models.ReasonAccessExclusiveLock}, bio.Reasons)
+
+		email := riskOf(t, users.Risks, "column", "email")
+		assert.Equal(t, models.SeveritySafe, email.Severity)
+		assert.Empty(t, email.Reasons)
+
+		nickname := riskOf(t, users.Risks, "column", "nickname")
+		assert.Equal(t, []string{models.ReasonDataLoss}, nickname.Reasons)
+
+		assert.Equal(t, models.SeverityDestructive, diff.Severity)
+		assert.Equal(t, 1, diff.Summary["risk_safe"])
+		assert.Equal(t, 1, diff.Summary["risk_caution"])
+		assert.Equal(t, 4, diff.Summary["risk_destructive"])
+	})
+
+	t.Run("type changes", func(t *testing.T) {
+		cases := []struct {
+			from, to string
+			severity string
+		}{
+			{"varchar(50)", "varchar(100)", models.SeveritySafe},
+			{"character varying(50)", "text", models.SeveritySafe},
+			{"text", "varchar(20)", models.SeverityDestructive},
+			{"integer", "bigint", models.SeverityCaution},
+			{"bigint", "smallint", models.SeverityDestructive},
+			{"numeric(10,2)", "numeric(12,2)", models.SeveritySafe},
+			{"numeric(10,2)", "numeric(10,1)", models.SeverityDestructive},
+			{"double precision", "real", models.SeverityDestructive},
+			{"integer", "text", models.SeverityCaution},
+			{"text", "integer", models.SeverityDestructive},
+		}
+
+		for _, tc := range cases {
+			source := []models.Schema{{Name: "public", Tables: []models.TableSchema{{Name: "t", SchemaName: "public",
+				Columns: []models.Column{{Name: "c", DataType: tc.from, IsNullable: true}}}}}}
+			target := []models.Schema{{Name: "public", Tables: []models.TableSchema{{Name: "t", SchemaName: "public",
+				Columns: []models.Column{{Name: "c", DataType: tc.to, IsNullable: true}}}}}}
+
+			diff := services.CompareSchemas("postgres", source, target)
+
+			require.Len(t, diff.TablesModified, 1, "%s -> %s", tc.from, tc.to)
+			assert.Equal(t, tc.severity, diff.TablesModified[0].Severity, "%s -> %s", tc.from, tc.to)
+		}
+	})
+
+	t.Run("schema and sequence changes", func(t *testing.T) {
+		source := []models.Schema{{Name: "public", Sequences: []models.Sequence{{Name: "s", SchemaName: "public", MinValue: 1, MaxValue: 1000, Increment: 1}}}, {Name: "old"}}
+		target := []models.Schema{{Name: "public", Sequences: []models.Sequence{{Name: "s", SchemaName: "public", MinValue: 1, MaxValue: 100, Increment: 1}}}, {Name: "new"}}
+
+		diff := services.CompareSchemas("postgres", source, target)
+
+		assert.Equal(t, models.SeveritySafe, riskOf(t, diff.Risks, "schema", "new").Severity)
+		assert.Equal(t, models.SeverityDestructive, riskOf(t, diff.Risks, "schema", "old").Severity)
+		seq := riskOf(t, diff.Risks, "sequence", "public.s")
+		assert.Equal(t, models.SeverityCaution, seq.Severity)
+		assert.Equal(t, []string{models.ReasonRangeNarrowing}, seq.Reasons)
+	})
+}
+
+func TestCompareRiskPolicy(t *testing.T) {
+	db := SetupMetadataDB(t, "metadata_risk")
+	project := models.Project{Name: "Risky", MaxRisk: models.SeverityCaution}
+	require.NoError(t, db.Create(&project).Error)
+	source := []models.Schema{{Name: "public", Tables: []models.TableSchema{{Name: "users", SchemaName: "public"}}}}
+	for _, schemas := range [][]models.Schema{source, {{Name: "public"}}} {
+		require.NoError(t, db.Create(&models.Snapshot{ProjectID: project.ID, Dialect: "postgres", Schemas: schemas}).Error)
+	}
+
+	compare := func(query string) (int, schemas.SchemaComparisonResponse) {
+		c, w := newTestContext("GET", "/projects/1/compare?source_snapshot=1&target_snapshot=2"+query, nil)
+		c.Params = append(c.Params, ginParam("id", "1"))
+		controllers.Compare(c)
+
+		var response schemas.SchemaComparisonResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	t.Run("project policy rejects destructive changes", func(t *testing.T) {
+		code, response := compare("")
+
+		assert.Equal(t, http.StatusUnprocessableEntity, code)
+		require.NotNil(t, response.Policy)
+		assert.False(t, response.Policy.Passed)
+		assert.Equal(t, models.SeverityDestructive, response.Policy.Severity)
+		require.Len(t, response.Policy.Violations, 1)
+		assert.Equal(t, "public.users", response.Policy.Violations[0].Name)
+	})
+
+	t.Run("query overrides the policy", func(t *testing.T) {
+		code, response := compare("&max_risk=destructive")
+
+		assert.Equal(t, http.StatusOK, code)
+		assert.True(t, response.Policy.Passed)
+	})
+
+	t.Run("invalid risk level", func(t *testing.T) {
+		code, _ := compare("&max_risk=reckless")
+
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+}
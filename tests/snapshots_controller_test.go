@@ -0,0 +1,189 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Tsarbomba69-com/mammoth.server/controllers"
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"github.com/Tsarbomba69-com/mammoth.server/repositories"
+	"github.com/Tsarbomba69-com/mammoth.server/schemas"
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// SetupMetadataDB points the repositories at an in-memory metadata database
+func SetupMetadataDB(t *testing.T, dbName string) *gorm.DB {
+	gin.SetMode(gin.TestMode)
+	db := SetupDB(t, dbName, func(db *gorm.DB) {
+		if err := db.AutoMigrate(
+			&models.DBConnection{},
+			&models.Project{},
+			&models.Snapshot{},
+			&models.DriftEvent{},
+			&models.Migration{},
+			&models.Job{},
+		); err != nil {
+			t.Fatalf("failed to migrate database: %v", err)
+		}
+	})
+	originalDB := repositories.Context
+	repositories.Context = db
+	t.Cleanup(func() { repositories.Context = originalDB })
+	return db
+}
+
+func newTestContext(method, url string, params gin.Params) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, url, nil)
+	c.Params = params
+	return c, w
+}
+
+func ginParam(key, value string) gin.Param {
+	return gin.Param{Key: key, Value: value}
+}
+
+func TestSnapshots(t *testing.T) {
+	db := SetupMetadataDB(t, "metadata_snapshots")
+	project := models.Project{Name: "Snapshots"}
+	require.NoError(t, db.Create(&project).Error)
+
+	before := models.Snapshot{
+		ProjectID: project.ID,
+		Side:      "target",
+		Label:     "before",
+		Dialect:   "postgres",
+		Schemas: []models.Schema{{Name: "public", Tables: []models.TableSchema{{
+			Name: "users", SchemaName: "public",
+			Columns: []models.Column{{Name: "id", DataType: "integer", IsPrimary: true}},
+		}}}},
+	}
+	after := before
+	after.Label = "after"
+	after.Schemas = []models.Schema{{Name: "public", Tables: []models.TableSchema{{
+		Name: "users", SchemaName: "public",
+		Columns: []models.Column{
+			{Name: "id", DataType: "integer", IsPrimary: true},
+			{Name: "email", DataType: "text", IsNullable: true},
+		},
+	}}}}
+	require.NoError(t, db.Create(&before).Error)
+	require.NoError(t, db.Create(&after).Error)
+	projectID := gin.Param{Key: "id", Value: "1"}
+
+	t.Run("list snapshots", func(t *testing.T) {
+		c, w := newTestContext("GET", "/projects/1/snapshots", gin.Params{projectID})
+
+		controllers.GetSnapshots(c)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var page schemas.PageResponse[schemas.SnapshotResponse]
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		assert.Equal(t, uint(2), page.Total)
+		assert.Len(t, page.Entries, 2)
+		assert.Empty(t, page.Entries[0].Schemas, "list must not include schema content")
+	})
+
+	t.Run("get snapshot", func(t *testing.T) {
+		c, w := newTestContext("GET", "/projects/1/snapshots/1", gin.Params{projectID, {Key: "sid", Value: "1"}})
+
+		controllers.GetSnapshot(c)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response schemas.SnapshotResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "before", response.Label)
+		assert.Equal(t, "users", response.Schemas[0].Tables[0].Name)
+	})
+
+	t.Run("compare two snapshots", func(t *testing.T) {
+		c, w := newTestContext("GET", "/projects/1/compare?source_snapshot=1&target_snapshot=2", gin.Params{projectID})
+
+		controllers.Compare(c)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response schemas.SchemaComparisonResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, 1, response.Differences.Summary["tables_modified"])
+		assert.Equal(t, "ALTER TABLE \"public\".\"users\" ADD COLUMN \"email\" text;\n", response.MigrationScript.Up)
+	})
+
+	t.Run("verification requires POST", func(t *testing.T) {
+		c, w := newTestContext("GET", "/projects/1/compare?source_snapshot=1&target_snapshot=2&verify=true", gin.Params{projectID})
+
+		controllers.Compare(c)
+
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+
+	t.Run("verification without scratch database", func(t *testing.T) {
+		c, w := newTestContext("POST", "/projects/1/compare?source_snapshot=1&target_snapshot=2&verify=true", gin.Params{projectID})
+
+		controllers.Compare(c)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "no scratch database")
+	})
+
+	t.Run("record the generated migration", func(t *testing.T) {
+		c, w := newTestContext("GET", "/projects/1/compare?source_snapshot=1&target_snapshot=2&record=true", gin.Params{projectID})
+
+		controllers.Compare(c)
+
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+		c, w = newTestContext("POST", "/projects/1/compare?source_snapshot=1&target_snapshot=2&direction=right&record=true", gin.Params{projectID})
+
+		controllers.Compare(c)
+
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var response schemas.SchemaComparisonResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.NotNil(t, response.MigrationID)
+		var migration models.Migration
+		require.NoError(t, db.First(&migration, *response.MigrationID).Error)
+		assert.Equal(t, models.MigrationPending, migration.Status)
+		assert.Equal(t, "right", migration.Direction)
+		assert.Equal(t, response.MigrationScript.Up, migration.Up)
+		assert.Equal(t, response.MigrationScript.Down, migration.Down)
+		assert.Equal(t, services.ScriptChecksum(migration.Up), migration.Checksum)
+		assert.Nil(t, migration.AppliedAt)
+	})
+
+	t.Run("unsupported format is rejected before comparing", func(t *testing.T) {
+		c, w := newTestContext("POST", "/projects/1/compare?source_snapshot=1&target_snapshot=99&record=true&format=rails", gin.Params{projectID})
+
+		controllers.Compare(c)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+		var count int64
+		db.Model(&models.Migration{}).Count(&count)
+		assert.Equal(t, int64(1), count, "only the migration recorded earlier")
+	})
+
+	t.Run("compare with unknown snapshot", func(t *testing.T) {
+		c, w := newTestContext("GET", "/projects/1/compare?source_snapshot=1&target_snapshot=99", gin.Params{projectID})
+
+		controllers.Compare(c)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("delete snapshot", func(t *testing.T) {
+		c, _ := newTestContext("DELETE", "/projects/1/snapshots/2", gin.Params{projectID, {Key: "sid", Value: "2"}})
+
+		controllers.DeleteSnapshot(c)
+
+		assert.Equal(t, http.StatusNoContent, c.Writer.Status())
+		var count int64
+		db.Model(&models.Snapshot{}).Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+}
@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Tsarbomba69-com/mammoth.server/controllers"
+	"github.com/Tsarbomba69-com/mammoth.server/ddl"
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"github.com/Tsarbomba69-com/mammoth.server/schemas"
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+)
+
+func TestTemplates(t *testing.T) {
+	diff := models.SchemaDiff{
+		TablesAdded: []models.TableDiff{{Name: "teams", SchemaName: "public",
+			ColumnsAdded: []models.Column{{Name: "id", DataType: "integer", IsPrimary: true}},
+			IndexesAdded: []models.Index{{Name: "idx_teams_id", Columns: []string{"id"}}}}},
+		TablesModified: []models.TableDiff{{Name: "users", SchemaName: "public",
+			ColumnsAdded: []models.Column{{Name: "code", DataType: "text", IsNullable: true}}}},
+	}
+
+	t.Run("overridden methods use their template", func(t *testing.T) {
+		templates, err := ddl.ParseTemplates(map[string]string{
+			"AddColumnSQL":   `ALTER TABLE {{quote .SchemaName}}.{{quote .TableName}} ADD COLUMN IF NOT EXISTS {{quote .Column.Name}} {{.Column.DataType}};` + "\n",
+			"CreateIndexSQL": `-- index {{.Name}}` + "\n" + `{{.Default}}`,
+		})
+		require.NoError(t, err)
+
+		script := services.Generate("postgres", diff, services.GenerateOptions{Templates: templates})
+
+		assert.Contains(t, script.Up, `ALTER TABLE "public"."users" ADD COLUMN IF NOT EXISTS "code" text;`)
+		assert.Contains(t, script.Up, "-- index idx_teams_id\nCREATE INDEX \"idx_teams_id\" ON \"public\".\"teams\" (\"id\");")
+		assert.Contains(t, script.Up, `CREATE TABLE "public"."teams"`, "methods without a template keep the built-in SQL")
+		assert.Contains(t, script.Down, `ALTER TABLE "public"."users" DROP COLUMN "code";`)
+	})
+
+	t.Run("invalid templates are rejected", func(t *testing.T) {
+		for name, sources := range map[string]map[string]string{
+			"unknown method":   {"CreateWidgetSQL": "SELECT 1;"},
+			"syntax error":     {"DropTableSQL": "DROP TABLE {{.TableName"},
+			"unknown field":    {"DropTableSQL": "DROP TABLE {{.Table.Nope}};"},
+			"unknown function": {"DropTableSQL": "DROP TABLE {{shout .TableName}};"},
+		} {
+			_, err := ddl.ParseTemplates(sources)
+			assert.Error(t, err, name)
+		}
+	})
+}
+
+func TestUpdateTemplates(t *testing.T) {
+	db := SetupMetadataDB(t, "metadata_templates")
+	project := models.Project{Name: "Templates"}
+	require.NoError(t, db.Create(&project).Error)
+	projectID := ginParam("id", "1")
+
+	update := func(body string) *httptest.ResponseRecorder {
+		c, w := newTestContext("PUT", "/projects/1/templates", gin.Params{projectID})
+		c.Request = httptest.NewRequest("PUT", "/projects/1/templates", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		controllers.UpdateTemplates(c)
+		return w
+	}
+
+	t.Run("valid templates are stored", func(t *testing.T) {
+		w := update(`{"DropTableSQL": "DROP TABLE IF EXISTS {{quote .SchemaName}}.{{quote .TableName}};\n"}`)
+
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var response schemas.ProjectResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Contains(t, response.Templates, "DropTableSQL")
+		var stored models.Project
+		require.NoError(t, db.First(&stored, project.ID).Error)
+		assert.Contains(t, stored.Templates["DropTableSQL"], "IF EXISTS")
+	})
+
+	t.Run("invalid templates are rejected", func(t *testing.T) {
+		w := update(`{"DropTableSQL": "DROP TABLE {{.Missing}};"}`)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		var stored models.Project
+		require.NoError(t, db.First(&stored, project.ID).Error)
+		assert.Contains(t, stored.Templates["DropTableSQL"], "IF EXISTS", "the previous templates are kept")
+	})
+}
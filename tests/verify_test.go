@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/Tsarbomba69-com/mammoth.server/models"
+	"github.com/Tsarbomba69-com/mammoth.server/services"
+)
+
+func TestVerifyMigration(t *testing.T) {
+	source := SetupSchemaDump(t, "source_verify", func(db *gorm.DB) {
+		db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, legacy TEXT)`)
+		db.Exec(`CREATE TABLE sessions (id INTEGER PRIMARY KEY, token TEXT NOT NULL)`)
+	})
+	target := SetupSchemaDump(t, "target_verify", func(db *gorm.DB) {
+		db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, email TEXT)`)
+		db.Exec(`CREATE TABLE posts (id INTEGER PRIMARY KEY, title TEXT NOT NULL)`)
+	})
+	plan := services.PlanMigration("postgres", services.CompareSchemas("sqlite", source, target))
+
+	t.Run("down reverts up", func(t *testing.T) {
+		scratch := SetupDB(t, "scratch_verify", func(db *gorm.DB) {})
+
+		result, err := services.VerifyMigration(scratch, "postgres", source, plan)
+
+		require.NoError(t, err)
+		assert.True(t, result.Passed, result.Error)
+		assert.Empty(t, result.FailedStep)
+		assert.False(t, result.Differences.HasChanges())
+	})
+
+	t.Run("incomplete down is reported", func(t *testing.T) {
+		scratch := SetupDB(t, "scratch_verify_incomplete", func(db *gorm.DB) {})
+		incomplete := plan
+		incomplete.Down = nil
+		for _, step := range plan.Down {
+			if step.Kind != "drop_table" {
+				incomplete.Down = append(incomplete.Down, step)
+			}
+		}
+
+		result, err := services.VerifyMigration(scratch, "postgres", source, incomplete)
+
+		require.NoError(t, err)
+		assert.False(t, result.Passed)
+		if assert.Len(t, result.Differences.TablesAdded, 1) {
+			assert.Equal(t, "posts", result.Differences.TablesAdded[0].Name)
+		}
+	})
+
+	t.Run("failing step is reported", func(t *testing.T) {
+		scratch := SetupDB(t, "scratch_verify_failing", func(db *gorm.DB) {})
+		failing := plan
+		failing.Up = append([]services.MigrationStep{{ID: "create_table:main.broken", SQL: "CREATE TABLE (;"}}, plan.Up...)
+
+		result, err := services.VerifyMigration(scratch, "postgres", source, failing)
+
+		require.NoError(t, err)
+		assert.False(t, result.Passed)
+		assert.Equal(t, "up:create_table:main.broken", result.FailedStep)
+		assert.NotEmpty(t, result.Error)
+	})
+
+	t.Run("scratch database is brought to the source schema", func(t *testing.T) {
+		scratch := SetupDB(t, "scratch_verify_existing", func(db *gorm.DB) {
+			db.Exec(`CREATE TABLE leftovers (id INTEGER PRIMARY KEY)`)
+			db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY)`)
+		})
+
+		result, err := services.VerifyMigration(scratch, "postgres", source, plan)
+
+		require.NoError(t, err)
+		assert.True(t, result.Passed, result.Error)
+		dumped, err := services.DumpSchema(scratch)
+		require.NoError(t, err)
+		assert.False(t, services.CompareSchemas("sqlite", source, dumped).HasChanges())
+	})
+}
+
+func TestPlanMigration_Reversibility(t *testing.T) {
+	fk := func(name, table string, onDelete string) models.ForeignKey {
+		return models.ForeignKey{Name: name, Columns: []string{table + "_id"}, ReferencedTable: table + "s",
+			ReferencedColumns: []string{"id"}, OnDelete: onDelete, OnUpdate: "NO ACTION"}
+	}
+
+	t.Run("removed and modified foreign keys are restored", func(t *testing.T) {
+		diff := models.SchemaDiff{TablesModified: []models.TableDiff{{
+			Name: "posts", SchemaName: "public",
+			ForeignKeyRemoved: []models.ForeignKey{fk("fk_posts_user", "user", "CASCADE")},
+			ForeignKeyModified: []models.ForeignKeyChange{{
+				Name:   "fk_posts_team",
+				Source: fk("fk_posts_team", "team", "NO ACTION"),
+				Target: fk("fk_posts_team", "team", "CASCADE"),
+			}},
+		}}}
+
+		script := services.Generate("postgres", diff)
+
+		assert.Contains(t, script.Up, "ALTER TABLE \"public\".\"posts\" DROP CONSTRAINT \"fk_posts_user\";\n")
+		assert.Contains(t, script.Up, "ALTER TABLE \"public\".\"posts\" ADD CONSTRAINT \"fk_posts_team\" FOREIGN KEY (\"team_id\") REFERENCES \"public\".\"teams\" (\"id\") ON DELETE CASCADE ON UPDATE NO ACTION;\n")
+		assert.NotContains(t, script.Up, `"\"public\""`)
+		assert.Contains(t, script.Down, "ALTER TABLE \"public\".\"posts\" ADD CONSTRAINT \"fk_posts_user\" FOREIGN KEY (\"user_id\") REFERENCES \"public\".\"users\" (\"id\") ON DELETE CASCADE ON UPDATE NO ACTION;\n")
+		before(t, script.Down, `DROP CONSTRAINT "fk_posts_team"`, `ADD CONSTRAINT "fk_posts_team" FOREIGN KEY ("team_id") REFERENCES "public"."teams" ("id") ON DELETE NO ACTION`)
+	})
+
+	t.Run("foreign key only removals are detected", func(t *testing.T) {
+		source := SetupSchemaDump(t, "source_fk_removed", func(db *gorm.DB) {
+			db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY)`)
+			db.Exec(`CREATE TABLE posts (id INTEGER PRIMARY KEY, user_id INTEGER REFERENCES users (id))`)
+		})
+		target := SetupSchemaDump(t, "target_fk_removed", func(db *gorm.DB) {
+			db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY)`)
+			db.Exec(`CREATE TABLE posts (id INTEGER PRIMARY KEY, user_id INTEGER)`)
+		})
+
+		diff := services.CompareSchemas("sqlite", source, target)
+
+		if assert.Len(t, diff.TablesModified, 1) {
+			assert.Len(t, diff.TablesModified[0].ForeignKeyRemoved, 1)
+		}
+		assert.Contains(t, services.Generate("postgres", diff).Down, "ADD CONSTRAINT")
+	})
+
+	t.Run("steps that cannot be undone say why", func(t *testing.T) {
+		source := SetupSchemaDump(t, "source_irreversible", func(db *gorm.DB) {
+			db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, legacy TEXT)`)
+		})
+		target := SetupSchemaDump(t, "target_irreversible", func(db *gorm.DB) {
+			db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, name VARCHAR(20), email TEXT)`)
+		})
+
+		plan := services.PlanMigration("postgres", services.CompareSchemas("sqlite", source, target))
+
+		steps := make(map[string]services.MigrationStep)
+		for _, step := range plan.Up {
+			steps[step.ID] = step
+		}
+		assert.Equal(t, services.IrreversibleDataLoss, steps["drop_column:main.users.legacy"].Irreversible)
+		assert.Equal(t, services.IrreversibleConversion, steps["alter_column:main.users.name"].Irreversible)
+		assert.Empty(t, steps["add_column:main.users.email"].Irreversible)
+	})
+}
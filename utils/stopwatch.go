@@ -2,6 +2,8 @@ package utils
 
 import (
 	"fmt"
+	"log"
+	"sync"
 	"time"
 )
 
@@ -11,10 +13,14 @@ type Timing struct {
 	Percent float64
 }
 
+// Stopwatch collects the elapsed time of labeled phases. It is safe for
+// concurrent use, phases with different labels may overlap.
 type Stopwatch struct {
 	startTimes map[string]time.Time
 	timings    []Timing
-	total      time.Duration
+	firstStart time.Time // Start of the earliest phase
+	lastStop   time.Time // End of the latest phase
+	mu         sync.Mutex
 }
 
 // NewStopwatch creates a new stopwatch
@@ -26,40 +32,67 @@ func NewStopwatch() *Stopwatch {
 
 // Start begins timing for a label
 func (sw *Stopwatch) Start(label string) {
-	sw.startTimes[label] = time.Now()
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	now := time.Now()
+	if sw.firstStart.IsZero() {
+		sw.firstStart = now
+	}
+	sw.startTimes[label] = now
 }
 
-// Stop ends timing for a label and stores the elapsed time
-func (sw *Stopwatch) Stop(label string) {
+// Stop ends timing for a label, stores the elapsed time and returns it
+func (sw *Stopwatch) Stop(label string) time.Duration {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
 	start, ok := sw.startTimes[label]
 	if !ok {
-		fmt.Printf("No start time recorded for label: %s\n", label)
-		return
+		log.Printf("stopwatch: no start time recorded for label %s", label)
+		return 0
 	}
-	elapsed := time.Since(start)
-	sw.total += elapsed
+	sw.lastStop = time.Now()
+	elapsed := sw.lastStop.Sub(start)
 	sw.timings = append(sw.timings, Timing{
 		Label:   label,
 		Elapsed: elapsed,
 	})
 	delete(sw.startTimes, label)
+	return elapsed
 }
 
-// Finalize calculates percentages
+// Finalize calculates the share of the wall-clock time, from the first start
+// to the last stop, spent in each phase. Overlapping phases share that time,
+// so their percentages may add up to more than 100.
 func (sw *Stopwatch) Finalize() {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.finalize()
+}
+
+func (sw *Stopwatch) finalize() {
+	wall := sw.lastStop.Sub(sw.firstStart)
+	if wall <= 0 {
+		return
+	}
 	for i := range sw.timings {
-		sw.timings[i].Percent = (float64(sw.timings[i].Elapsed) / float64(sw.total)) * 100
+		sw.timings[i].Percent = (float64(sw.timings[i].Elapsed) / float64(wall)) * 100
 	}
 }
 
+// Timings returns the finalized timings in the order they were stopped
+func (sw *Stopwatch) Timings() []Timing {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.finalize()
+	return append([]Timing(nil), sw.timings...)
+}
+
 // PrintTable outputs the collected timings as a formatted table
 func (sw *Stopwatch) PrintTable() {
-	sw.Finalize()
-
 	fmt.Println("┌──────────────────────────┬──────────────┬──────────────┐")
 	fmt.Println("│ Label                    │ Elapsed Time │ Percentage   │")
 	fmt.Println("├──────────────────────────┼──────────────┼──────────────┤")
-	for _, t := range sw.timings {
+	for _, t := range sw.Timings() {
 		fmt.Printf("│ %-24s │ %-12s │ %6.2f %%     │\n", t.Label, t.Elapsed, t.Percent)
 	}
 	fmt.Println("└──────────────────────────┴──────────────┴──────────────┘")